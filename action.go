@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Actions of issues events labeling and assigning the issue
+var githubIssueActions = map[string]bool{
+	"opened":   true,
+	"reopened": true,
+	"edited":   true,
+}
+
+// githubActionEvent is the part of the GitHub Actions event payloads used by chiefr
+type githubActionEvent struct {
+	Action      string `json:"action"`
+	PullRequest struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+		Base    struct {
+			Ref  string `json:"ref"`
+			Repo struct {
+				CloneURL string `json:"clone_url"`
+			} `json:"repo"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Issue struct {
+		HTMLURL string `json:"html_url"`
+		// set if the issue is a pull request
+		PullRequest *struct {
+			HTMLURL string `json:"html_url"`
+		} `json:"pull_request"`
+	} `json:"issue"`
+	Comment struct {
+		Body string `json:"body"`
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"comment"`
+}
+
+// readGitHubActionEvent reads the event payload of the workflow run from GITHUB_EVENT_PATH
+func readGitHubActionEvent() (*githubActionEvent, error) {
+	path := os.Getenv("GITHUB_EVENT_PATH")
+	if path == "" {
+		return nil, errors.New("GITHUB_EVENT_PATH is not set, chiefr action must run in a GitHub Actions workflow")
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read event payload: %s", err)
+	}
+	event := &githubActionEvent{}
+	if err := json.Unmarshal(content, event); err != nil {
+		return nil, fmt.Errorf("Failed to parse event payload: %s", err)
+	}
+	return event, nil
+}
+
+// actionToken returns the GITHUB_TOKEN of the workflow, falling back to the other token sources
+func actionToken(forgeURL string) (string, error) {
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token, nil
+	}
+	return apiToken(forgeURL, "")
+}
+
+// runAction handles the event of the GitHub Actions workflow run: pull requests are updated like
+// update-pull-request, issues like update-issue, the slash commands of pull request comments are applied,
+// other events are ignored
+func runAction(c *Config, repoPath string, opts *pullRequestOptions) error {
+	event, err := readGitHubActionEvent()
+	if err != nil {
+		return err
+	}
+	name := os.Getenv("GITHUB_EVENT_NAME")
+	opts.event = fmt.Sprintf("github-actions %s %s", name, event.Action)
+	switch name {
+	case "pull_request", "pull_request_target":
+		pr := event.PullRequest
+		if pr.HTMLURL == "" || pr.Base.Ref == "" || pr.Base.Repo.CloneURL == "" {
+			return errors.New("Pull request not found in the event payload")
+		}
+		if !githubPullRequestActions[event.Action] {
+			fmt.Printf("Ignoring action '%s'\n", event.Action)
+			return nil
+		}
+		token, err := actionToken(pr.HTMLURL)
+		if err != nil {
+			return err
+		}
+		// the refs are known from the payload, so the pull request is fetched without API request
+		revision, err := fetchPullRequest(repoPath, &pullRequestRefs{
+			Number:   pr.Number,
+			CloneURL: pr.Base.Repo.CloneURL,
+			Head:     fmt.Sprintf("refs/pull/%d/head", pr.Number),
+			Base:     "refs/heads/" + pr.Base.Ref,
+		}, token)
+		if err != nil {
+			return err
+		}
+		return checkPullRequest(c, repoPath, revision, &changeSource{kind: committedChanges}, pr.HTMLURL, token, opts)
+	case "issues":
+		if event.Issue.HTMLURL == "" || event.Issue.PullRequest != nil {
+			return errors.New("Issue not found in the event payload")
+		}
+		if !githubIssueActions[event.Action] {
+			fmt.Printf("Ignoring action '%s'\n", event.Action)
+			return nil
+		}
+		token, err := actionToken(event.Issue.HTMLURL)
+		if err != nil {
+			return err
+		}
+		return updateIssue(c, event.Issue.HTMLURL, token, opts.dryRun, opts.event)
+	case "issue_comment":
+		if event.Action != "created" || event.Issue.PullRequest == nil || len(parseSlashCommands(event.Comment.Body)) == 0 {
+			fmt.Println("Ignoring comment")
+			return nil
+		}
+		prURL := event.Issue.PullRequest.HTMLURL
+		token, err := actionToken(prURL)
+		if err != nil {
+			return err
+		}
+		// the refs of the pull request are missing from the payload
+		opts.fetch = true
+		opts.event += " by " + event.Comment.User.Login
+		return handleSlashCommands(c, repoPath, prURL, event.Comment.User.Login, event.Comment.Body, token, opts)
+	default:
+		fmt.Printf("Ignoring event '%s'\n", name)
+		return nil
+	}
+}
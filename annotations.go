@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GitHub Actions workflow command escaping of the messages and the properties
+var (
+	annotationDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	annotationPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// annotation formats a GitHub Actions workflow command annotating the file, file can be empty
+func annotation(level, file, title, message string) string {
+	properties := make([]string, 0, 2)
+	if file != "" {
+		properties = append(properties, "file="+annotationPropertyEscaper.Replace(file))
+	}
+	properties = append(properties, "title="+annotationPropertyEscaper.Replace(title))
+	return fmt.Sprintf("::%s %s::%s", level, strings.Join(properties, ","), annotationDataEscaper.Replace(message))
+}
+
+// writeAnnotations writes the segments of the changed files as notices and the uncovered files as errors,
+// GitHub Actions shows them inline in the changed files of the pull request
+func writeAnnotations(w io.Writer, info *PatchInfo, report *ownershipReport) {
+	chiefs := make(map[string][]string)
+	for _, s := range report.Segments {
+		chiefs[s.Name] = s.Chiefs
+	}
+	for _, f := range info.Files {
+		segments := make([]string, 0)
+		for _, a := range info.fileAttributions(info.Attributions, f) {
+			if _, found := chiefs[a.Segment]; found {
+				appendNew(&segments, a.Segment)
+			}
+		}
+		if len(segments) == 0 {
+			continue
+		}
+		for i, s := range segments {
+			if len(chiefs[s]) != 0 {
+				segments[i] = fmt.Sprintf("%s (chiefs: %s)", s, strings.Join(chiefs[s], ", "))
+			}
+		}
+		fmt.Fprintln(w, annotation("notice", f, "chiefr", "Segments: "+strings.Join(segments, ", ")))
+	}
+	for _, f := range report.Uncovered {
+		fmt.Fprintln(w, annotation("error", f, "chiefr", "The file doesn't belong to any segment of the maintainers file"))
+	}
+	fmt.Fprintln(w, annotation("notice", "", "chiefr", report.title()))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// requiredApprovals returns the number of approvals the segment's pull requests need from its chiefs or reviewers
+func (c *Config) requiredApprovals(s *ProjectSegment) int {
+	if s.RequiredApprovals > 0 {
+		return s.RequiredApprovals
+	}
+	if c.Settings.RequiredApprovals > 0 {
+		return c.Settings.RequiredApprovals
+	}
+	return 1
+}
+
+// segmentApprovers returns the chiefs and the reviewers of the segment
+func segmentApprovers(s *ProjectSegment) []string {
+	approvers := make([]string, 0, len(s.Chiefs)+len(s.Reviewers))
+	for _, u := range append(append([]string{}, s.Chiefs...), s.Reviewers...) {
+		appendNew(&approvers, u)
+	}
+	return approvers
+}
+
+// checkRequiredApprovals returns error if the segment can never get its required approvals,
+// the segments with team references can't be checked without the members of the teams
+func (c *Config) checkRequiredApprovals(s *ProjectSegment) error {
+	approvers := segmentApprovers(s)
+	for _, a := range approvers {
+		if strings.HasPrefix(a, "@") {
+			return nil
+		}
+	}
+	if required := c.requiredApprovals(s); required > len(approvers) {
+		return fmt.Errorf("'RequiredApprovals' is %d, but the segment has only %d chiefs and reviewers", required, len(approvers))
+	}
+	return nil
+}
+
+// missingApprovals returns the segments lacking the required approvals, the requirement is capped at
+// the number of approvers other than the author, who can't approve their own pull request,
+// expand resolves the GitHub team references of the approvers to their members
+func (c *Config) missingApprovals(segments orderedSegmentList, approved []string, author string, expand func([]string) ([]string, error)) ([]string, error) {
+	approvedBy := make(map[string]bool)
+	for _, u := range approved {
+		approvedBy[strings.ToLower(u)] = true
+	}
+	missing := make([]string, 0)
+	for _, s := range segments {
+		approvers, err := expand(segmentApprovers(s))
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		eligible := 0
+		for _, a := range approvers {
+			if strings.EqualFold(a, author) {
+				continue
+			}
+			eligible++
+			if approvedBy[strings.ToLower(a)] {
+				n++
+			}
+		}
+		if eligible == 0 {
+			missing = append(missing, fmt.Sprintf("%s: no approvers other than the author among %s", s.Name, strings.Join(segmentApprovers(s), ", ")))
+			continue
+		}
+		required := c.requiredApprovals(s)
+		if required > eligible {
+			required = eligible
+		}
+		if n < required {
+			missing = append(missing, fmt.Sprintf("%s: %d of %d approvals from %s", s.Name, n, required, strings.Join(segmentApprovers(s), ", ")))
+		}
+	}
+	return missing, nil
+}
+
+// Merge modes of approved pull requests
+const (
+	mergeNow  string = "merge"
+	mergeAuto string = "auto"
+)
+
+// verifyApprovals fails if any segment of the pull request lacks the required approvals,
+// approved pull requests are merged according to the merge mode
+func verifyApprovals(c *Config, repoPath, revision string, source *changeSource, prURL, APIKey string, fetch bool, mergeMode string, dryRun bool) error {
+	pm, err := getProjectManagerFromURL(prURL)
+	if err != nil {
+		return err
+	}
+	pm.SetAPIKey(APIKey)
+	pm.SetDryRun(dryRun)
+	pm.SetEvent("verify-approvals")
+	if fetch {
+		refs, err := pm.PullRequestRefs(prURL)
+		if err != nil {
+			return err
+		}
+		revision, err = fetchPullRequest(repoPath, refs, APIKey)
+		if err != nil {
+			return err
+		}
+	}
+	info, err := analyzeChanges(c, repoPath, revision, source)
+	if err != nil {
+		return err
+	}
+	segments := c.rankSegments(info)
+	if len(segments) == 0 {
+		return errors.New("No matching segments found for this patch")
+	}
+	approved, err := pm.PullRequestApprovals(prURL)
+	if err != nil {
+		return err
+	}
+	author, err := pm.PullRequestAuthor(prURL)
+	if err != nil {
+		return err
+	}
+	missing, err := c.missingApprovals(segments, approved, author, pm.ExpandTeams)
+	if err != nil {
+		return err
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("The following segments lack approvals:\n - %s", strings.Join(missing, "\n - "))
+	}
+	fmt.Println("Every segment is approved")
+	if mergeMode == "" {
+		return nil
+	}
+	return pm.MergePullRequest(prURL, c.Settings.MergeMethod, mergeMode == mergeAuto)
+}
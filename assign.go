@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	assignStrategyAll        string = "all"
+	assignStrategyRoundRobin string = "round-robin"
+	assignStrategyLeastLoad  string = "least-loaded"
+)
+
+// Maximum number of assignees of a GitHub issue or pull request
+const maxGitHubAssignees int = 10
+
+func validAssignStrategy(strategy string) bool {
+	switch strategy {
+	case assignStrategyAll, assignStrategyRoundRobin, assignStrategyLeastLoad:
+		return true
+	}
+	return false
+}
+
+// Index of the next chief of the rotating segments keyed by repository URL and segment name
+type rotationState map[string]int
+
+func rotationStatePath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "chiefr", "rotation.json"), nil
+}
+
+// setRotationState sets the path of the rotation state file, the default is in the user cache directory
+func (c *Config) setRotationState(path string) error {
+	if path == "" {
+		var err error
+		path, err = rotationStatePath()
+		if err != nil {
+			return fmt.Errorf("Failed to find cache directory: %s", err)
+		}
+	}
+	c.rotationState = path
+	return nil
+}
+
+// rotationMu serializes the assignments using the rotation state file from loading to saving it,
+// so the concurrent updates of the webhook server don't lose rotations
+var rotationMu sync.Mutex
+
+// loadRotationState reads the rotation state file, a missing file is an empty state
+func loadRotationState(path string) (rotationState, error) {
+	state := make(rotationState)
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read rotation state: %s", err)
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("Failed to parse rotation state '%s': %s", path, err)
+	}
+	return state, nil
+}
+
+func (r rotationState) save(path string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to save rotation state: %s", err)
+	}
+	if err := writeFileAtomic(path, content); err != nil {
+		return fmt.Errorf("Failed to save rotation state: %s", err)
+	}
+	return nil
+}
+
+// lockRotationState locks the rotation state file from loading to saving it, against the other
+// goroutines and the other chiefr processes sharing the file, the returned function unlocks it
+func lockRotationState(path string) (func(), error) {
+	rotationMu.Lock()
+	lock, err := lockFile(path)
+	if err != nil {
+		rotationMu.Unlock()
+		return nil, err
+	}
+	return func() {
+		lock.unlock()
+		rotationMu.Unlock()
+	}, nil
+}
+
+// resume starts the rotation of the key after the candidate assigned last according to the history,
+// so a lost rotation state doesn't restart the rotation from the first candidate
+func (r rotationState) resume(key string, candidates []string, last map[string]time.Time) {
+	latest := time.Time{}
+	for i, c := range candidates {
+		if t := last[strings.ToLower(c)]; t.After(latest) {
+			latest = t
+			r[key] = (i + 1) % len(candidates)
+		}
+	}
+}
+
+// next returns the next candidate of the rotation skipping the excluded users,
+// empty string is returned if there is no other candidate
+func (r rotationState) next(key string, candidates []string, skip func(string) bool) string {
+	n := len(candidates)
+	for i := 0; i < n; i++ {
+		idx := (r[key] + i) % n
+		if skip(candidates[idx]) {
+			continue
+		}
+		r[key] = (idx + 1) % n
+		return candidates[idx]
+	}
+	return ""
+}
+
+// selectChiefs returns the chiefs to assign to the pull request of the repository according to
+// the assignment strategy of the segments, the skipped users (e.g. the author) aren't selected;
+// load returns the number of open pull requests assigned to the chief or waiting for their review,
+// the assignment history (can be nil) resumes lost rotations and breaks the ties of the loads,
+// assigned are the current assignees of the pull request or issue
+func (c *Config) selectChiefs(repoURL string, segments orderedSegmentList, skip func(string) bool, state rotationState, history *assignmentHistory, assigned []string, load func(string) (int, error)) ([]string, error) {
+	chiefs := make([]string, 0)
+	recent := history.counts(repoURL, time.Now().Add(-historyLoadWindow))
+	for _, s := range segments {
+		strategy := c.assignStrategy(s)
+		// repeated runs keep the chief selected earlier instead of selecting one more
+		if strategy == assignStrategyRoundRobin || strategy == assignStrategyLeastLoad {
+			if chief := assignedChief(s, assigned); chief != "" {
+				appendNew(&chiefs, chief)
+				continue
+			}
+		}
+		switch strategy {
+		case assignStrategyRoundRobin:
+			key := repoURL + " " + s.Name
+			if _, found := state[key]; !found {
+				state.resume(key, s.Chiefs, history.lastAssigned(repoURL))
+			}
+			if chief := state.next(key, s.Chiefs, skip); chief != "" {
+				appendNew(&chiefs, chief)
+			}
+		case assignStrategyLeastLoad:
+			chief := ""
+			minLoad, minRecent := 0, 0
+			for _, candidate := range s.Chiefs {
+				if skip(candidate) {
+					continue
+				}
+				n, err := load(candidate)
+				if err != nil {
+					return nil, err
+				}
+				// ties are resolved by the recent assignments, then by the order of the chiefs
+				r := recent[strings.ToLower(candidate)]
+				if chief == "" || n < minLoad || n == minLoad && r < minRecent {
+					chief, minLoad, minRecent = candidate, n, r
+				}
+			}
+			if chief != "" {
+				appendNew(&chiefs, chief)
+			}
+		default:
+			n := 0
+			for _, chief := range s.Chiefs {
+				if s.MaxAssignees > 0 && n == s.MaxAssignees {
+					break
+				}
+				if !skip(chief) {
+					appendNew(&chiefs, chief)
+					n++
+				}
+			}
+		}
+	}
+	// the chiefs of the higher priority segments are kept
+	if c.Settings.MaxAssignees > 0 && len(chiefs) > c.Settings.MaxAssignees {
+		chiefs = chiefs[:c.Settings.MaxAssignees]
+	}
+	return chiefs, nil
+}
+
+// assignStrategy returns the assignment strategy of the segment, segments inherit the global strategy
+func (c *Config) assignStrategy(s *ProjectSegment) string {
+	if s.AssignStrategy != "" {
+		return s.AssignStrategy
+	}
+	return c.Settings.AssignStrategy
+}
+
+// assignedChief returns the first chief of the segment among the assignees, empty if none of them is assigned
+func assignedChief(s *ProjectSegment, assigned []string) string {
+	for _, chief := range s.Chiefs {
+		if containsUser(assigned, chief) {
+			return chief
+		}
+	}
+	return ""
+}
+
+// usesAssignStrategy reports whether any of the segments uses the assignment strategy
+func (c *Config) usesAssignStrategy(segments orderedSegmentList, strategy string) bool {
+	for _, s := range segments {
+		if c.assignStrategy(s) == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// managedChiefs returns the lowercase chiefs of the segments
+func (c *Config) managedChiefs(segments orderedSegmentList) map[string]bool {
+	chiefs := make(map[string]bool)
+	for _, s := range segments {
+		for _, chief := range s.Chiefs {
+			chiefs[strings.ToLower(chief)] = true
+		}
+	}
+	return chiefs
+}
+
+// segmentMilestone returns the milestone of the highest ranked segment having one
+func segmentMilestone(segments orderedSegmentList) string {
+	for _, s := range segments {
+		if s.Milestone != "" {
+			return s.Milestone
+		}
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSelectChiefs(t *testing.T) {
+	const repoURL = "https://github.com/asciimoo/chiefr"
+	core := &ProjectSegment{Name: "core", Chiefs: []string{"alice", "bob"}}
+	docs := &ProjectSegment{Name: "docs", Chiefs: []string{"bob", "carol"}}
+	single := &ProjectSegment{Name: "single", Chiefs: []string{"alice", "bob"}, MaxAssignees: 1}
+	noSkip := func(string) bool { return false }
+	loads := func(loads map[string]int) func(string) (int, error) {
+		return func(login string) (int, error) { return loads[login], nil }
+	}
+	recently := &assignmentHistory{Assignments: []*assignmentRecord{
+		{Repository: repoURL, URL: repoURL + "/pull/1", Chief: "alice", Time: time.Now().Add(-time.Hour)},
+	}}
+	tests := []struct {
+		name         string
+		strategy     string
+		maxAssignees int
+		segments     orderedSegmentList
+		skip         func(string) bool
+		state        rotationState
+		history      *assignmentHistory
+		assigned     []string
+		load         func(string) (int, error)
+		want         []string
+		wantState    rotationState
+	}{
+		{
+			name:     "all chiefs",
+			strategy: assignStrategyAll,
+			segments: orderedSegmentList{core, docs},
+			want:     []string{"alice", "bob", "carol"},
+		},
+		{
+			name:     "skipped author",
+			strategy: assignStrategyAll,
+			segments: orderedSegmentList{core, docs},
+			skip:     func(login string) bool { return login == "bob" },
+			want:     []string{"alice", "carol"},
+		},
+		{
+			name:     "segment maximum",
+			strategy: assignStrategyAll,
+			segments: orderedSegmentList{single, docs},
+			want:     []string{"alice", "bob", "carol"},
+		},
+		{
+			name:         "global maximum keeps the higher priority chiefs",
+			strategy:     assignStrategyAll,
+			maxAssignees: 2,
+			segments:     orderedSegmentList{core, docs},
+			want:         []string{"alice", "bob"},
+		},
+		{
+			name:      "round-robin starts with the first chief",
+			strategy:  assignStrategyRoundRobin,
+			segments:  orderedSegmentList{core},
+			state:     rotationState{},
+			want:      []string{"alice"},
+			wantState: rotationState{repoURL + " core": 1},
+		},
+		{
+			name:      "round-robin rotates",
+			strategy:  assignStrategyRoundRobin,
+			segments:  orderedSegmentList{core},
+			state:     rotationState{repoURL + " core": 1},
+			want:      []string{"bob"},
+			wantState: rotationState{repoURL + " core": 0},
+		},
+		{
+			name:      "round-robin skips the author",
+			strategy:  assignStrategyRoundRobin,
+			segments:  orderedSegmentList{core},
+			skip:      func(login string) bool { return login == "bob" },
+			state:     rotationState{repoURL + " core": 1},
+			want:      []string{"alice"},
+			wantState: rotationState{repoURL + " core": 1},
+		},
+		{
+			name:      "round-robin keeps the assigned chief",
+			strategy:  assignStrategyRoundRobin,
+			segments:  orderedSegmentList{core},
+			state:     rotationState{repoURL + " core": 0},
+			assigned:  []string{"Bob"},
+			want:      []string{"bob"},
+			wantState: rotationState{repoURL + " core": 0},
+		},
+		{
+			name:      "lost rotation resumes after the chief assigned last",
+			strategy:  assignStrategyRoundRobin,
+			segments:  orderedSegmentList{core},
+			state:     rotationState{},
+			history:   recently,
+			want:      []string{"bob"},
+			wantState: rotationState{repoURL + " core": 0},
+		},
+		{
+			name:     "least loaded chief",
+			strategy: assignStrategyLeastLoad,
+			segments: orderedSegmentList{core},
+			load:     loads(map[string]int{"alice": 3, "bob": 1}),
+			want:     []string{"bob"},
+		},
+		{
+			name:     "equal loads are broken by the recent assignments",
+			strategy: assignStrategyLeastLoad,
+			segments: orderedSegmentList{core},
+			history:  recently,
+			load:     loads(map[string]int{"alice": 1, "bob": 1}),
+			want:     []string{"bob"},
+		},
+		{
+			name:     "equal loads keep the order of the chiefs",
+			strategy: assignStrategyLeastLoad,
+			segments: orderedSegmentList{core},
+			load:     loads(map[string]int{}),
+			want:     []string{"alice"},
+		},
+	}
+	for _, tt := range tests {
+		c := &Config{Settings: Settings{AssignStrategy: tt.strategy, MaxAssignees: tt.maxAssignees}}
+		if tt.skip == nil {
+			tt.skip = noSkip
+		}
+		if tt.state == nil {
+			tt.state = rotationState{}
+		}
+		if tt.load == nil {
+			tt.load = loads(nil)
+		}
+		got, err := c.selectChiefs(repoURL, tt.segments, tt.skip, tt.state, tt.history, tt.assigned, tt.load)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if tt.wantState != nil && !reflect.DeepEqual(tt.state, tt.wantState) {
+			t.Errorf("%s: rotation state %v, want %v", tt.name, tt.state, tt.wantState)
+		}
+	}
+}
+
+func TestRotationStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rotation.json")
+	state, err := loadRotationState(path)
+	if err != nil || len(state) != 0 {
+		t.Fatalf("missing rotation state = %v, %v, want empty state", state, err)
+	}
+	state["https://github.com/asciimoo/chiefr core"] = 2
+	if err := state.save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadRotationState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, state) {
+		t.Errorf("loaded rotation state %v, want %v", loaded, state)
+	}
+}
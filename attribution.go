@@ -0,0 +1,678 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"regexp/syntax"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Compiled segment pattern
+type pattern struct {
+	// Maintainers file key of the pattern
+	key string
+	// Pattern as written in the maintainers file
+	source string
+	re     *regexp.Regexp
+	// Literal string to match without the regexp engine
+	literal      string
+	literalMatch literalMatch
+}
+
+// Pseudo pattern of the files attributed to fallback segments
+var fallbackPattern = &pattern{key: "Fallback", source: "true"}
+
+type literalMatch int
+
+const (
+	literalNone literalMatch = iota
+	// the string contains the literal
+	literalContains
+	// the string starts with the literal
+	literalPrefix
+	// the string is the literal
+	literalExact
+	// the string is the literal or starts with the literal followed by a slash
+	literalDirectory
+)
+
+func newPattern(key, source, expr string) (*pattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &pattern{key: key, source: source, re: re}
+	p.literal, p.literalMatch = literalPattern(expr)
+	return p, nil
+}
+
+// literalPattern detects the regexps matching plain paths or path prefixes
+func literalPattern(expr string) (string, literalMatch) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return "", literalNone
+	}
+	re = re.Simplify()
+	literal := func(r *syntax.Regexp) (string, bool) {
+		if r.Op != syntax.OpLiteral || r.Flags&syntax.FoldCase != 0 {
+			return "", false
+		}
+		return string(r.Rune), true
+	}
+	anyString := func(r *syntax.Regexp) bool {
+		return r.Op == syntax.OpStar && (r.Sub[0].Op == syntax.OpAnyCharNotNL || r.Sub[0].Op == syntax.OpAnyChar)
+	}
+	if l, ok := literal(re); ok {
+		return l, literalContains
+	}
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText {
+		return "", literalNone
+	}
+	l, ok := literal(re.Sub[1])
+	if !ok {
+		return "", literalNone
+	}
+	rest := re.Sub[2:]
+	switch {
+	case len(rest) == 0:
+		return l, literalPrefix
+	case len(rest) == 1 && anyString(rest[0]):
+		return l, literalPrefix
+	case len(rest) == 1 && rest[0].Op == syntax.OpEndText:
+		return l, literalExact
+	case len(rest) == 2 && rest[1].Op == syntax.OpEndText && isSlashSuffix(rest[0]):
+		return l, literalDirectory
+	}
+	return "", literalNone
+}
+
+// isSlashSuffix reports whether the regexp is an optional slash followed by anything: (/.*)?
+func isSlashSuffix(r *syntax.Regexp) bool {
+	if r.Op == syntax.OpCapture && len(r.Sub) == 1 {
+		r = r.Sub[0]
+	}
+	if r.Op != syntax.OpQuest {
+		return false
+	}
+	r = r.Sub[0]
+	if r.Op == syntax.OpCapture && len(r.Sub) == 1 {
+		r = r.Sub[0]
+	}
+	return r.Op == syntax.OpConcat &&
+		len(r.Sub) == 2 &&
+		r.Sub[0].Op == syntax.OpLiteral && string(r.Sub[0].Rune) == "/" &&
+		r.Sub[1].Op == syntax.OpStar && (r.Sub[1].Sub[0].Op == syntax.OpAnyCharNotNL || r.Sub[1].Sub[0].Op == syntax.OpAnyChar)
+}
+
+func (p *pattern) MatchString(s string) bool {
+	switch p.literalMatch {
+	case literalContains:
+		return strings.Contains(s, p.literal)
+	case literalPrefix:
+		return strings.HasPrefix(s, p.literal)
+	case literalExact:
+		return s == p.literal
+	case literalDirectory:
+		return s == p.literal || strings.HasPrefix(s, p.literal+"/")
+	}
+	return p.re.MatchString(s)
+}
+
+// matchDepth returns the number of path components of the shortest directory of the path matching the pattern,
+// patterns matching only the whole path (e.g. file extensions) are the deepest
+func (p *pattern) matchDepth(path string) int {
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		dir := strings.Join(parts[:i], "/")
+		if p.MatchString(dir) || p.MatchString(dir+"/") {
+			return i
+		}
+	}
+	return len(parts)
+}
+
+// isFileNamePattern reports whether the pattern is matched against file paths
+func (p *pattern) isFileNamePattern() bool {
+	return p.key == "FilePatterns" || p.key == "FileGlobs"
+}
+
+// Result of matching a patch against the segments
+type PatchInfo struct {
+	Segments     ProjectSegments
+	Files        []string
+	Attributions []*Attribution
+	// Old paths of the renamed files indexed by the new paths
+	Renames map[string]string
+	// Attributions dropped in favor of exclusive segments
+	Hidden []*Attribution
+	// Weighted number of changed lines attributed to the segments
+	Scores map[string]float64
+	// Number of added and deleted lines of the patch
+	Additions int
+	Deletions int
+}
+
+// weight returns the weight of the changed lines attributed by the pattern
+func (s *ProjectSegment) weight(p *pattern) float64 {
+	if w, found := s.patternWeights[p.source]; found {
+		return w
+	}
+	return 1
+}
+
+// rankSegments orders the segments of the patch according to the rank strategy
+func (c *Config) rankSegments(p *PatchInfo) orderedSegmentList {
+	os := sortedSegments(p.Segments)
+	if c.Settings.RankStrategy == rankStrategyScore {
+		sort.SliceStable(os, func(i, j int) bool {
+			return p.Scores[os[i].Name] > p.Scores[os[j].Name]
+		})
+	}
+	return os
+}
+
+// changedLines returns the number of added and deleted lines of the file patch, at least 1
+func changedLines(p diff.FilePatch) int {
+	lines := 0
+	for _, chunk := range p.Chunks() {
+		if chunk.Type() != diff.Equal {
+			lines += countLines(chunk.Content())
+		}
+	}
+	if lines == 0 {
+		return 1
+	}
+	return lines
+}
+
+// Reason of attributing a changed file to a segment
+type Attribution struct {
+	Segment string
+	Path    string
+	// Commit matching the message pattern
+	Commit *object.Commit
+	// Pattern causing the attribution
+	Pattern *pattern
+	// Hunks matching the content pattern
+	Hunks []*Hunk
+	// Changed declaration matching the symbol pattern
+	Symbol string
+	// Changed file of the submodule attributed to the submodule segment
+	SubmoduleFile string
+}
+
+// Line range of a patch chunk
+type Hunk struct {
+	Operation diff.Operation
+	Content   string
+	// Line numbers of deleted lines are in the original file, the others are in the new file
+	Start int
+	End   int
+}
+
+func (h *Hunk) String() string {
+	prefix := " "
+	switch h.Operation {
+	case diff.Add:
+		prefix = "+"
+	case diff.Delete:
+		prefix = "-"
+	}
+	if h.Start == h.End {
+		return fmt.Sprintf("%s%d", prefix, h.Start)
+	}
+	return fmt.Sprintf("%s%d-%d", prefix, h.Start, h.End)
+}
+
+func (a *Attribution) String() string {
+	if a.Commit != nil {
+		subject := strings.SplitN(a.Commit.Message, "\n", 2)[0]
+		return fmt.Sprintf("commit %s '%s': %s", a.Commit.Hash.String()[:7], subject, a.reason())
+	}
+	return fmt.Sprintf("%s: %s", a.Path, a.reason())
+}
+
+// reason describes the pattern causing the attribution
+func (a *Attribution) reason() string {
+	var r string
+	switch {
+	case a.Pattern == fallbackPattern:
+		r = "Fallback segment, no other segment matches"
+	case len(a.Hunks) != 0:
+		hunks := make([]string, 0, len(a.Hunks))
+		for _, h := range a.Hunks {
+			hunks = append(hunks, strings.TrimSpace(h.String()))
+		}
+		r = fmt.Sprintf("%s '%s' at lines %s", a.Pattern.key, a.Pattern.source, strings.Join(hunks, ", "))
+	case a.Symbol != "":
+		r = fmt.Sprintf("%s '%s' at %s", a.Pattern.key, a.Pattern.source, a.Symbol)
+	default:
+		r = fmt.Sprintf("%s '%s'", a.Pattern.key, a.Pattern.source)
+	}
+	if a.SubmoduleFile != "" {
+		r = fmt.Sprintf("%s in submodule file %s", r, a.SubmoduleFile)
+	}
+	return r
+}
+
+// checkCoverage returns error listing the changed files not attributed to any segment
+func (p *PatchInfo) checkCoverage() error {
+	uncovered := p.uncoveredFiles()
+	if len(uncovered) != 0 {
+		return fmt.Errorf("The following files don't belong to any segment:\n - %s", strings.Join(uncovered, "\n - "))
+	}
+	return nil
+}
+
+// patchSize returns the number of added and deleted lines of the text file patches
+func patchSize(patches []diff.FilePatch) (int, int) {
+	additions, deletions := 0, 0
+	for _, p := range patches {
+		if p.IsBinary() {
+			continue
+		}
+		for _, c := range p.Chunks() {
+			lines := strings.Count(c.Content(), "\n")
+			if !strings.HasSuffix(c.Content(), "\n") && c.Content() != "" {
+				lines++
+			}
+			switch c.Type() {
+			case diff.Add:
+				additions += lines
+			case diff.Delete:
+				deletions += lines
+			}
+		}
+	}
+	return additions, deletions
+}
+
+// uncoveredFiles returns the changed files not attributed to any segment
+func (p *PatchInfo) uncoveredFiles() []string {
+	uncovered := make([]string, 0)
+	for _, f := range p.Files {
+		if len(p.fileAttributions(p.Attributions, f)) == 0 {
+			uncovered = append(uncovered, f)
+		}
+	}
+	return uncovered
+}
+
+// fileAttributions filters the attributions of the changed file
+func (p *PatchInfo) fileAttributions(attributions []*Attribution, path string) []*Attribution {
+	filtered := make([]*Attribution, 0)
+	for _, a := range attributions {
+		if a.Commit == nil && (a.Path == path || a.Path == p.Renames[path]) {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+func (p *PatchInfo) segmentAttributions(segment string) []*Attribution {
+	attributions := make([]*Attribution, 0)
+	for _, a := range p.Attributions {
+		if a.Segment == segment {
+			attributions = append(attributions, a)
+		}
+	}
+	return attributions
+}
+
+func countLines(s string) int {
+	n := strings.Count(s, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
+}
+
+// patchHunks splits the file patch to hunks with line numbers
+func patchHunks(p diff.FilePatch) []*Hunk {
+	hunks := make([]*Hunk, 0)
+	oldLine, newLine := 1, 1
+	for _, chunk := range p.Chunks() {
+		lines := countLines(chunk.Content())
+		h := &Hunk{Operation: chunk.Type(), Content: chunk.Content()}
+		switch chunk.Type() {
+		case diff.Equal:
+			h.Start = newLine
+			oldLine += lines
+			newLine += lines
+		case diff.Add:
+			h.Start = newLine
+			newLine += lines
+		case diff.Delete:
+			h.Start = oldLine
+			oldLine += lines
+		}
+		h.End = h.Start + lines - 1
+		if lines == 0 {
+			h.End = h.Start
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks
+}
+
+// matchingLines returns the line ranges of the hunk matching the regexp,
+// or the whole hunk if the regexp matches only multiple lines together
+func (h *Hunk) matchingLines(re *regexp.Regexp) []*Hunk {
+	ranges := make([]*Hunk, 0)
+	var current *Hunk
+	for i, l := range strings.Split(strings.TrimSuffix(h.Content, "\n"), "\n") {
+		if !re.MatchString(l) {
+			current = nil
+			continue
+		}
+		if current == nil {
+			current = &Hunk{Operation: h.Operation, Start: h.Start + i}
+			ranges = append(ranges, current)
+		}
+		current.End = h.Start + i
+		current.Content += l + "\n"
+	}
+	if len(ranges) == 0 {
+		return []*Hunk{h}
+	}
+	return ranges
+}
+
+// attribute returns the reason of attributing the file patch to the segment or nil,
+// file loads the contents of the changed file, it is nil if the contents are not available
+func (s *ProjectSegment) attribute(p diff.FilePatch, path string, file *changedFile) *Attribution {
+	if fp := s.fileNameMatch(path); fp != nil {
+		return &Attribution{Segment: s.Name, Path: path, Pattern: fp}
+	}
+	// binary patches have no content to match
+	if p.IsBinary() {
+		for _, bp := range s.binaryPatterns {
+			if bp.MatchString(path) {
+				return &Attribution{Segment: s.Name, Path: path, Pattern: bp}
+			}
+		}
+		return nil
+	}
+	if a := s.attributeDiff(p, path); a != nil {
+		return a
+	}
+	if a := s.attributeSymbols(path, file); a != nil {
+		return a
+	}
+	return s.attributeFileContent(path, file)
+}
+
+// attributeDiff matches the content patterns against the file patch
+func (s *ProjectSegment) attributeDiff(p diff.FilePatch, path string) *Attribution {
+	if len(s.contentPatterns) == 0 {
+		return nil
+	}
+	hunks := make([]*Hunk, 0)
+	var buffer strings.Builder
+	for _, h := range patchHunks(p) {
+		if s.ContentChangesOnly && h.Operation == diff.Equal {
+			continue
+		}
+		hunks = append(hunks, h)
+		buffer.WriteString(h.Content)
+		if s.MaxContentMatchBytes > 0 && buffer.Len() > s.MaxContentMatchBytes {
+			return nil
+		}
+	}
+	diffContent := buffer.String()
+	// content match
+	for _, cp := range s.contentPatterns {
+		if !cp.re.MatchString(diffContent) {
+			continue
+		}
+		excluded := false
+		for _, cep := range s.contentExcludePatterns {
+			if cep.re.MatchString(diffContent) {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			continue
+		}
+		a := &Attribution{Segment: s.Name, Path: path, Pattern: cp, Hunks: make([]*Hunk, 0)}
+		for _, h := range hunks {
+			if cp.re.MatchString(h.Content) {
+				a.Hunks = append(a.Hunks, h.matchingLines(cp.re)...)
+			}
+		}
+		return a
+	}
+	return nil
+}
+
+// attributeFileContent matches the file content patterns against the complete content of the changed file
+func (s *ProjectSegment) attributeFileContent(path string, file *changedFile) *Attribution {
+	if len(s.fileContentPatterns) == 0 {
+		return nil
+	}
+	c, ok := file.newContent()
+	if !ok || (s.MaxContentMatchBytes > 0 && len(c) > s.MaxContentMatchBytes) {
+		return nil
+	}
+	for _, fcp := range s.fileContentPatterns {
+		if !fcp.re.MatchString(c) {
+			continue
+		}
+		file := &Hunk{Operation: diff.Equal, Content: c, Start: 1, End: countLines(c)}
+		return &Attribution{Segment: s.Name, Path: path, Pattern: fcp, Hunks: file.matchingLines(fcp.re)}
+	}
+	return nil
+}
+
+// Reads the blobs of the repository, the repository storage is not safe for concurrent use
+type blobReader struct {
+	repo *git.Repository
+	// git executable reading the blobs if go-git can't open the repository
+	native *nativeGit
+	mu     sync.Mutex
+}
+
+// usesFileContents reports whether any segment has patterns matching the contents of the changed files
+func (c *Config) usesFileContents() bool {
+	for _, s := range c.Segments {
+		if len(s.FileContentPatterns) != 0 || len(s.SymbolPatterns) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newBlobReader returns the blob reader of the repository or nil if the repository is not available
+func newBlobReader(repo *git.Repository) *blobReader {
+	if repo == nil {
+		return nil
+	}
+	return &blobReader{repo: repo}
+}
+
+// fileContent returns the content of the file of a patch
+func (b *blobReader) fileContent(f diff.File) (string, error) {
+	if wf, ok := f.(*worktreeFile); ok {
+		return wf.content, nil
+	}
+	if b.native != nil {
+		return b.native.fileContent(f)
+	}
+	return b.content(f.Hash())
+}
+
+func (b *blobReader) content(hash plumbing.Hash) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	blob, err := b.repo.BlobObject(hash)
+	if err != nil {
+		return "", err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// Lazily loaded contents of a changed text file
+type changedFile struct {
+	blobs   *blobReader
+	patch   diff.FilePatch
+	content *string
+	// Declarations touched by the patch
+	symbols []string
+	parsed  bool
+}
+
+func (b *blobReader) changedFile(p diff.FilePatch) *changedFile {
+	if b == nil || p.IsBinary() {
+		return nil
+	}
+	return &changedFile{blobs: b, patch: p}
+}
+
+// newContent returns the complete content of the changed file or false if the file is deleted or unreadable
+func (f *changedFile) newContent() (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	_, to := f.patch.Files()
+	if to == nil {
+		return "", false
+	}
+	if f.content == nil {
+		c, err := f.blobs.fileContent(to)
+		if err != nil {
+			return "", false
+		}
+		f.content = &c
+	}
+	return *f.content, true
+}
+
+// Segments of a changed file
+type fileAttribution struct {
+	path string
+	// Path before renaming or empty string
+	oldPath string
+	// Number of changed lines
+	lines        int
+	attributions []*Attribution
+	// Attributions dropped in favor of exclusive segments
+	hidden []*Attribution
+}
+
+// attributeFiles matches the file patches against the segments concurrently,
+// the results are in the order of the file patches
+func attributeFiles(c *Config, blobs *blobReader, patches []diff.FilePatch) []*fileAttribution {
+	results := make([]*fileAttribution, len(patches))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	workers := runtime.NumCPU()
+	if workers > len(patches) {
+		workers = len(patches)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = c.cachedAttributeFile(patches[i], blobs)
+			}
+		}()
+	}
+	for i := range patches {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// attributeFile returns the segments of the file patch with the reasons of the attributions
+func (c *Config) attributeFile(p diff.FilePatch, blobs *blobReader) *fileAttribution {
+	file := blobs.changedFile(p)
+	from, to := p.Files()
+	// deletion
+	if to == nil {
+		to = from
+	}
+	f := &fileAttribution{path: to.Path(), lines: changedLines(p)}
+	if from != nil && from.Path() != f.path {
+		f.oldPath = from.Path()
+	}
+	submodule := isSubmodulePatch(p)
+	fileSegments := make(orderedSegmentList, 0)
+	attributions := make(map[string]*Attribution)
+	for sName, s := range c.Segments {
+		a := s.attribute(p, f.path, file)
+		// submodule pointer changes belong to the segments of the files under the submodule path
+		if a == nil && submodule {
+			if fp := s.fileNameMatch(f.path + "/"); fp != nil {
+				a = &Attribution{Segment: s.Name, Path: f.path, Pattern: fp}
+			}
+		}
+		// renamed files belong to the segments of the old path too
+		if a == nil && f.oldPath != "" {
+			if fp := s.fileNameMatch(f.oldPath); fp != nil {
+				a = &Attribution{Segment: s.Name, Path: f.oldPath, Pattern: fp}
+			}
+		}
+		if a != nil {
+			fileSegments = append(fileSegments, s)
+			attributions[sName] = a
+		}
+	}
+	if len(fileSegments) == 0 {
+		for _, s := range c.fallbackSegments() {
+			fileSegments = append(fileSegments, s)
+			attributions[s.Name] = &Attribution{Segment: s.Name, Path: f.path, Pattern: fallbackPattern}
+		}
+	}
+	sort.Sort(fileSegments)
+	visibleSegments := fileSegments
+	if c.Settings.MatchStrategy == matchStrategyClosest {
+		visibleSegments = closestSegments(visibleSegments, func(s *ProjectSegment) int {
+			a := attributions[s.Name]
+			if !a.Pattern.isFileNamePattern() {
+				return -1
+			}
+			return a.Pattern.matchDepth(a.Path)
+		})
+	}
+	visibleSegments = exclusiveSegments(visibleSegments)
+	for _, s := range fileSegments {
+		if visibleSegments.contains(s) {
+			f.attributions = append(f.attributions, attributions[s.Name])
+		} else {
+			f.hidden = append(f.hidden, attributions[s.Name])
+		}
+	}
+	return f
+}
+
+// attributeMessage returns the reason of attributing the commit to the segment or nil
+func (s *ProjectSegment) attributeMessage(c *object.Commit) *Attribution {
+	for _, mp := range s.messagePatterns {
+		if mp.re.MatchString(c.Message) {
+			return &Attribution{Segment: s.Name, Commit: c, Pattern: mp}
+		}
+	}
+	return nil
+}
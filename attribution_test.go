@@ -0,0 +1,49 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestLiteralPattern(t *testing.T) {
+	tests := []struct {
+		expr    string
+		literal string
+		match   literalMatch
+	}{
+		{`main\.go`, "main.go", literalContains},
+		{`^docs/`, "docs/", literalPrefix},
+		{`^docs/.*`, "docs/", literalPrefix},
+		{`^README\.md$`, "README.md", literalExact},
+		{`^docs(/.*)?$`, "docs", literalDirectory},
+		{`.+\.go`, "", literalNone},
+		{`^docs/.+\.md$`, "", literalNone},
+		{`(?i)^docs/`, "", literalNone},
+		{`docs/$`, "", literalNone},
+		{`[`, "", literalNone},
+	}
+	for _, tt := range tests {
+		literal, match := literalPattern(tt.expr)
+		if literal != tt.literal || match != tt.match {
+			t.Errorf("literalPattern(%q) = %q, %d, want %q, %d", tt.expr, literal, match, tt.literal, tt.match)
+		}
+	}
+}
+
+// the literal shortcut must match exactly like the regexp
+func TestPatternMatchString(t *testing.T) {
+	exprs := []string{`main\.go`, `^docs/`, `^README\.md$`, `^docs(/.*)?$`, `.+\.go`}
+	paths := []string{"main.go", "cmd/main.go", "docs", "docs/a.md", "docsa", "README.md", "README.md.bak", "a/README.md"}
+	for _, expr := range exprs {
+		p, err := newPattern("FilePatterns", expr, expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		re := regexp.MustCompile(expr)
+		for _, path := range paths {
+			if got, want := p.MatchString(path), re.MatchString(path); got != want {
+				t.Errorf("pattern %q matching %q = %v, want %v", expr, path, got, want)
+			}
+		}
+	}
+}
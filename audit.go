@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Path of the audit log of the changes made on the forges, no audit log if it's empty
+var auditLogPath string
+
+// auditMu serializes the writes of the concurrent updates to the audit log
+var auditMu sync.Mutex
+
+// auditEntry is a line of the audit log
+type auditEntry struct {
+	Time time.Time `json:"time"`
+	// event triggering the change, e.g. the command or the webhook
+	Event  string `json:"event"`
+	Action string `json:"action"`
+	// pull request, merge request or issue reference, e.g. owner/repo#12 or group/project!12
+	Target string   `json:"target"`
+	Values []string `json:"values,omitempty"`
+}
+
+// audit appends the change to the audit log, failing to write the log doesn't fail the update
+// as the change is already made
+func audit(event, action, target string, values ...string) {
+	if auditLogPath == "" {
+		return
+	}
+	// the comment markers are kept readable, the encoder terminates the line
+	var line bytes.Buffer
+	enc := json.NewEncoder(&line)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(&auditEntry{
+		Time:   time.Now().UTC(),
+		Event:  event,
+		Action: action,
+		Target: target,
+		Values: values,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning! Failed to write audit log: %s\n", err)
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning! Failed to write audit log: %s\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(line.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning! Failed to write audit log: %s\n", err)
+	}
+}
+
+// githubTarget returns the reference of the GitHub pull request or issue
+func githubTarget(owner, repo string, num int) string {
+	return fmt.Sprintf("%s/%s#%d", owner, repo, num)
+}
+
+// gitlabTarget returns the reference of the GitLab merge request or issue
+func gitlabTarget(project, kind string, iid int) string {
+	if kind == "merge_requests" {
+		return fmt.Sprintf("%s!%d", project, iid)
+	}
+	return fmt.Sprintf("%s#%d", project, iid)
+}
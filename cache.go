@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Match result of a changed file in the match cache
+type cachedFile struct {
+	Path         string              `json:"path"`
+	OldPath      string              `json:"old_path"`
+	Lines        int                 `json:"lines"`
+	Attributions []cachedAttribution `json:"attributions"`
+	Hidden       []cachedAttribution `json:"hidden"`
+}
+
+type cachedAttribution struct {
+	Segment string  `json:"segment"`
+	Path    string  `json:"path"`
+	Key     string  `json:"key"`
+	Source  string  `json:"source"`
+	Hunks   []*Hunk `json:"hunks"`
+	Symbol  string  `json:"symbol"`
+}
+
+// Segments of a file of a tree in the match cache
+type cachedTreeFile struct {
+	Path     string   `json:"path"`
+	Segments []string `json:"segments"`
+}
+
+// The match cache keeps at most matchCacheMaxEntries results used in the last matchCacheMaxAge,
+// it's pruned on the first and then on every matchCachePruneInterval stored result
+const (
+	matchCacheMaxEntries    int           = 20000
+	matchCacheMaxAge        time.Duration = 30 * 24 * time.Hour
+	matchCachePruneInterval uint64        = 100
+)
+
+// Number of the stored match results, see matchCachePruneInterval
+var matchCacheSaves uint64
+
+// Guards the lazily computed fingerprint of the configs, the files are matched concurrently
+var fingerprintMu sync.Mutex
+
+func matchCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "chiefr", "matches"), nil
+}
+
+// matchCacheKey returns the cache key of the parts matched against the current segments and settings,
+// modifying the maintainers file invalidates the cached results
+func (c *Config) matchCacheKey(parts ...string) string {
+	h := sha1.New()
+	h.Write([]byte(c.getFingerprint()))
+	for _, p := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(p))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// getFingerprint returns the hash of the segments and of the settings, the settings are hashed
+// entirely so a new setting changing the matching can't be left out of it
+func (c *Config) getFingerprint() string {
+	fingerprintMu.Lock()
+	defer fingerprintMu.Unlock()
+	if c.fingerprint == "" {
+		config, _ := json.Marshal(struct {
+			Settings Settings
+			Segments orderedSegmentList
+		}{c.Settings, sortedSegments(c.Segments)})
+		c.fingerprint = fmt.Sprintf("%x", sha1.Sum(append([]byte(VERSION), config...)))
+	}
+	return c.fingerprint
+}
+
+// loadMatchCache reads the cached value of the key, returns false if the cache is disabled or the key is missing
+func (c *Config) loadMatchCache(key string, v interface{}) bool {
+	if c.matchCache == "" {
+		return false
+	}
+	path := filepath.Join(c.matchCache, key+".json")
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if json.Unmarshal(content, v) != nil {
+		return false
+	}
+	touchCacheEntry(path)
+	return true
+}
+
+// touchCacheEntry sets the modification time of the cache entry, it's the last use of the entry, see pruneCacheDir
+func touchCacheEntry(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// saveMatchCache stores the value of the key, errors are ignored because the cache is optional
+func (c *Config) saveMatchCache(key string, v interface{}) {
+	if c.matchCache == "" {
+		return
+	}
+	content, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	w := c.newMatchCacheWriter(key + ".json")
+	if w.file == nil {
+		return
+	}
+	_, w.err = w.out.Write(content)
+	w.close()
+}
+
+func newCachedAttributions(attributions []*Attribution) []cachedAttribution {
+	cached := make([]cachedAttribution, 0, len(attributions))
+	for _, a := range attributions {
+		cached = append(cached, cachedAttribution{
+			Segment: a.Segment,
+			Path:    a.Path,
+			Key:     a.Pattern.key,
+			Source:  a.Pattern.source,
+			Hunks:   a.Hunks,
+			Symbol:  a.Symbol,
+		})
+	}
+	return cached
+}
+
+// cachedAttributions restores the cached attributions, returns false if a segment or pattern no longer exists
+func (c *Config) cachedAttributions(cached []cachedAttribution) ([]*Attribution, bool) {
+	attributions := make([]*Attribution, 0, len(cached))
+	for _, ca := range cached {
+		s, found := c.Segments[ca.Segment]
+		if !found {
+			return nil, false
+		}
+		p := s.findPattern(ca.Key, ca.Source)
+		if p == nil {
+			return nil, false
+		}
+		attributions = append(attributions, &Attribution{Segment: ca.Segment, Path: ca.Path, Pattern: p, Hunks: ca.Hunks, Symbol: ca.Symbol})
+	}
+	return attributions, true
+}
+
+// findPattern returns the compiled pattern of the segment or nil
+func (s *ProjectSegment) findPattern(key, source string) *pattern {
+	if key == fallbackPattern.key && s.Fallback {
+		return fallbackPattern
+	}
+	for _, patterns := range [][]*pattern{s.filePatterns, s.contentPatterns, s.fileContentPatterns, s.symbolPatterns, s.binaryPatterns} {
+		for _, p := range patterns {
+			if p.key == key && p.source == source {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// filePatchKey identifies the file patch by the paths and blob hashes of its files
+func filePatchKey(p diff.FilePatch) []string {
+	key := []string{"file"}
+	from, to := p.Files()
+	for _, f := range []diff.File{from, to} {
+		if f == nil {
+			key = append(key, "", "")
+			continue
+		}
+		key = append(key, f.Path(), f.Hash().String())
+	}
+	return key
+}
+
+// cachedAttributeFile returns the cached segments of the file patch or matches and caches them
+func (c *Config) cachedAttributeFile(p diff.FilePatch, blobs *blobReader) *fileAttribution {
+	if c.matchCache == "" {
+		return c.attributeFile(p, blobs)
+	}
+	key := c.matchCacheKey(filePatchKey(p)...)
+	cached := &cachedFile{}
+	if c.loadMatchCache(key, cached) {
+		attributions, ok := c.cachedAttributions(cached.Attributions)
+		hidden, hiddenOk := c.cachedAttributions(cached.Hidden)
+		if ok && hiddenOk {
+			return &fileAttribution{path: cached.Path, oldPath: cached.OldPath, lines: cached.Lines, attributions: attributions, hidden: hidden}
+		}
+	}
+	f := c.attributeFile(p, blobs)
+	c.saveMatchCache(key, &cachedFile{
+		Path:         f.path,
+		OldPath:      f.oldPath,
+		Lines:        f.lines,
+		Attributions: newCachedAttributions(f.attributions),
+		Hidden:       newCachedAttributions(f.hidden),
+	})
+	return f
+}
+
+// walkTreeSegments calls fn with the segments of every file of the tree under the path prefix,
+// the files are streamed from the tree and the match cache, which stores them line by line
+func (c *Config) walkTreeSegments(tree *object.Tree, prefix string, fn func(cachedTreeFile)) error {
+	key := c.matchCacheKey("tree", tree.Hash.String(), prefix)
+	if c.matchCache != "" {
+		path := filepath.Join(c.matchCache, key+".jsonl")
+		if f, err := os.Open(path); err == nil {
+			defer f.Close()
+			touchCacheEntry(path)
+			dec := json.NewDecoder(bufio.NewReader(f))
+			for {
+				var file cachedTreeFile
+				err := dec.Decode(&file)
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("Failed to read match cache: %s", err)
+				}
+				fn(file)
+			}
+		}
+	}
+	// only the subtree of the directory of the prefix is traversed
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i != -1 {
+		dir = prefix[:i]
+	}
+	if dir != "" {
+		subtree, err := tree.Tree(dir)
+		if err == object.ErrDirectoryNotFound {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to list files of repository: %s", err)
+		}
+		tree = subtree
+		dir += "/"
+	}
+	cw := c.newMatchCacheWriter(key + ".jsonl")
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cw.abort()
+			return fmt.Errorf("Failed to list files of repository: %s", err)
+		}
+		path := dir + name
+		if !entry.Mode.IsFile() || !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		segments := make([]string, 0)
+		for _, s := range c.fileNameSegments(path) {
+			segments = append(segments, s.Name)
+		}
+		file := cachedTreeFile{Path: path, Segments: segments}
+		cw.write(file)
+		fn(file)
+	}
+	cw.close()
+	return nil
+}
+
+// Streaming writer of a match cache entry, the entry is stored only if it is closed without errors
+type matchCacheWriter struct {
+	file *os.File
+	out  *bufio.Writer
+	enc  *json.Encoder
+	path string
+	dir  string
+	err  error
+}
+
+// newMatchCacheWriter returns the writer of the cache entry, errors are ignored because the cache is optional
+func (c *Config) newMatchCacheWriter(name string) *matchCacheWriter {
+	w := &matchCacheWriter{}
+	if c.matchCache == "" {
+		return w
+	}
+	if w.err = os.MkdirAll(c.matchCache, 0755); w.err != nil {
+		return w
+	}
+	w.path = filepath.Join(c.matchCache, name)
+	w.dir = c.matchCache
+	w.file, w.err = ioutil.TempFile(c.matchCache, cacheTempPrefix)
+	if w.err != nil {
+		return w
+	}
+	w.out = bufio.NewWriter(w.file)
+	w.enc = json.NewEncoder(w.out)
+	return w
+}
+
+func (w *matchCacheWriter) write(v interface{}) {
+	if w.file == nil || w.err != nil {
+		return
+	}
+	w.err = w.enc.Encode(v)
+}
+
+// abort drops the partially written cache entry
+func (w *matchCacheWriter) abort() {
+	if w.file == nil {
+		return
+	}
+	w.file.Close()
+	os.Remove(w.file.Name())
+	w.file = nil
+}
+
+// close stores the cache entry and prunes the cache periodically
+func (w *matchCacheWriter) close() {
+	if w.file == nil {
+		return
+	}
+	if w.err == nil {
+		w.err = w.out.Flush()
+	}
+	if err := w.file.Close(); w.err == nil {
+		w.err = err
+	}
+	if w.err != nil {
+		os.Remove(w.file.Name())
+		return
+	}
+	if os.Rename(w.file.Name(), w.path) != nil {
+		os.Remove(w.file.Name())
+		return
+	}
+	if atomic.AddUint64(&matchCacheSaves, 1)%matchCachePruneInterval == 1 {
+		pruneCacheDir(w.dir, time.Now(), matchCacheMaxEntries, matchCacheMaxAge)
+	}
+}
@@ -1,29 +1,47 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/go-ini/ini"
 	"github.com/google/go-github/github"
 	"github.com/jawher/mow.cli"
 	"golang.org/x/oauth2"
+	"gopkg.in/src-d/go-billy.v4/osfs"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
 	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
 )
 
 const VERSION string = "0.1.0"
 
+// Current schema version of the maintainers file
+const configVersion int = 2
+
+// Well-known maintainers file locations in lookup order
+var maintainersFileLocations = []string{
+	".maintainers.ini",
+	".github/maintainers.ini",
+	"docs/MAINTAINERS.ini",
+}
+
 // Describe a project segment and its members and resources
 // ProjectSegment can be any logical piece of a project
 type ProjectSegment struct {
@@ -47,23 +65,271 @@ type ProjectSegment struct {
 	ContentPatterns []string
 	// List of regexps to exclude files matched by FilePatterns regex
 	FileExcludePatterns []string
+	// List of gitignore style globs to specify which file to include in this Segment, globs starting with '!' exclude files
+	FileGlobs []string
+	// Compiled file and content patterns
+	filePatterns           []*pattern
+	fileExcludePatterns    []*pattern
+	contentPatterns        []*pattern
+	fileContentPatterns    []*pattern
+	symbolPatterns         []*pattern
+	contentExcludePatterns []*pattern
+	messagePatterns        []*pattern
+	binaryPatterns         []*pattern
+	// List of regexps to match against the complete content of the changed files
+	FileContentPatterns []string
+	// List of regexps to match against the changed declarations of Go files (e.g. pkg.Func, pkg.Type.Method)
+	SymbolPatterns []string
 	// List of regexps to exclude patch content matched by `ContentPatterns`
 	ContentExcludePatterns []string
+	// Match content patterns only against added and removed lines, not against the unchanged context
+	ContentChangesOnly bool
+	// List of regexps to specify which commit messages should be included in this Segment
+	MessagePatterns []string
+	// List of regexps to specify which binary files to include in this Segment
+	BinaryPatterns []string
+	// Skip content matching of file patches larger than this limit in bytes, 0 means no limit
+	MaxContentMatchBytes int
+	// Match all patterns case-insensitively
+	CaseInsensitive bool
+	// File patterns must match the whole path
+	AnchorPatterns bool
+	// Files matching this Segment are not attributed to lower priority segments
+	Exclusive bool
+	// Claim the files not matching any other segment
+	Fallback bool
 	// If a changeset affects multiple segments, priority can describe the order of segments listed
 	Priority int
 	// Comma separated list of segment's topics
 	Topics []string
+	// URL of the forum for usage questions
+	Forum string
+	// URL of the contribution guide of the segment
+	Contributing string
+	// Title of the milestone of the segment's pull requests
+	Milestone string
+	// URL of the GitHub project (e.g. https://github.com/orgs/ORG/projects/1) of the segment's pull requests
+	Project string
+	// Status of the segment's pull requests added to the project
+	ProjectStatus string
+	// Comma separated list of Stack Overflow tags for usage questions
+	QATags []string
+	// List of pattern=weight pairs to weight the changed lines attributed by the patterns, the default weight is 1
+	PatternWeights []string
+	patternWeights map[string]float64
+	// Name of the section to inherit unset properties from
+	Extends string
+	// Pull request assignment strategy of the segment, overrides the global AssignStrategy setting
+	AssignStrategy string
+	// Maximum number of the segment's chiefs assigned to a pull request, 0 means no limit
+	MaxAssignees int
+	// Maximum number of the segment's labels applied to a pull request, 0 means no limit
+	MaxLabels int
+	// Number of approvals required from the segment's chiefs or reviewers, see verify-approvals
+	RequiredApprovals int
+	// Evaluate the segment on pull requests without applying its assignments
+	Shadow bool
+	// Last day (YYYY-MM-DD) of the shadow trial period
+	ShadowUntil string
+	shadowUntil time.Time
 }
 
 type ProjectSegments map[string]*ProjectSegment
 
+// Global settings of the project, defined in the [chiefr] section of the maintainers file
+type Settings struct {
+	// Schema version of the maintainers file
+	Version int
+	// Pull request labeling strategy: "topics" applies the topics of every matching segment,
+	// "segment" applies only the name of every matching segment
+	LabelStrategy string
+	// Segment ranking strategy: "priority" orders the segments of patches by priority,
+	// "score" by the weighted number of changed lines attributed to them
+	RankStrategy string
+	// File matching strategy: "all" attributes files to every matching segment,
+	// "closest" only to the segments matching the deepest directory of the file
+	MatchStrategy string
+	// Prefix of the pull request labels (e.g. "segment/"), label groups match the labels without the prefix
+	LabelPrefix string
+	// Comma separated list of label prefixes where only the label of the highest priority segment is applied
+	LabelGroups []string
+	// Comma separated list of LABEL=MAX_LINES size labels applied by the number of changed lines
+	SizeLabels []string
+	sizeLabels []sizeLabel
+	// URL of the issue where the assignments of shadow segments are reported
+	ShadowIssue string
+	// Path or URL of the organization maintainers file loaded under the repository maintainers file
+	Organization string
+	// Branch of the fork point of patches if no revision is specified, detected if empty
+	BaseBranch string
+	// Attribute the changes of submodules to the segments of their own maintainers files
+	RecurseSubmodules bool
+	// Comment the matching segments and their contacts on pull requests once
+	SummaryComment bool
+	// Apply the Chiefr-Segment and Chiefr-Exclude directives of pull request descriptions
+	Directives bool
+	// Don't assign or request reviews from the users whose GitHub status is busy
+	BusyStatus bool
+	// Directory of the comment templates (summary.md, close.md, shadow.md)
+	CommentTemplates string
+	// Pull request assignment strategy: "all" assigns every chief of the matching segments,
+	// "round-robin" rotates through the chiefs of every matching segment across pull requests
+	AssignStrategy string
+	// Maximum number of assignees of a pull request, GitHub accepts at most 10
+	MaxAssignees int
+	// Maximum number of labels applied to a pull request, 0 means no limit
+	MaxLabels int
+	// Number of approvals required from the chiefs or reviewers of every matching segment, 1 if not set
+	RequiredApprovals int
+	// Merge method of verify-approvals --merge: "merge", "squash" or "rebase"
+	MergeMethod string
+	// Action on pull requests belonging to other repositories with update-pull-request --close:
+	// "close" comments and closes them, "comment" only comments where to submit them
+	WrongRepositoryAction string
+	// Repositories suggested to the pull requests of other repositories: "first" the repository of
+	// the highest ranked segment, "all" the repositories of every matching segment
+	SuggestRepositories string
+	// Draft pull request policy: "assign" handles drafts like other pull requests, "label" only labels
+	// them until they are ready for review, "skip" ignores them
+	DraftPolicy string
+}
+
 type Config struct {
+	Settings Settings
 	Segments ProjectSegments
+	// Segments on shadow trial
+	ShadowSegments ProjectSegments
+	// Maintainers files of the sibling repositories indexed by repository URL,
+	// defined in the [chiefr.repositories] section
+	Repositories map[string]string
+	// Members of the teams defined in the [chiefr.teams] section
+	Teams map[string][]string
+	// Color and description of the labels created by chiefr, defined in the [chiefr.labels] section
+	Labels map[string]*labelStyle
+	// Comment templates defined in the [chiefr.comments] section
+	CommentTemplates map[string]string
+	// Parsed comment templates indexed by name
+	commentTemplates map[string]*template.Template
+	// Last day of the users opted out of the automatic assignment, zero if indefinite,
+	// defined in the [chiefr.unavailable] section
+	Unavailable map[string]time.Time
+	// Load remote maintainers files from cache
+	offline bool
+	// Directory of the match result cache, empty if caching is disabled
+	matchCache string
+	// Hash of the segments to invalidate the cached match results
+	fingerprint string
+	// Use the git executable instead of go-git for diff and log operations
+	nativeGit bool
+	// Path of the chief rotation state file of the round-robin assignment strategy
+	rotationState string
+}
+
+const (
+	settingsSection     string = "chiefr"
+	repositoriesSection string = "chiefr.repositories"
+	teamsSection        string = "chiefr.teams"
+	labelsSection       string = "chiefr.labels"
+	commentsSection     string = "chiefr.comments"
+	unavailableSection  string = "chiefr.unavailable"
+)
+
+const (
+	labelStrategyTopics  string = "topics"
+	labelStrategySegment string = "segment"
+)
+
+const (
+	rankStrategyPriority string = "priority"
+	rankStrategyScore    string = "score"
+)
+
+const (
+	wrongRepositoryClose   string = "close"
+	wrongRepositoryComment string = "comment"
+)
+
+const (
+	suggestFirstRepository string = "first"
+	suggestAllRepositories string = "all"
+)
+
+// Reasons of locking the conversation of GitHub issues and pull requests
+const (
+	lockReasonOffTopic  string = "off-topic"
+	lockReasonTooHeated string = "too heated"
+	lockReasonResolved  string = "resolved"
+	lockReasonSpam      string = "spam"
+)
+
+func validLockReason(reason string) bool {
+	switch reason {
+	case lockReasonOffTopic, lockReasonTooHeated, lockReasonResolved, lockReasonSpam:
+		return true
+	}
+	return false
 }
 
+const (
+	draftPolicyAssign string = "assign"
+	draftPolicyLabel  string = "label"
+	draftPolicySkip   string = "skip"
+)
+
+const (
+	matchStrategyAll     string = "all"
+	matchStrategyClosest string = "closest"
+)
+
 type ProjectManager interface {
 	SetAPIKey(key string)
-	HandlePullRequest(pullRequestURL string, segments ProjectSegments, close bool) error
+	// SetDryRun makes the manager print the changes instead of applying them
+	SetDryRun(dryRun bool)
+	// SetSync makes the manager remove the labels, assignees and review requests it applied which don't match anymore
+	SetSync(sync bool)
+	// SetLockReason makes the manager lock the conversation of the closed pull requests with the reason
+	SetLockReason(reason string)
+	// HandlePullRequest assigns the pull request to the ranked segments, the extra labels are applied besides
+	// the labels of the segments
+	HandlePullRequest(pullRequestURL string, c *Config, segments orderedSegmentList, extraLabels []string, close bool) error
+	// CommentIssue comments on the issue, the previous comment with the same hidden marker is updated instead
+	CommentIssue(issueURL, marker, comment string) error
+	// PullRequestRefs returns the fetchable refs of the head and the base branch of the pull request
+	PullRequestRefs(pullRequestURL string) (*pullRequestRefs, error)
+	// PublishCheckRun reports the ownership of the pull request as a check run of its head commit
+	PublishCheckRun(pullRequestURL string, report *ownershipReport) error
+	// PullRequestApprovals returns the users whose latest review approved the pull request
+	PullRequestApprovals(pullRequestURL string) ([]string, error)
+	// PullRequestAuthor returns the author of the pull request
+	PullRequestAuthor(pullRequestURL string) (string, error)
+	// ExpandTeams replaces the team references of the users with the members of the teams
+	ExpandTeams(users []string) ([]string, error)
+	// MergePullRequest merges the pull request if its checks passed, or enables the auto-merge of the forge
+	MergePullRequest(pullRequestURL, method string, auto bool) error
+	// PublishCommitStatus reports the ownership of the pull request as a commit status of its head commit
+	PublishCommitStatus(pullRequestURL string, report *ownershipReport) error
+	// PullRequestDescription returns the description of the pull request
+	PullRequestDescription(pullRequestURL string) (string, error)
+	// OpenPullRequests returns the URLs of the open pull requests of the repository
+	OpenPullRequests(repositoryURL string) ([]string, error)
+	// Issue returns the title, the body and the author of the issue
+	Issue(issueURL string) (*issueContent, error)
+	// HandleIssue labels the issue and assigns the chiefs of the segments except its author
+	HandleIssue(issueURL string, c *Config, segments orderedSegmentList, issue *issueContent) error
+	// SetExcludedUsers makes the manager skip the users when assigning and requesting reviews
+	SetExcludedUsers(users []string)
+	// PullRequestAssignees returns the assignees of the pull request
+	PullRequestAssignees(pullRequestURL string) ([]string, error)
+	// RemoveAssignees unassigns the users from the pull request and removes their review requests
+	RemoveAssignees(pullRequestURL string, users []string) error
+	// RepositoryFile returns the content of the file of the repository's default branch, nil if it doesn't exist
+	RepositoryFile(repositoryURL, path string) ([]byte, error)
+	// SetEvent sets the event triggering the changes of the manager, see audit
+	SetEvent(event string)
+	// PullRequestState returns what chiefr recorded in the hidden state comment of the pull request
+	PullRequestState(pullRequestURL string) (*pullRequestState, error)
+	// SavePullRequestState records the state in the hidden state comment of the pull request
+	SavePullRequestState(pullRequestURL string, state *pullRequestState) error
 }
 
 func getProjectManagerFromURL(u string) (ProjectManager, error) {
@@ -74,88 +340,134 @@ func getProjectManagerFromURL(u string) (ProjectManager, error) {
 	if parsedURL.Host == "github.com" {
 		return &GitHubManager{}, nil
 	}
+	if isGitLabURL(parsedURL) {
+		return &GitLabManager{}, nil
+	}
 	return nil, fmt.Errorf("Cannot find project manager handler for url '%s'", u)
 }
 
 type GitHubManager struct {
 	APIKey string
+	DryRun bool
+	Sync   bool
+	// Reason of locking the closed pull requests, empty if they aren't locked
+	LockReason string
+	// Number of open pull requests of the users, see openPullRequests
+	loads map[string]int
+	// Users whose GitHub status indicates limited availability, see busy
+	busyUsers map[string]bool
+	// Users not assigned or requested to review, see skipUser
+	excludedUsers []string
+	// Event triggering the changes, see audit
+	event string
+	// Login of the authenticated user, see botLogin
+	login string
 }
 
 func (g *GitHubManager) SetAPIKey(key string) {
 	g.APIKey = key
 }
 
+func (g *GitHubManager) SetDryRun(dryRun bool) {
+	g.DryRun = dryRun
+}
+
+func (g *GitHubManager) SetSync(sync bool) {
+	g.Sync = sync
+}
+
+func (g *GitHubManager) SetLockReason(reason string) {
+	g.LockReason = reason
+}
+
+func (g *GitHubManager) SetExcludedUsers(users []string) {
+	g.excludedUsers = users
+}
+
+func (g *GitHubManager) SetEvent(event string) {
+	g.event = event
+}
+
 var githubAPIRepoURL string = "https://api.github.com/repos/"
 
-func (g *GitHubManager) HandlePullRequest(u string, segments ProjectSegments, close bool) error {
+var stackOverflowTagURL string = "https://stackoverflow.com/questions/tagged/"
+
+func (g *GitHubManager) HandlePullRequest(u string, c *Config, os orderedSegmentList, extraLabels []string, close bool) error {
 	// https://developer.github.com/v3/issues/assignees/#add-assignees-to-an-issue
 	// https://developer.github.com/v3/issues/labels/#add-labels-to-an-issue
-	if len(segments) == 0 {
+	// https://developer.github.com/v3/pulls/review_requests/#create-a-review-request
+	if len(os) == 0 {
 		return fmt.Errorf("No matching segments found for this patch. Please edit your maintainers file")
 	}
-	os := make(orderedSegmentList, 0, len(segments))
-	for _, s := range segments {
-		os = append(os, s)
-	}
-	sort.Sort(os)
 	URL, err := url.Parse(u)
 	if err != nil {
 		return fmt.Errorf("Failed to parse pull request URL: %s", err)
 	}
-	prTopics := make([]string, 0)
+	prTopics := c.Settings.getLabels(os)
+	for _, l := range extraLabels {
+		appendNew(&prTopics, l)
+	}
 	prChiefs := make([]string, 0)
-	// TODO reviewers
+	prReviewers := make([]string, 0)
 	repoURL := ""
-	for _, s := range segments {
+	for _, s := range os {
 		if repoURL == "" && strings.HasPrefix(u, s.Repository) {
 			repoURL = s.Repository
 		}
-		for _, t := range s.Topics {
-			appendNew(&prTopics, t)
+		for _, chief := range s.Chiefs {
+			appendNew(&prChiefs, chief)
 		}
-		for _, c := range s.Chiefs {
-			appendNew(&prChiefs, c)
+		for _, reviewer := range s.Reviewers {
+			appendNew(&prReviewers, reviewer)
 		}
 	}
 	if len(prChiefs) == 0 {
 		return errors.New("Chiefs not found for this pull request")
 	}
-	pathParts := strings.Split(URL.Path, "/")
-	if len(pathParts) != 5 || pathParts[3] != "pull" || pathParts[1] == "" || pathParts[2] == "" {
-		return errors.New("Invalid pull request URL")
-	}
-	user := pathParts[1]
-	repo := pathParts[2]
-	prNum, err := strconv.Atoi(pathParts[4])
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
 	if err != nil {
 		return errors.New("Invalid pull request URL")
 	}
 	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: g.APIKey},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-
-	client := github.NewClient(tc)
+	client := g.client(ctx)
 	if repoURL == "" {
 		if !close {
 			return errors.New("No repository found for this pull request")
 		}
-		comment := fmt.Sprintf(
-			"Hello!\nThis repository is not responsible for the changes you submitted. Submit your patch to %s",
-			os[0].Repository,
-		)
-		_, _, err = client.Issues.CreateComment(
-			ctx,
-			user,
-			repo,
-			prNum,
-			&github.IssueComment{
-				Body: &comment,
-			},
-		)
+		// placeholders are shown in dry-run mode instead of the author and the branch of the pull request
+		author, branch := "USER", "BRANCH"
+		if !g.DryRun {
+			pr, err := g.pullRequest(ctx, client, user, repo, prNum)
+			if err != nil {
+				return err
+			}
+			author, branch = pr.GetUser().GetLogin(), pr.GetHead().GetRef()
+		}
+		repositories := c.suggestedRepositories(os)
+		comment, err := c.renderComment(closeCommentTemplate, &commentData{
+			PullRequest:  u,
+			Segments:     os,
+			Repository:   os[0].Repository,
+			Repositories: repositories,
+			Transfers:    transfers(repositories, author, branch),
+		})
 		if err != nil {
-			return fmt.Errorf("Failed to create comment for pull request: %s", err)
+			return err
+		}
+		commentOnly := c.Settings.WrongRepositoryAction == wrongRepositoryComment
+		if g.DryRun {
+			fmt.Printf("Would comment on %s:\n%s\n", u, comment)
+			if !commentOnly {
+				fmt.Printf("Would close %s\n", u)
+				if g.LockReason != "" {
+					fmt.Printf("Would lock %s as %s\n", u, g.LockReason)
+				}
+			}
+			return nil
+		}
+		err = g.upsertComment(ctx, client, user, repo, prNum, closeCommentMarker, comment)
+		if err != nil || commentOnly {
+			return err
 		}
 		closed := "closed"
 		_, _, err = client.PullRequests.Edit(
@@ -170,244 +482,2556 @@ func (g *GitHubManager) HandlePullRequest(u string, segments ProjectSegments, cl
 		if err != nil {
 			return fmt.Errorf("Failed to close pull request: %s", err)
 		}
+		audit(g.event, "close", githubTarget(user, repo, prNum))
+		if g.LockReason != "" {
+			_, err = client.Issues.Lock(ctx, user, repo, prNum, &github.LockIssueOptions{LockReason: g.LockReason})
+			if err != nil {
+				return fmt.Errorf("Failed to lock pull request: %s", err)
+			}
+			audit(g.event, "lock", githubTarget(user, repo, prNum), g.LockReason)
+		}
 		return nil
 	}
 
-	_, _, err = client.Issues.AddLabelsToIssue(ctx, user, repo, prNum, prTopics)
+	// GitHub rejects review requests from the author of the pull request
+	author := ""
+	var pr *githubPullRequest
+	// the GraphQL API fetches the pull request with the labels of the repository and updates it in one mutation
+	var gpr *graphqlPullRequest
+	if !g.DryRun {
+		if githubAPI == githubAPIGraphQL {
+			gpr, err = g.pullRequestGraphQL(ctx, user, repo, prNum)
+			if gpr != nil {
+				pr = gpr.githubPullRequest
+			}
+		} else {
+			pr, err = g.pullRequest(ctx, client, user, repo, prNum)
+		}
+		if err != nil {
+			return err
+		}
+		author = pr.GetUser().GetLogin()
+		if pr.Draft && c.Settings.DraftPolicy == draftPolicySkip {
+			fmt.Printf("Skipping draft pull request %s\n", u)
+			return nil
+		}
+	}
+	// assignees and reviewers of draft pull requests are deferred until they are ready for review
+	deferAssignment := pr != nil && pr.Draft && c.Settings.DraftPolicy == draftPolicyLabel
+	rotation := make(rotationState)
+	roundRobin := c.usesAssignStrategy(os, assignStrategyRoundRobin)
+	if roundRobin {
+		unlock, err := lockRotationState(c.rotationState)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		rotation, err = loadRotationState(c.rotationState)
+		if err != nil {
+			return err
+		}
+	}
+	history, err := c.assignmentHistory(os)
 	if err != nil {
-		return fmt.Errorf("Failed to add labels to pull request: %s", err)
+		return err
+	}
+	assigned := make([]string, 0)
+	if pr != nil {
+		for _, a := range pr.Assignees {
+			assigned = append(assigned, a.GetLogin())
+		}
+	}
+	skip := g.skipUser(c, author)
+	prChiefs, err = c.selectChiefs(repoURL, os, skip, rotation, history, assigned, func(login string) (int, error) {
+		// the load of GitHub teams isn't counted, in dry-run mode the first chief is selected
+		if g.DryRun || strings.HasPrefix(login, "@") {
+			return 0, nil
+		}
+		return g.openPullRequests(ctx, client, user, repo, login)
+	})
+	if err != nil {
+		return err
+	}
+	// teams of the repository's organization are requested to review as a team,
+	// assignees can only be users, so the other teams are resolved to their members
+	prChiefs, chiefTeams := splitTeamReviewers(user, prChiefs)
+	prReviewers, prTeams := splitTeamReviewers(user, prReviewers)
+	for _, t := range chiefTeams {
+		appendNew(&prTeams, t)
+	}
+	if g.DryRun {
+		fmt.Printf("Would add labels to %s: %s\n", u, strings.Join(prTopics, ", "))
+		if len(prChiefs) != 0 {
+			fmt.Printf("Would add assignees to %s: %s\n", u, strings.Join(prChiefs, ", "))
+		}
+		if len(prReviewers) != 0 {
+			fmt.Printf("Would request reviews on %s from: %s\n", u, strings.Join(prReviewers, ", "))
+		}
+		if len(prTeams) != 0 {
+			fmt.Printf("Would request team reviews on %s from: %s\n", u, strings.Join(prTeams, ", "))
+		}
+		if c.Settings.SummaryComment {
+			summary, err := c.renderComment(summaryCommentTemplate, &commentData{PullRequest: u, Segments: os})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Would comment on %s:\n%s\n", u, summary)
+		}
+		if milestone := segmentMilestone(os); milestone != "" {
+			fmt.Printf("Would set the milestone of %s unless it has one: %s\n", u, milestone)
+		}
+		for _, s := range os {
+			if s.Project != "" {
+				fmt.Printf("Would add %s to project %s %s\n", u, s.Project, s.ProjectStatus)
+			}
+		}
+		if c.Settings.DraftPolicy != draftPolicyAssign {
+			fmt.Printf("Would apply the '%s' draft policy if %s is a draft\n", c.Settings.DraftPolicy, u)
+		}
+		if len(c.Settings.sizeLabels) != 0 {
+			fmt.Printf("Would remove the outdated size labels of %s\n", u)
+		}
+		if g.Sync {
+			fmt.Printf("Would remove the labels, assignees and review requests applied by chiefr which don't match %s anymore\n", u)
+		}
+		return nil
+	}
+	// the milestone of the users is kept, a missing milestone is reported before changing the pull request
+	milestoneTitle, milestone := "", 0
+	if pr.Milestone == nil {
+		milestoneTitle = segmentMilestone(os)
+	}
+	if milestoneTitle != "" {
+		milestone, err = g.findMilestone(ctx, client, user, repo, milestoneTitle)
+		if err != nil {
+			return err
+		}
+	}
+	if gpr == nil {
+		err = g.addLabels(ctx, client, user, repo, prNum, c, prTopics)
+		if err != nil {
+			return err
+		}
+	}
+	if err := g.removeSizeLabels(ctx, client, user, repo, pr, c, prTopics); err != nil {
+		return err
+	}
+	if deferAssignment {
+		fmt.Printf("Deferring the assignment of draft pull request %s\n", u)
+		prChiefs, prReviewers, prTeams = nil, nil, nil
+		roundRobin = false
+	}
+	// chiefs and reviewers without access to the repository are mentioned instead
+	mentions := make([]string, 0)
+	if len(prChiefs) != 0 {
+		prChiefs, err = g.resolveTeams(ctx, client, prChiefs)
+		if err != nil {
+			return err
+		}
+		var outsiders []string
+		prChiefs, outsiders, err = g.splitAssignable(ctx, client, user, repo, removeUsers(prChiefs, skip))
+		if err != nil {
+			return err
+		}
+		mentions = append(mentions, outsiders...)
+		if len(prChiefs) > c.Settings.MaxAssignees {
+			prChiefs = prChiefs[:c.Settings.MaxAssignees]
+		}
+	}
+	if len(prReviewers) != 0 {
+		prReviewers, err = g.resolveTeams(ctx, client, prReviewers)
+		if err != nil {
+			return err
+		}
+		var outsiders []string
+		prReviewers, outsiders, err = g.splitAssignable(ctx, client, user, repo, removeUsers(prReviewers, skip))
+		if err != nil {
+			return err
+		}
+		for _, o := range outsiders {
+			appendNew(&mentions, o)
+		}
+	}
+	if gpr != nil {
+		err = g.updatePullRequestGraphQL(ctx, client, user, repo, gpr, c, prTopics, prChiefs, prReviewers, prTeams)
+		if err != nil {
+			return err
+		}
+	} else if len(prChiefs) != 0 {
+		_, _, err = client.Issues.AddAssignees(ctx, user, repo, prNum, prChiefs)
+		if err != nil {
+			return fmt.Errorf("Failed to add assignees to pull request: %s", err)
+		}
+		audit(g.event, "add-assignees", githubTarget(user, repo, prNum), prChiefs...)
+	}
+	if err := c.recordAssignments(repoURL, u, prChiefs); err != nil {
+		return err
+	}
+	g.addLoad(newValues(assigned, prChiefs))
+	g.addLoad(newValues(pr.state().Reviewers, prReviewers))
+	if roundRobin && !g.DryRun {
+		if err := rotation.save(c.rotationState); err != nil {
+			return err
+		}
+	}
+	if gpr == nil {
+		err = g.requestReviewers(ctx, client, user, repo, prNum, prReviewers, prTeams, skip)
+		if err != nil {
+			return err
+		}
+	}
+	if len(mentions) != 0 {
+		err = g.mentionUsers(ctx, client, user, repo, prNum, u, c, os, mentions)
+		if err != nil {
+			return err
+		}
+	}
+	if milestone != 0 {
+		err = g.setMilestone(ctx, client, user, repo, prNum, milestone, milestoneTitle)
+		if err != nil {
+			return err
+		}
 	}
-	_, _, err = client.Issues.AddAssignees(ctx, user, repo, prNum, prChiefs)
+	err = g.addToProjects(ctx, &pr.PullRequest, os)
 	if err != nil {
-		return fmt.Errorf("Failed to add assignees to pull request: %s", err)
+		return err
+	}
+	if g.Sync {
+		present := pr.state()
+		wanted := &pullRequestState{Labels: prTopics, Assignees: prChiefs, Reviewers: prReviewers, Teams: prTeams}
+		for chief := range c.managedChiefs(os) {
+			wanted.Assignees = append(wanted.Assignees, chief)
+		}
+		// the assignees and review requests of deferred drafts are kept until they are ready for review
+		if deferAssignment {
+			wanted.Assignees, wanted.Reviewers, wanted.Teams = present.Assignees, present.Reviewers, present.Teams
+		}
+		applied := &pullRequestState{
+			Labels:    newValues(present.Labels, prTopics),
+			Assignees: newValues(present.Assignees, prChiefs),
+			Reviewers: newValues(present.Reviewers, prReviewers),
+			Teams:     newValues(present.Teams, prTeams),
+		}
+		err = g.removeStale(ctx, client, user, repo, pr, wanted, applied)
+		if err != nil {
+			return err
+		}
+	}
+	if c.Settings.SummaryComment {
+		summary, err := c.renderComment(summaryCommentTemplate, &commentData{PullRequest: u, Segments: os})
+		if err != nil {
+			return err
+		}
+		return g.upsertComment(ctx, client, user, repo, prNum, summaryCommentMarker, summary)
 	}
 	return nil
 }
 
-type orderedSegmentList []*ProjectSegment
+func (g *GitHubManager) PublishCheckRun(u string, report *ownershipReport) error {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return errors.New("Invalid pull request URL")
+	}
+	title := report.title()
+	summary := report.markdown()
+	if g.DryRun {
+		fmt.Printf("Would publish check run '%s' on %s (%s): %s\n%s", ownershipCheckName, u, report.conclusion(), title, summary)
+		return nil
+	}
+	ctx := context.Background()
+	client := g.client(ctx)
+	pr, _, err := client.PullRequests.Get(ctx, user, repo, prNum)
+	if err != nil {
+		return fmt.Errorf("Failed to get pull request: %s", err)
+	}
+	status := "completed"
+	conclusion := report.conclusion()
+	now := github.Timestamp{Time: time.Now()}
+	_, _, err = client.Checks.CreateCheckRun(ctx, user, repo, github.CreateCheckRunOptions{
+		Name:        ownershipCheckName,
+		HeadBranch:  pr.GetHead().GetRef(),
+		HeadSHA:     pr.GetHead().GetSHA(),
+		Status:      &status,
+		Conclusion:  &conclusion,
+		CompletedAt: &now,
+		Output: &github.CheckRunOutput{
+			Title:   &title,
+			Summary: &summary,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to create check run: %s", err)
+	}
+	audit(g.event, "check-run", githubTarget(user, repo, prNum), conclusion)
+	return nil
+}
 
-func (o orderedSegmentList) Len() int           { return len(o) }
-func (o orderedSegmentList) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
-func (o orderedSegmentList) Less(i, j int) bool { return o[i].Priority > o[j].Priority }
+func (g *GitHubManager) PublishCommitStatus(u string, report *ownershipReport) error {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return errors.New("Invalid pull request URL")
+	}
+	state := report.conclusion()
+	description := report.title()
+	if g.DryRun {
+		fmt.Printf("Would set commit status '%s' of %s to %s: %s\n", ownershipCheckName, u, state, description)
+		return nil
+	}
+	ctx := context.Background()
+	client := g.client(ctx)
+	pr, _, err := client.PullRequests.Get(ctx, user, repo, prNum)
+	if err != nil {
+		return fmt.Errorf("Failed to get pull request: %s", err)
+	}
+	statusContext := ownershipCheckName
+	_, _, err = client.Repositories.CreateStatus(ctx, user, repo, pr.GetHead().GetSHA(), &github.RepoStatus{
+		State:       &state,
+		Description: &description,
+		Context:     &statusContext,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to set commit status: %s", err)
+	}
+	audit(g.event, "commit-status", githubTarget(user, repo, prNum), state)
+	return nil
+}
 
-// entry point
-func main() {
-	app := cli.App("chiefr", "Distributed source code maintennance toolkit")
-	mf := app.StringOpt("m maintainers-file", ".maintainers.ini", "Maintainers configuration file")
-	var config *Config
+func (g *GitHubManager) PullRequestAuthor(u string) (string, error) {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return "", errors.New("Invalid pull request URL")
+	}
+	ctx := context.Background()
+	pr, err := g.pullRequest(ctx, g.client(ctx), user, repo, prNum)
+	if err != nil {
+		return "", err
+	}
+	return pr.GetUser().GetLogin(), nil
+}
 
-	app.Before = func() {
-		// load config
-		var err error
-		config, err = initMaintainers(*mf)
+func (g *GitHubManager) PullRequestApprovals(u string) ([]string, error) {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return nil, errors.New("Invalid pull request URL")
+	}
+	ctx := context.Background()
+	client := g.client(ctx)
+	// reviews are listed in chronological order, the latest decisive review of the users counts
+	states := make(map[string]string)
+	order := make([]string, 0)
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := client.PullRequests.ListReviews(ctx, user, repo, prNum, opt)
 		if err != nil {
-			fmt.Println(err.Error())
-			app.PrintHelp()
-			os.Exit(1)
+			return nil, fmt.Errorf("Failed to list reviews of pull request: %s", err)
 		}
-		if config.Segments == nil {
-			fmt.Println("Error: empty maintainers file")
-			app.PrintHelp()
-			os.Exit(2)
+		for _, r := range reviews {
+			login := r.GetUser().GetLogin()
+			switch r.GetState() {
+			case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+				if _, found := states[login]; !found {
+					order = append(order, login)
+				}
+				states[login] = r.GetState()
+			}
 		}
-		if len(config.Segments) == 0 {
-			fmt.Println("Warning! No project segments defined.")
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	approved := make([]string, 0)
+	for _, login := range order {
+		if states[login] == "APPROVED" {
+			approved = append(approved, login)
 		}
 	}
+	return approved, nil
+}
 
-	app.Command("add", "Add new segment", func(cmd *cli.Cmd) {
-		cmd.Action = func() {
-			fmt.Println("not implemented")
+func (g *GitHubManager) MergePullRequest(u, method string, auto bool) error {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return errors.New("Invalid pull request URL")
+	}
+	if g.DryRun {
+		if auto {
+			fmt.Printf("Would enable auto-merge (%s) of %s\n", method, u)
+		} else {
+			fmt.Printf("Would merge (%s) %s if its checks passed\n", method, u)
 		}
-	})
-	app.Command("ask", "List where to ask questions", func(cmd *cli.Cmd) {
-		topic := cmd.StringArg("TOPIC", "", "Topic of the question or issue")
-		cmd.Spec = "[TOPIC]"
-		cmd.Action = func() {
-			err := ask(config, *topic)
-			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(6)
-			}
+		return nil
+	}
+	ctx := context.Background()
+	client := g.client(ctx)
+	pr, _, err := client.PullRequests.Get(ctx, user, repo, prNum)
+	if err != nil {
+		return fmt.Errorf("Failed to get pull request: %s", err)
+	}
+	if auto {
+		if err := g.enableAutoMerge(g.httpClient(ctx), pr, method); err != nil {
+			return fmt.Errorf("Failed to enable auto-merge of pull request: %s", err)
 		}
-	})
-	app.Command("list", "List files and their segments", func(cmd *cli.Cmd) {
+		audit(g.event, "enable-auto-merge", githubTarget(user, repo, prNum), method)
+		fmt.Printf("Enabled auto-merge of %s\n", u)
+		return nil
+	}
+	if err := g.checksPassed(ctx, client, user, repo, pr.GetHead().GetSHA()); err != nil {
+		return fmt.Errorf("Pull request isn't merged: %s", err)
+	}
+	_, _, err = client.PullRequests.Merge(ctx, user, repo, prNum, "", &github.PullRequestOptions{
+		SHA:         pr.GetHead().GetSHA(),
+		MergeMethod: method,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to merge pull request: %s", err)
+	}
+	audit(g.event, "merge", githubTarget(user, repo, prNum), method)
+	fmt.Printf("Merged %s\n", u)
+	return nil
+}
+
+// checksPassed returns error if the commit statuses or the check runs of the commit aren't successful,
+// the check runs of the GitHub Actions workflow run calling chiefr are ignored, they can't be completed yet
+func (g *GitHubManager) checksPassed(ctx context.Context, client *github.Client, owner, repo, ref string) error {
+	currentRun := ""
+	if id := os.Getenv("GITHUB_RUN_ID"); id != "" {
+		currentRun = "/actions/runs/" + id + "/"
+	}
+	status, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, ref, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return fmt.Errorf("failed to get commit status: %s", err)
+	}
+	if status.GetTotalCount() != 0 && status.GetState() != "success" {
+		return fmt.Errorf("commit status is %s", status.GetState())
+	}
+	opt := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, resp, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, ref, opt)
+		if err != nil {
+			return fmt.Errorf("failed to list check runs: %s", err)
+		}
+		for _, r := range runs.CheckRuns {
+			if currentRun != "" && strings.Contains(r.GetHTMLURL(), currentRun) {
+				continue
+			}
+			if r.GetStatus() != "completed" {
+				return fmt.Errorf("check '%s' is %s", r.GetName(), r.GetStatus())
+			}
+			switch r.GetConclusion() {
+			case "success", "neutral", "skipped":
+			default:
+				return fmt.Errorf("check '%s' concluded %s", r.GetName(), r.GetConclusion())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return nil
+}
+
+func (g *GitHubManager) ExpandTeams(users []string) ([]string, error) {
+	ctx := context.Background()
+	return g.resolveTeams(ctx, g.client(ctx), users)
+}
+
+// Pull request with the draft flag missing from the GitHub client
+type githubPullRequest struct {
+	github.PullRequest
+	Draft bool `json:"draft"`
+	// go-github doesn't decode the requested teams
+	RequestedTeams []*github.Team `json:"requested_teams,omitempty"`
+}
+
+// state returns the labels, assignees and review requests of the pull request
+func (pr *githubPullRequest) state() *pullRequestState {
+	state := &pullRequestState{}
+	for _, l := range pr.Labels {
+		state.Labels = append(state.Labels, l.GetName())
+	}
+	for _, a := range pr.Assignees {
+		state.Assignees = append(state.Assignees, a.GetLogin())
+	}
+	for _, r := range pr.RequestedReviewers {
+		state.Reviewers = append(state.Reviewers, r.GetLogin())
+	}
+	for _, t := range pr.RequestedTeams {
+		state.Teams = append(state.Teams, t.GetSlug())
+	}
+	return state
+}
+
+func (g *GitHubManager) pullRequest(ctx context.Context, client *github.Client, owner, repo string, num int) (*githubPullRequest, error) {
+	req, err := client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/pulls/%d", owner, repo, num), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get pull request: %s", err)
+	}
+	pr := &githubPullRequest{}
+	if _, err := client.Do(ctx, req, pr); err != nil {
+		return nil, fmt.Errorf("Failed to get pull request: %s", err)
+	}
+	return pr, nil
+}
+
+// removeStale removes the labels, assignees and review requests chiefr applied to the pull request earlier,
+// which don't belong to the matching segments anymore, e.g. after a force-push removed their files,
+// and records what is applied now
+func (g *GitHubManager) removeStale(ctx context.Context, client *github.Client, owner, repo string, pr *githubPullRequest, wanted, applied *pullRequestState) error {
+	num := pr.GetNumber()
+	recorded, err := g.pullRequestState(ctx, client, owner, repo, num)
+	if err != nil {
+		return err
+	}
+	present := pr.state()
+	record := *recorded
+	var staleLabels, staleAssignees, staleReviewers, staleTeams []string
+	staleLabels, record.Labels = syncApplied(recorded.Labels, present.Labels, wanted.Labels, applied.Labels)
+	staleAssignees, record.Assignees = syncApplied(recorded.Assignees, present.Assignees, wanted.Assignees, applied.Assignees)
+	staleReviewers, record.Reviewers = syncApplied(recorded.Reviewers, present.Reviewers, wanted.Reviewers, applied.Reviewers)
+	staleTeams, record.Teams = syncApplied(recorded.Teams, present.Teams, wanted.Teams, applied.Teams)
+	for _, name := range staleLabels {
+		_, err := client.Issues.RemoveLabelForIssue(ctx, owner, repo, num, name)
+		if err != nil {
+			return fmt.Errorf("Failed to remove label '%s' from pull request: %s", name, err)
+		}
+		audit(g.event, "remove-labels", githubTarget(owner, repo, num), name)
+		fmt.Printf("Removed label '%s'\n", name)
+	}
+	if len(staleAssignees) != 0 {
+		_, _, err := client.Issues.RemoveAssignees(ctx, owner, repo, num, staleAssignees)
+		if err != nil {
+			return fmt.Errorf("Failed to remove assignees from pull request: %s", err)
+		}
+		audit(g.event, "remove-assignees", githubTarget(owner, repo, num), staleAssignees...)
+		fmt.Printf("Removed assignees: %s\n", strings.Join(staleAssignees, ", "))
+	}
+	if len(staleReviewers) != 0 || len(staleTeams) != 0 {
+		_, err := client.PullRequests.RemoveReviewers(ctx, owner, repo, num, github.ReviewersRequest{Reviewers: staleReviewers, TeamReviewers: staleTeams})
+		if err != nil {
+			return fmt.Errorf("Failed to remove review requests from pull request: %s", err)
+		}
+		stale := append(append([]string{}, staleReviewers...), staleTeams...)
+		audit(g.event, "remove-review-requests", githubTarget(owner, repo, num), stale...)
+		fmt.Printf("Removed review requests: %s\n", strings.Join(stale, ", "))
+	}
+	return g.saveState(ctx, client, owner, repo, num, &record)
+}
+
+// removeSizeLabels removes the size labels of the pull request which don't match its size anymore
+func (g *GitHubManager) removeSizeLabels(ctx context.Context, client *github.Client, owner, repo string, pr *githubPullRequest, c *Config, labels []string) error {
+	stale := c.Settings.staleSizeLabels(pr.state().Labels, labels)
+	for _, name := range stale {
+		_, err := client.Issues.RemoveLabelForIssue(ctx, owner, repo, pr.GetNumber(), name)
+		if err != nil {
+			return fmt.Errorf("Failed to remove label '%s' from pull request: %s", name, err)
+		}
+		audit(g.event, "remove-labels", githubTarget(owner, repo, pr.GetNumber()), name)
+		fmt.Printf("Removed label '%s'\n", name)
+	}
+	// the removed labels aren't synced again
+	kept := make([]*github.Label, 0, len(pr.Labels))
+	for _, l := range pr.Labels {
+		if len(removeLabels([]string{l.GetName()}, stale)) != 0 {
+			kept = append(kept, l)
+		}
+	}
+	pr.Labels = kept
+	return nil
+}
+
+func (g *GitHubManager) PullRequestState(u string) (*pullRequestState, error) {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return nil, errors.New("Invalid pull request URL")
+	}
+	ctx := context.Background()
+	return g.pullRequestState(ctx, g.client(ctx), user, repo, prNum)
+}
+
+func (g *GitHubManager) SavePullRequestState(u string, state *pullRequestState) error {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return errors.New("Invalid pull request URL")
+	}
+	if g.DryRun {
+		fmt.Printf("Would record the state of %s\n", u)
+		return nil
+	}
+	ctx := context.Background()
+	return g.saveState(ctx, g.client(ctx), user, repo, prNum, state)
+}
+
+// pullRequestState returns what chiefr recorded as applied to the pull request
+func (g *GitHubManager) pullRequestState(ctx context.Context, client *github.Client, owner, repo string, num int) (*pullRequestState, error) {
+	comment, err := g.findComment(ctx, client, owner, repo, num, stateCommentMarker)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil {
+		return &pullRequestState{}, nil
+	}
+	return parsePullRequestState(comment.GetBody())
+}
+
+// saveState records what chiefr applied to the pull request, nothing is commented while the state is empty
+func (g *GitHubManager) saveState(ctx context.Context, client *github.Client, owner, repo string, num int, state *pullRequestState) error {
+	if state.empty() {
+		existing, err := g.findComment(ctx, client, owner, repo, num, stateCommentMarker)
+		if err != nil || existing == nil {
+			return err
+		}
+	}
+	comment, err := state.comment()
+	if err != nil {
+		return err
+	}
+	return g.upsertComment(ctx, client, owner, repo, num, stateCommentMarker, comment)
+}
+
+// findMilestone returns the number of the open milestone with the title
+func (g *GitHubManager) findMilestone(ctx context.Context, client *github.Client, owner, repo string, title string) (int, error) {
+	opt := &github.MilestoneListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		milestones, resp, err := client.Issues.ListMilestones(ctx, owner, repo, opt)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to list milestones: %s", err)
+		}
+		for _, m := range milestones {
+			if m.GetTitle() == title {
+				return m.GetNumber(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return 0, fmt.Errorf("Open milestone '%s' not found", title)
+}
+
+// setMilestone sets the milestone on the pull request
+func (g *GitHubManager) setMilestone(ctx context.Context, client *github.Client, owner, repo string, num int, milestone int, title string) error {
+	_, _, err := client.Issues.Edit(ctx, owner, repo, num, &github.IssueRequest{Milestone: github.Int(milestone)})
+	if err != nil {
+		return fmt.Errorf("Failed to set milestone of pull request: %s", err)
+	}
+	audit(g.event, "set-milestone", githubTarget(owner, repo, num), title)
+	return nil
+}
+
+// requestReviewers requests reviews from the users except the author of the pull request and from the teams
+func (g *GitHubManager) requestReviewers(ctx context.Context, client *github.Client, owner, repo string, num int, reviewers, teams []string, skip func(string) bool) error {
+	if len(reviewers) == 0 && len(teams) == 0 {
+		return nil
+	}
+	reviewers, err := g.resolveTeams(ctx, client, reviewers)
+	if err != nil {
+		return err
+	}
+	reviewers = removeUsers(reviewers, skip)
+	if len(reviewers) == 0 && len(teams) == 0 {
+		return nil
+	}
+	_, _, err = client.PullRequests.RequestReviewers(
+		ctx,
+		owner,
+		repo,
+		num,
+		github.ReviewersRequest{Reviewers: reviewers, TeamReviewers: teams},
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to request reviewers for pull request: %s", err)
+	}
+	audit(g.event, "request-reviews", githubTarget(owner, repo, num), append(reviewers, teams...)...)
+	return nil
+}
+
+// botLogin returns the login of the authenticated user writing the comments of chiefr, the GITHUB_TOKEN
+// of GitHub Actions can't read its user, its comments are written by github-actions[bot]
+func (g *GitHubManager) botLogin(ctx context.Context, client *github.Client) (string, error) {
+	if g.login != "" {
+		return g.login, nil
+	}
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		if e, ok := err.(*github.ErrorResponse); ok && e.Response.StatusCode == http.StatusForbidden && os.Getenv("GITHUB_ACTIONS") == "true" {
+			g.login = "github-actions[bot]"
+			return g.login, nil
+		}
+		return "", fmt.Errorf("Failed to get authenticated user: %s", err)
+	}
+	g.login = user.GetLogin()
+	return g.login, nil
+}
+
+// findComment returns the comment of the issue or pull request with the marker written by chiefr,
+// nil if there isn't any, anyone can post the marker, so the comments of other users are ignored
+func (g *GitHubManager) findComment(ctx context.Context, client *github.Client, owner, repo string, num int, marker string) (*github.IssueComment, error) {
+	login, err := g.botLogin(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.Issues.ListComments(ctx, owner, repo, num, opt)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list comments: %s", err)
+		}
+		for _, c := range comments {
+			if strings.Contains(c.GetBody(), marker) && strings.EqualFold(c.GetUser().GetLogin(), login) {
+				return c, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opt.Page = resp.NextPage
+	}
+}
+
+// upsertComment comments on the issue or pull request, the existing comment of chiefr with the marker
+// is updated instead, the comments of other users quoting the marker are left alone
+func (g *GitHubManager) upsertComment(ctx context.Context, client *github.Client, owner, repo string, num int, marker, comment string) error {
+	body := comment + "\n" + marker
+	existing, err := g.findComment(ctx, client, owner, repo, num, marker)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if existing.GetBody() == body {
+			return nil
+		}
+		_, _, err = client.Issues.EditComment(ctx, owner, repo, existing.GetID(), &github.IssueComment{Body: &body})
+		if err != nil {
+			return fmt.Errorf("Failed to update comment: %s", err)
+		}
+		audit(g.event, "update-comment", githubTarget(owner, repo, num), marker)
+		return nil
+	}
+	_, _, err = client.Issues.CreateComment(ctx, owner, repo, num, &github.IssueComment{Body: &body})
+	if err != nil {
+		return fmt.Errorf("Failed to create comment: %s", err)
+	}
+	audit(g.event, "comment", githubTarget(owner, repo, num), marker)
+	return nil
+}
+
+// addLabels adds the labels missing from the pull request, the labels not existing in the repository are created
+func (g *GitHubManager) addLabels(ctx context.Context, client *github.Client, owner, repo string, num int, c *Config, labels []string) error {
+	present := make(map[string]bool)
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		prLabels, resp, err := client.Issues.ListLabelsByIssue(ctx, owner, repo, num, opt)
+		if err != nil {
+			return fmt.Errorf("Failed to list labels of pull request: %s", err)
+		}
+		for _, l := range prLabels {
+			present[strings.ToLower(l.GetName())] = true
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	missing := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if !present[strings.ToLower(l)] {
+			missing = append(missing, l)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	err := g.createMissingLabels(ctx, client, owner, repo, c, missing)
+	if err != nil {
+		return err
+	}
+	_, _, err = client.Issues.AddLabelsToIssue(ctx, owner, repo, num, missing)
+	if err != nil {
+		return fmt.Errorf("Failed to add labels to pull request: %s", err)
+	}
+	audit(g.event, "add-labels", githubTarget(owner, repo, num), missing...)
+	return nil
+}
+
+// removeUsers returns the users without the skipped GitHub logins
+func removeUsers(users []string, skip func(string) bool) []string {
+	rest := make([]string, 0, len(users))
+	for _, u := range users {
+		if !skip(u) {
+			rest = append(rest, u)
+		}
+	}
+	return rest
+}
+
+// splitTeamReviewers separates the GitHub team references (@org/team) of the organization
+// from the users, the slugs of the teams are returned
+func splitTeamReviewers(org string, users []string) ([]string, []string) {
+	rest := make([]string, 0, len(users))
+	teams := make([]string, 0)
+	for _, u := range users {
+		parts := strings.SplitN(strings.TrimPrefix(u, "@"), "/", 2)
+		if strings.HasPrefix(u, "@") && len(parts) == 2 && strings.EqualFold(parts[0], org) {
+			appendNew(&teams, parts[1])
+			continue
+		}
+		appendNew(&rest, u)
+	}
+	return rest, teams
+}
+
+func (g *GitHubManager) CommentIssue(u, marker, comment string) error {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Failed to parse issue URL: %s", err)
+	}
+	user, repo, num, err := parseGitHubIssueURL(URL, "issues")
+	if err != nil {
+		return errors.New("Invalid issue URL")
+	}
+	if g.DryRun {
+		fmt.Printf("Would comment on %s:\n%s\n", u, comment)
+		return nil
+	}
+	ctx := context.Background()
+	return g.upsertComment(ctx, g.client(ctx), user, repo, num, marker, comment)
+}
+
+func (g *GitHubManager) PullRequestRefs(u string) (*pullRequestRefs, error) {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return nil, errors.New("Invalid pull request URL")
+	}
+	ctx := context.Background()
+	pr, _, err := g.client(ctx).PullRequests.Get(ctx, user, repo, prNum)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get pull request: %s", err)
+	}
+	return &pullRequestRefs{
+		Number:   prNum,
+		CloneURL: pr.GetBase().GetRepo().GetCloneURL(),
+		Head:     fmt.Sprintf("refs/pull/%d/head", prNum),
+		Base:     "refs/heads/" + pr.GetBase().GetRef(),
+	}, nil
+}
+
+// createMissingLabels creates the labels not existing in the repository with the
+// color and description of the [chiefr.labels] section
+func (g *GitHubManager) createMissingLabels(ctx context.Context, client *github.Client, owner, repo string, c *Config, labels []string) error {
+	existing := make(map[string]bool)
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		repoLabels, resp, err := client.Issues.ListLabels(ctx, owner, repo, opt)
+		if err != nil {
+			return fmt.Errorf("Failed to list labels of the repository: %s", err)
+		}
+		for _, l := range repoLabels {
+			existing[strings.ToLower(l.GetName())] = true
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	for _, name := range labels {
+		if existing[strings.ToLower(name)] {
+			continue
+		}
+		if _, err := g.createLabel(ctx, client, owner, repo, c, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createLabel creates the label with the color and description of the [chiefr.labels] section
+func (g *GitHubManager) createLabel(ctx context.Context, client *github.Client, owner, repo string, c *Config, name string) (*github.Label, error) {
+	style := c.labelStyle(name)
+	label := &github.Label{Name: &name, Color: &style.Color}
+	if style.Description != "" {
+		label.Description = &style.Description
+	}
+	label, _, err := client.Issues.CreateLabel(ctx, owner, repo, label)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create label '%s': %s", name, err)
+	}
+	audit(g.event, "create-label", owner+"/"+repo, name)
+	fmt.Printf("Created label '%s'\n", name)
+	return label, nil
+}
+
+// addLoad counts the new assignments and review requests of the users in the cached loads,
+// so the next pull requests handled by the manager, e.g. by sweep, are balanced by the current loads
+func (g *GitHubManager) addLoad(users []string) {
+	for _, u := range users {
+		if _, found := g.loads[u]; found {
+			g.loads[u]++
+		}
+	}
+}
+
+// openPullRequests returns the number of open pull requests of the repository assigned to the user
+// or waiting for their review, the pull requests of teams are not counted
+func (g *GitHubManager) openPullRequests(ctx context.Context, client *github.Client, owner, repo, login string) (int, error) {
+	if g.loads == nil {
+		g.loads = make(map[string]int)
+	}
+	if n, found := g.loads[login]; found {
+		return n, nil
+	}
+	// pull requests both assigned to the user and waiting for their review are counted once
+	pullRequests := make(map[int]bool)
+	for _, qualifier := range []string{"assignee", "review-requested"} {
+		query := fmt.Sprintf("repo:%s/%s is:pr is:open %s:%s", owner, repo, qualifier, login)
+		opt := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			result, resp, err := client.Search.Issues(ctx, query, opt)
+			if err != nil {
+				return 0, fmt.Errorf("Failed to count the open pull requests of '%s': %s", login, err)
+			}
+			for _, issue := range result.Issues {
+				pullRequests[issue.GetNumber()] = true
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opt.Page = resp.NextPage
+		}
+	}
+	g.loads[login] = len(pullRequests)
+	return len(pullRequests), nil
+}
+
+// resolveTeams replaces the GitHub team references (@org/team) with the members of the team
+func (g *GitHubManager) resolveTeams(ctx context.Context, client *github.Client, users []string) ([]string, error) {
+	resolved := make([]string, 0, len(users))
+	for _, u := range users {
+		if !strings.HasPrefix(u, "@") {
+			appendNew(&resolved, u)
+			continue
+		}
+		parts := strings.SplitN(u[1:], "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid GitHub team reference '%s'", u)
+		}
+		members, err := g.teamMembers(ctx, client, parts[0], parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to resolve GitHub team '%s': %s", u, err)
+		}
+		for _, m := range members {
+			appendNew(&resolved, m)
+		}
+	}
+	return resolved, nil
+}
+
+func (g *GitHubManager) teamMembers(ctx context.Context, client *github.Client, org, slug string) ([]string, error) {
+	var teamID int64
+	opt := &github.ListOptions{PerPage: 100}
+	for teamID == 0 {
+		teams, resp, err := client.Teams.ListTeams(ctx, org, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range teams {
+			if t.GetSlug() == slug {
+				teamID = t.GetID()
+				break
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	if teamID == 0 {
+		return nil, errors.New("team not found")
+	}
+	members := make([]string, 0)
+	memberOpt := &github.TeamListTeamMembersOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		users, resp, err := client.Teams.ListTeamMembers(ctx, teamID, memberOpt)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			members = append(members, u.GetLogin())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		memberOpt.Page = resp.NextPage
+	}
+	return members, nil
+}
+
+func (g *GitHubManager) client(ctx context.Context) *github.Client {
+	return github.NewClient(g.httpClient(ctx))
+}
+
+func (g *GitHubManager) httpClient(ctx context.Context) *http.Client {
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: g.APIKey},
+	)
+	client := oauth2.NewClient(ctx, ts)
+	client.Transport = &retryTransport{
+		base:       &etagTransport{base: client.Transport, dir: apiCacheDir, token: g.APIKey},
+		maxRetries: apiMaxRetries,
+	}
+	return client
+}
+
+// parseGitHubIssueURL returns the owner, repository and number of an issue or pull request URL,
+// kind is the path segment before the number: "issues" or "pull"
+func parseGitHubIssueURL(URL *url.URL, kind string) (string, string, int, error) {
+	pathParts := strings.Split(URL.Path, "/")
+	if len(pathParts) != 5 || pathParts[3] != kind || pathParts[1] == "" || pathParts[2] == "" {
+		return "", "", 0, errors.New("Invalid URL")
+	}
+	num, err := strconv.Atoi(pathParts[4])
+	if err != nil {
+		return "", "", 0, errors.New("Invalid URL")
+	}
+	return pathParts[1], pathParts[2], num, nil
+}
+
+type orderedSegmentList []*ProjectSegment
+
+func (o orderedSegmentList) Len() int      { return len(o) }
+func (o orderedSegmentList) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o orderedSegmentList) Less(i, j int) bool {
+	// segments with the same priority are ordered by name
+	if o[i].Priority == o[j].Priority {
+		return o[i].Name < o[j].Name
+	}
+	return o[i].Priority > o[j].Priority
+}
+
+func sortedSegments(segments ProjectSegments) orderedSegmentList {
+	os := make(orderedSegmentList, 0, len(segments))
+	for _, s := range segments {
+		os = append(os, s)
+	}
+	sort.Sort(os)
+	return os
+}
+
+func (o orderedSegmentList) contains(s *ProjectSegment) bool {
+	for _, s2 := range o {
+		if s2 == s {
+			return true
+		}
+	}
+	return false
+}
+
+// changeSourceOpts defines the --staged and --worktree options of the command
+func changeSourceOpts(cmd *cli.Cmd, stagedDesc, worktreeDesc string) func() *changeSource {
+	staged := cmd.BoolOpt("staged", false, stagedDesc)
+	worktree := cmd.BoolOpt("worktree", false, worktreeDesc)
+	return func() *changeSource {
+		switch {
+		case *staged:
+			return &changeSource{kind: stagedChanges}
+		case *worktree:
+			return &changeSource{kind: worktreeChanges}
+		}
+		return &changeSource{kind: committedChanges}
+	}
+}
+
+// patchFileOpt defines the --patch-file option of the command
+func patchFileOpt(cmd *cli.Cmd, source func() *changeSource) func() *changeSource {
+	patchFile := cmd.StringOpt("patch-file", "", "Analyze the unified diff or `git format-patch` file instead of commits, --patch-file=- reads the standard input")
+	return func() *changeSource {
+		if *patchFile != "" {
+			return &changeSource{kind: patchFileChanges, patchFile: *patchFile}
+		}
+		return source()
+	}
+}
+
+// entry point
+func main() {
+	app := cli.App("chiefr", "Distributed source code maintennance toolkit")
+	mf := app.StringOpt("m maintainers-file", "", "Maintainers configuration file path or URL (default: first existing of "+strings.Join(maintainersFileLocations, ", ")+")")
+	offline := app.BoolOpt("offline", false, "Use the cached copy of remote maintainers files")
+	noCache := app.BoolOpt("no-cache", false, "Don't cache the segments matching the files and the forge API responses")
+	nativeGit := app.BoolOpt("native-git", false, "Use the git executable for diff and log operations instead of go-git")
+	gitDirOpt := app.String(cli.StringOpt{Name: "git-dir", EnvVar: "GIT_DIR", Desc: "Path of the git directory of the repository"})
+	workTree := app.String(cli.StringOpt{Name: "work-tree", EnvVar: "GIT_WORK_TREE", Desc: "Path of the work tree of the repository (default: working directory if the git directory is set)"})
+	tokenFileOpt := app.String(cli.StringOpt{Name: "token-file", EnvVar: "CHIEFR_TOKEN_FILE", Desc: "File containing the API token of the forge"})
+	githubAPIOpt := app.String(cli.StringOpt{Name: "github-api", Value: githubAPI, EnvVar: "CHIEFR_GITHUB_API", Desc: "GitHub API of updating pull requests: rest or graphql"})
+	maxRetries := app.Int(cli.IntOpt{Name: "max-retries", Value: apiMaxRetries, EnvVar: "CHIEFR_MAX_RETRIES", Desc: "Maximum number of retries of the forge API requests hitting rate limits"})
+	auditLog := app.String(cli.StringOpt{Name: "audit-log", EnvVar: "CHIEFR_AUDIT_LOG", Desc: "File of appending the changes made on the forges as JSON lines"})
+	var config *Config
+	var repoPath string
+	// reloadConfig loads the maintainers file again, see the serve command
+	var reloadConfig func() (*Config, error)
+
+	app.Before = func() {
+		gitDir = *gitDirOpt
+		if *maxRetries < 0 {
+			fmt.Println("Error: --max-retries can't be negative")
+			os.Exit(1)
+		}
+		apiMaxRetries = *maxRetries
+		if *githubAPIOpt != githubAPIREST && *githubAPIOpt != githubAPIGraphQL {
+			fmt.Printf("Error: unknown GitHub API '%s'\n", *githubAPIOpt)
+			os.Exit(1)
+		}
+		githubAPI = *githubAPIOpt
+		tokenFile = *tokenFileOpt
+		auditLogPath = *auditLog
+		switch {
+		case *workTree != "":
+			repoPath = *workTree
+		case gitDir != "":
+			repoPath = "."
+		default:
+			repoPath = findRepositoryRoot()
+		}
+		// load config
+		var err error
+		fromTree := false
+		if *mf == "" {
+			*mf, err = findMaintainersFile(repoPath)
+			if err != nil {
+				name, treeConfig, treeErr := loadTreeMaintainers(repoPath, *offline)
+				if name == "" {
+					fmt.Println(err.Error())
+					app.PrintHelp()
+					os.Exit(1)
+				}
+				*mf, config, err = name, treeConfig, treeErr
+				fromTree = true
+				fmt.Fprintf(os.Stderr, "Using maintainers file %s of HEAD\n", *mf)
+			} else {
+				fmt.Fprintf(os.Stderr, "Using maintainers file %s\n", *mf)
+			}
+		}
+		if config == nil && err == nil {
+			config, err = initMaintainers(*mf, *offline)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			app.PrintHelp()
+			os.Exit(1)
+		}
+		if config.Segments == nil {
+			fmt.Println("Error: empty maintainers file")
+			app.PrintHelp()
+			os.Exit(2)
+		}
+		if len(config.Segments) == 0 {
+			fmt.Println("Warning! No project segments defined.")
+		}
+		if !*noCache {
+			if dir, err := matchCacheDir(); err == nil {
+				config.matchCache = dir
+			}
+			if dir, err := apiResponseCacheDir(); err == nil {
+				apiCacheDir = dir
+			}
+		}
+		config.nativeGit = *nativeGit
+		if config.Settings.Version < configVersion {
+			fmt.Fprintf(os.Stderr, "Warning! Maintainers file version %d is outdated, run `chiefr migrate` to upgrade it\n", config.Settings.Version)
+		}
+		reloadConfig = func() (*Config, error) {
+			var c *Config
+			var err error
+			if fromTree {
+				_, c, err = loadTreeMaintainers(repoPath, *offline)
+			} else {
+				c, err = initMaintainers(*mf, *offline)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if c.Segments == nil {
+				return nil, errors.New("Empty maintainers file")
+			}
+			c.matchCache = config.matchCache
+			c.nativeGit = config.nativeGit
+			return c, nil
+		}
+	}
+
+	app.Command("add", "Add new segment", func(cmd *cli.Cmd) {
+		cmd.Action = func() {
+			err := addSegment(config, repoPath, *mf, os.Stdin)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(10)
+			}
+		}
+	})
+	app.Command("migrate", "Upgrade the maintainers file to the current version", func(cmd *cli.Cmd) {
+		cmd.Action = func() {
+			err := migrate(config, *mf)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(11)
+			}
+		}
+	})
+	app.Command("remove", "Remove segment", func(cmd *cli.Cmd) {
+		name := cmd.StringArg("SEGMENT", "", "Name of the segment")
+		cmd.Action = func() {
+			err := removeSegment(config, *mf, *name)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(10)
+			}
+		}
+	})
+	app.Command("rename", "Rename segment", func(cmd *cli.Cmd) {
+		name := cmd.StringArg("SEGMENT", "", "Name of the segment")
+		newName := cmd.StringArg("NEW_NAME", "", "New name of the segment")
+		cmd.Action = func() {
+			err := renameSegment(config, *mf, *name, *newName)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(10)
+			}
+		}
+	})
+	app.Command("edit", "Set segment properties", func(cmd *cli.Cmd) {
+		name := cmd.StringArg("SEGMENT", "", "Name of the segment")
+		properties := cmd.StringsArg("PROPERTY", nil, "Property to set in KEY=VALUE format, empty value removes the property")
+		cmd.Spec = "SEGMENT PROPERTY..."
+		cmd.Action = func() {
+			err := editSegment(config, *mf, *name, *properties)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(10)
+			}
+		}
+	})
+	app.Command("ask", "List where to ask questions", func(cmd *cli.Cmd) {
+		topic := cmd.StringArg("TOPIC", "", "Topic of the question or issue")
+		cmd.Spec = "[TOPIC]"
+		cmd.Action = func() {
+			err := ask(config, *topic)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(6)
+			}
+		}
+	})
+	app.Command("explain", "Explain the segments of patches with the matching patterns", func(cmd *cli.Cmd) {
+		ref := cmd.StringArg("REVISION", "", "Git revision of the patch's first commit or REV1..REV2 range (default: fork point of the base branch)")
+		source := patchFileOpt(cmd, changeSourceOpts(cmd, "Explain the staged changes", "Explain the uncommitted changes"))
+		cmd.Spec = "[--staged | --worktree | --patch-file] [REVISION]"
+		cmd.Action = func() {
+			err := explain(config, repoPath, *ref, source())
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(14)
+			}
+		}
+	})
+	app.Command("fmt", "Rewrite the maintainers file in canonical format", func(cmd *cli.Cmd) {
+		check := cmd.BoolOpt("check", false, "Only check if the maintainers file is formatted")
+		cmd.Action = func() {
+			err := formatMaintainers(config, *mf, *check)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(12)
+			}
+		}
+	})
+	app.Command("import", "Generate segments from package metadata files", func(cmd *cli.Cmd) {
+		cmd.Action = func() {
+			err := importSegments(config, repoPath)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(7)
+			}
+		}
+	})
+	app.Command("lint", "Check the maintainers file for problems", func(cmd *cli.Cmd) {
+		cmd.Action = func() {
+			err := lint(config, repoPath)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(8)
+			}
+		}
+	})
+	app.Command("list", "List files and their segments", func(cmd *cli.Cmd) {
 		path := cmd.StringArg("PATH_REGEX", ".*", "Path regex to filter files")
-		cmd.Spec = "[PATH_REGEX]"
+		prefix := cmd.StringOpt("prefix", "", "List only the files under the path prefix (e.g. src/)")
+		source := changeSourceOpts(cmd, "List the files of the index", "List the files of the working tree")
+		cmd.Spec = "[--staged | --worktree] [--prefix] [PATH_REGEX]"
+		cmd.Action = func() {
+			err := list(config, repoPath, *prefix, *path, source())
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(3)
+			}
+		}
+	})
+	app.Command("match", "List the segments of files and the patterns matching them", func(cmd *cli.Cmd) {
+		paths := cmd.StringsArg("FILE", nil, "File path, paths are read from the standard input if not specified")
+		cmd.Spec = "[FILE...]"
+		cmd.Action = func() {
+			err := match(config, *paths, os.Stdin)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(13)
+			}
+		}
+	})
+	app.Command("snapshot", "Save and compare ownership snapshots", func(cmd *cli.Cmd) {
+		cmd.Command("save", "Save the ownership of the files to a snapshot file", func(cmd *cli.Cmd) {
+			file := cmd.StringArg("FILE", "", "Snapshot file")
+			cmd.Action = func() {
+				err := saveSnapshot(config, repoPath, *file)
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(9)
+				}
+			}
+		})
+		cmd.Command("compare", "List ownership changes between two snapshot files", func(cmd *cli.Cmd) {
+			oldFile := cmd.StringArg("OLD", "", "Old snapshot file")
+			newFile := cmd.StringArg("NEW", "", "New snapshot file")
+			cmd.Action = func() {
+				err := compareSnapshots(*oldFile, *newFile)
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(9)
+				}
+			}
+		})
+	})
+	app.Command("submit", "Submit patches to maintainers", func(cmd *cli.Cmd) {
+		ref := cmd.StringArg("REVISION", "", "Git revision of the patch's first commit or REV1..REV2 range (default: fork point of the base branch)")
+		requireCoverage := cmd.BoolOpt("require-coverage", false, "Fail if any changed file doesn't belong to a segment")
+		source := patchFileOpt(cmd, changeSourceOpts(cmd, "Submit the staged changes", "Submit the uncommitted changes"))
+		cmd.Spec = "[--require-coverage] [--staged | --worktree | --patch-file] [REVISION]"
+		cmd.Action = func() {
+			err := submit(config, repoPath, *ref, source(), *requireCoverage)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(4)
+			}
+		}
+	})
+	app.Command("update-pull-request", "Update pull request chiefs and topics according to the maintainers file", func(cmd *cli.Cmd) {
+		ref := cmd.StringArg("REVISION", "", "Git revision of the patch's first commit or REV1..REV2 range")
+		repo := cmd.StringArg("PULL_REQUEST_URL", "", "URL of the pull request")
+		key := cmd.StringArg("API_KEY", "", "API key of the project (deprecated, see --token-file)")
+		close := cmd.BoolOpt("close", false, "Close pull request if it has no matching segments")
+		lock := cmd.BoolOpt("lock", false, "Lock the conversation of the pull request closed by --close")
+		lockReason := cmd.StringOpt("lock-reason", lockReasonResolved, "Reason of locking the conversation: off-topic, too heated, resolved or spam")
+		dryRun := cmd.BoolOpt("dry-run", false, "Print the changes instead of applying them to the pull request")
+		requireCoverage := cmd.BoolOpt("require-coverage", false, "Fail if any changed file doesn't belong to a segment")
+		checkRun := cmd.BoolOpt("check-run", false, "Publish the matching segments and the uncovered files as a check run of the pull request")
+		commitStatus := cmd.BoolOpt("commit-status", false, "Publish the coverage result as the chiefr/ownership commit status of the pull request")
+		annotations := cmd.BoolOpt("annotations", false, "Print the segments of the changed files and the uncovered files as GitHub Actions annotations")
+		sync := cmd.BoolOpt("sync", false, "Remove the labels, assignees and review requests chiefr applied which don't match the pull request anymore")
+		fetch := cmd.BoolOpt("fetch", false, "Fetch the head and the base branch of the pull request from the forge instead of using the local revisions")
+		rotation := cmd.String(cli.StringOpt{Name: "rotation-state", EnvVar: "CHIEFR_ROTATION_STATE", Desc: "Path of the chief rotation state file of the round-robin assignment strategy (default: user cache directory)"})
+		notifyMail := cmd.Bool(cli.BoolOpt{Name: "notify-mail-lists", EnvVar: "CHIEFR_NOTIFY_MAIL_LISTS", Desc: "Mail the mailing lists of the matching segments through the SMTP server"})
+		smtpServer := cmd.String(cli.StringOpt{Name: "smtp-server", EnvVar: "CHIEFR_SMTP_SERVER", Desc: "host:port of the SMTP server of the mailing list notifications"})
+		smtpFrom := cmd.String(cli.StringOpt{Name: "smtp-from", EnvVar: "CHIEFR_SMTP_FROM", Desc: "Sender address of the mailing list notifications"})
+		smtpUsername := cmd.String(cli.StringOpt{Name: "smtp-username", EnvVar: "CHIEFR_SMTP_USERNAME", Desc: "Username of the SMTP server (default: no authentication)"})
+		smtpPassword := cmd.String(cli.StringOpt{Name: "smtp-password", EnvVar: "CHIEFR_SMTP_PASSWORD", Desc: "Password of the SMTP server (deprecated, see --smtp-password-file)"})
+		smtpPasswordFile := cmd.String(cli.StringOpt{Name: "smtp-password-file", EnvVar: "CHIEFR_SMTP_PASSWORD_FILE", Desc: "File of the password of the SMTP server"})
+		source := patchFileOpt(cmd, func() *changeSource { return &changeSource{kind: committedChanges} })
+		cmd.Spec = "[--close [--lock [--lock-reason]]] [--dry-run] [--sync] [--require-coverage] [--check-run] [--commit-status] [--annotations] [--rotation-state] [--notify-mail-lists [--smtp-server] [--smtp-from] [--smtp-username] [--smtp-password | --smtp-password-file]] [--fetch | --patch-file] [REVISION] PULL_REQUEST_URL [API_KEY]"
+		cmd.Action = func() {
+			shiftTokenArgument(ref, repo, key)
+			if *fetch && *ref != "" {
+				fmt.Println("REVISION can't be specified with --fetch")
+				os.Exit(5)
+			}
+			token, err := apiToken(*repo, *key)
+			// dry runs without --fetch don't call the forge API
+			if err != nil && (!*dryRun || *fetch) {
+				fmt.Println(err.Error())
+				os.Exit(5)
+			}
+			if *lock && !validLockReason(*lockReason) {
+				fmt.Printf("Invalid lock reason '%s'\n", *lockReason)
+				os.Exit(5)
+			}
+			if err := config.setRotationState(*rotation); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(5)
+			}
+			var mail *smtpOptions
+			if *notifyMail {
+				if !*dryRun && (*smtpServer == "" || *smtpFrom == "") {
+					fmt.Println("Error: --notify-mail-lists requires --smtp-server and --smtp-from")
+					os.Exit(5)
+				}
+				if *smtpPassword != "" {
+					fmt.Fprintln(os.Stderr, "Warning! --smtp-password is deprecated because it leaks through the process list, use --smtp-password-file instead")
+				}
+				password, err := loadSecret(*smtpPassword, *smtpPasswordFile)
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(5)
+				}
+				mail = &smtpOptions{server: *smtpServer, from: *smtpFrom, username: *smtpUsername, password: password}
+			}
+			err = checkPullRequest(config, repoPath, *ref, source(), *repo, token, &pullRequestOptions{
+				close:           *close,
+				lock:            *lock,
+				lockReason:      *lockReason,
+				dryRun:          *dryRun,
+				sync:            *sync,
+				requireCoverage: *requireCoverage,
+				fetch:           *fetch,
+				checkRun:        *checkRun,
+				commitStatus:    *commitStatus,
+				annotations:     *annotations,
+				event:           "update-pull-request",
+				mail:            mail,
+			})
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(5)
+			}
+		}
+	})
+	app.Command("sweep", "Update every open pull request of the repository according to the maintainers file", func(cmd *cli.Cmd) {
+		repo := cmd.StringArg("REPOSITORY_URL", "", "URL of the repository (default: the repository of the segments)")
+		close := cmd.BoolOpt("close", false, "Close the pull requests belonging to other repositories")
+		dryRun := cmd.BoolOpt("dry-run", false, "Print the changes instead of applying them to the pull requests")
+		sync := cmd.BoolOpt("sync", false, "Remove the labels, assignees and review requests chiefr applied which don't match the pull requests anymore")
+		rotation := cmd.String(cli.StringOpt{Name: "rotation-state", EnvVar: "CHIEFR_ROTATION_STATE", Desc: "Path of the chief rotation state file of the round-robin assignment strategy (default: user cache directory)"})
+		cmd.Spec = "[--close] [--dry-run] [--sync] [--rotation-state] [REPOSITORY_URL]"
+		cmd.Action = func() {
+			repoURL := *repo
+			if repoURL == "" {
+				var err error
+				repoURL, err = sweepRepository(config)
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(16)
+				}
+			}
+			token, err := apiToken(repoURL, "")
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(16)
+			}
+			if err := config.setRotationState(*rotation); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(16)
+			}
+			err = sweep(config, repoPath, repoURL, token, &pullRequestOptions{
+				close:  *close,
+				dryRun: *dryRun,
+				sync:   *sync,
+				event:  "sweep",
+			})
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(16)
+			}
+		}
+	})
+	app.Command("serve", "Update pull requests on the webhooks of the forge", func(cmd *cli.Cmd) {
+		listen := cmd.String(cli.StringOpt{Name: "listen", Value: ":8080", EnvVar: "CHIEFR_LISTEN", Desc: "Address of the webhook server"})
+		close := cmd.BoolOpt("close", false, "Close the pull requests belonging to other repositories")
+		sync := cmd.BoolOpt("sync", false, "Remove the labels, assignees and review requests chiefr applied which don't match the pull requests anymore")
+		rotation := cmd.String(cli.StringOpt{Name: "rotation-state", EnvVar: "CHIEFR_ROTATION_STATE", Desc: "Path of the chief rotation state file of the round-robin assignment strategy (default: user cache directory)"})
+		githubSecret := cmd.String(cli.StringOpt{Name: "github-secret", EnvVar: "CHIEFR_GITHUB_WEBHOOK_SECRET", Desc: "Secret of the GitHub webhook signatures, GitHub webhooks are rejected without it"})
+		githubSecretFile := cmd.String(cli.StringOpt{Name: "github-secret-file", EnvVar: "CHIEFR_GITHUB_WEBHOOK_SECRET_FILE", Desc: "File containing the secret of the GitHub webhook signatures"})
+		gitlabToken := cmd.String(cli.StringOpt{Name: "gitlab-token", EnvVar: "CHIEFR_GITLAB_WEBHOOK_TOKEN", Desc: "Secret token of the GitLab webhooks, GitLab webhooks are rejected without it"})
+		gitlabTokenFile := cmd.String(cli.StringOpt{Name: "gitlab-token-file", EnvVar: "CHIEFR_GITLAB_WEBHOOK_TOKEN_FILE", Desc: "File containing the secret token of the GitLab webhooks"})
+		sweepInterval := cmd.String(cli.StringOpt{Name: "sweep-interval", EnvVar: "CHIEFR_SWEEP_INTERVAL", Desc: "Interval of updating every open pull request, e.g. 6h (default: no sweeps)"})
+		sweepRepo := cmd.String(cli.StringOpt{Name: "sweep-repository", EnvVar: "CHIEFR_SWEEP_REPOSITORY", Desc: "URL of the repository swept by --sweep-interval (default: the repository of the segments)"})
+		shutdownTimeout := cmd.String(cli.StringOpt{Name: "shutdown-timeout", Value: "30s", EnvVar: "CHIEFR_SHUTDOWN_TIMEOUT", Desc: "Maximum time of finishing the pending updates on SIGTERM"})
+		multiRepo := cmd.Bool(cli.BoolOpt{Name: "multi-repository", EnvVar: "CHIEFR_MULTI_REPOSITORY", Desc: "Use the maintainers file of the default branch of every repository sending webhooks"})
+		workers := cmd.Int(cli.IntOpt{Name: "workers", Value: 1, EnvVar: "CHIEFR_WORKERS", Desc: "Number of pull requests updated concurrently"})
+		queueSize := cmd.Int(cli.IntOpt{Name: "queue-size", Value: 100, EnvVar: "CHIEFR_QUEUE_SIZE", Desc: "Maximum number of queued updates, webhooks are rejected if the queue is full"})
+		updateRetries := cmd.Int(cli.IntOpt{Name: "update-retries", Value: 2, EnvVar: "CHIEFR_UPDATE_RETRIES", Desc: "Number of retries of the failed updates with exponential backoff"})
+		tlsCert := cmd.String(cli.StringOpt{Name: "tls-cert", EnvVar: "CHIEFR_TLS_CERT", Desc: "Certificate file of serving HTTPS"})
+		tlsKey := cmd.String(cli.StringOpt{Name: "tls-key", EnvVar: "CHIEFR_TLS_KEY", Desc: "Private key file of the certificate"})
+		acmeDomains := cmd.String(cli.StringOpt{Name: "acme-domain", EnvVar: "CHIEFR_ACME_DOMAIN", Desc: "Comma separated list of domains of serving HTTPS with certificates obtained from Let's Encrypt"})
+		acmeCache := cmd.String(cli.StringOpt{Name: "acme-cache", EnvVar: "CHIEFR_ACME_CACHE", Desc: "Directory of the certificates obtained from Let's Encrypt (default: user cache directory)"})
+		trustProxy := cmd.Bool(cli.BoolOpt{Name: "trust-proxy", EnvVar: "CHIEFR_TRUST_PROXY", Desc: "Trust the client address appended to the X-Forwarded-For header by the reverse proxy"})
+		basePath := cmd.String(cli.StringOpt{Name: "base-path", EnvVar: "CHIEFR_BASE_PATH", Desc: "Path prefix of the endpoints, e.g. /chiefr"})
+		adminToken := cmd.String(cli.StringOpt{Name: "admin-token", EnvVar: "CHIEFR_ADMIN_TOKEN", Desc: "Bearer token of the admin endpoints, they are disabled without it"})
+		adminTokenFile := cmd.String(cli.StringOpt{Name: "admin-token-file", EnvVar: "CHIEFR_ADMIN_TOKEN_FILE", Desc: "File containing the bearer token of the admin endpoints"})
+		cmd.Spec = "[--listen] [--close] [--sync] [--rotation-state] [--github-secret | --github-secret-file] [--gitlab-token | --gitlab-token-file] [--sweep-interval [--sweep-repository]] [--shutdown-timeout] [--multi-repository] [--workers] [--queue-size] [--update-retries] [--tls-cert --tls-key | --acme-domain [--acme-cache]] [--trust-proxy] [--base-path] [--admin-token | --admin-token-file]"
+		cmd.Action = func() {
+			if err := config.setRotationState(*rotation); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(18)
+			}
+			serverOpts := &serverOptions{
+				addr:            *listen,
+				sweepRepository: *sweepRepo,
+				multiRepository: *multiRepo,
+				workers:         *workers,
+				queueSize:       *queueSize,
+				retries:         *updateRetries,
+				tlsCert:         *tlsCert,
+				tlsKey:          *tlsKey,
+				acmeCache:       *acmeCache,
+				trustProxy:      *trustProxy,
+				basePath:        *basePath,
+				reload:          reloadConfig,
+			}
+			if (*tlsCert == "") != (*tlsKey == "") || *tlsCert != "" && *acmeDomains != "" {
+				fmt.Println("Error: --tls-cert and --tls-key must be set together and can't be used with --acme-domain")
+				os.Exit(18)
+			}
+			for _, d := range strings.Split(*acmeDomains, ",") {
+				if d = strings.TrimSpace(d); d != "" {
+					serverOpts.acmeDomains = append(serverOpts.acmeDomains, d)
+				}
+			}
+			if len(serverOpts.acmeDomains) != 0 && serverOpts.acmeCache == "" {
+				dir, err := acmeCacheDir()
+				if err != nil {
+					fmt.Printf("Failed to find cache directory: %s\n", err)
+					os.Exit(18)
+				}
+				serverOpts.acmeCache = dir
+			}
+			if *workers < 1 || *queueSize < 1 || *updateRetries < 0 {
+				fmt.Println("Error: --workers and --queue-size must be positive, --update-retries can't be negative")
+				os.Exit(18)
+			}
+			var err error
+			if serverOpts.secrets.github, err = loadSecret(*githubSecret, *githubSecretFile); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(18)
+			}
+			if serverOpts.secrets.gitlab, err = loadSecret(*gitlabToken, *gitlabTokenFile); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(18)
+			}
+			if serverOpts.adminToken, err = loadSecret(*adminToken, *adminTokenFile); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(18)
+			}
+			if *sweepInterval != "" {
+				serverOpts.sweepInterval, err = time.ParseDuration(*sweepInterval)
+				if err != nil || serverOpts.sweepInterval <= 0 {
+					fmt.Printf("Invalid sweep interval '%s'\n", *sweepInterval)
+					os.Exit(18)
+				}
+			}
+			serverOpts.shutdownTimeout, err = time.ParseDuration(*shutdownTimeout)
+			if err != nil || serverOpts.shutdownTimeout <= 0 {
+				fmt.Printf("Invalid shutdown timeout '%s'\n", *shutdownTimeout)
+				os.Exit(18)
+			}
+			err = serve(config, repoPath, serverOpts, &pullRequestOptions{
+				close: *close,
+				sync:  *sync,
+			})
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(18)
+			}
+		}
+	})
+	app.Command("action", "Handle the pull request or issue event of a GitHub Actions workflow run", func(cmd *cli.Cmd) {
+		close := cmd.BoolOpt("close", false, "Close pull request if it has no matching segments")
+		lock := cmd.BoolOpt("lock", false, "Lock the conversation of the pull request closed by --close")
+		lockReason := cmd.StringOpt("lock-reason", lockReasonResolved, "Reason of locking the conversation: off-topic, too heated, resolved or spam")
+		dryRun := cmd.BoolOpt("dry-run", false, "Print the changes instead of applying them to the pull request or issue")
+		requireCoverage := cmd.BoolOpt("require-coverage", false, "Fail if any changed file doesn't belong to a segment")
+		checkRun := cmd.BoolOpt("check-run", false, "Publish the matching segments and the uncovered files as a check run of the pull request")
+		commitStatus := cmd.BoolOpt("commit-status", false, "Publish the coverage result as the chiefr/ownership commit status of the pull request")
+		annotations := cmd.BoolOpt("annotations", false, "Print the segments of the changed files and the uncovered files as GitHub Actions annotations")
+		sync := cmd.BoolOpt("sync", false, "Remove the labels, assignees and review requests chiefr applied which don't match the pull request anymore")
+		rotation := cmd.String(cli.StringOpt{Name: "rotation-state", EnvVar: "CHIEFR_ROTATION_STATE", Desc: "Path of the chief rotation state file of the round-robin assignment strategy (default: user cache directory)"})
+		cmd.Spec = "[--close [--lock [--lock-reason]]] [--dry-run] [--sync] [--require-coverage] [--check-run] [--commit-status] [--annotations] [--rotation-state]"
+		cmd.Action = func() {
+			if *lock && !validLockReason(*lockReason) {
+				fmt.Printf("Invalid lock reason '%s'\n", *lockReason)
+				os.Exit(19)
+			}
+			if err := config.setRotationState(*rotation); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(19)
+			}
+			err := runAction(config, repoPath, &pullRequestOptions{
+				close:           *close,
+				lock:            *lock,
+				lockReason:      *lockReason,
+				dryRun:          *dryRun,
+				sync:            *sync,
+				requireCoverage: *requireCoverage,
+				checkRun:        *checkRun,
+				commitStatus:    *commitStatus,
+				annotations:     *annotations,
+			})
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(19)
+			}
+		}
+	})
+	app.Command("update-issue", "Label and assign an issue according to the files and topics mentioned in it", func(cmd *cli.Cmd) {
+		issueURL := cmd.StringArg("ISSUE_URL", "", "URL of the issue")
+		dryRun := cmd.BoolOpt("dry-run", false, "Print the changes instead of applying them to the issue")
+		rotation := cmd.String(cli.StringOpt{Name: "rotation-state", EnvVar: "CHIEFR_ROTATION_STATE", Desc: "Path of the chief rotation state file of the round-robin assignment strategy (default: user cache directory)"})
+		cmd.Spec = "[--dry-run] [--rotation-state] ISSUE_URL"
+		cmd.Action = func() {
+			token, err := apiToken(*issueURL, "")
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(17)
+			}
+			if err := config.setRotationState(*rotation); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(17)
+			}
+			if err := updateIssue(config, *issueURL, token, *dryRun, "update-issue"); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(17)
+			}
+		}
+	})
+	app.Command("verify-approvals", "Fail until every matching segment of the pull request has the required approvals", func(cmd *cli.Cmd) {
+		ref := cmd.StringArg("REVISION", "", "Git revision of the patch's first commit or REV1..REV2 range")
+		prURL := cmd.StringArg("PULL_REQUEST_URL", "", "URL of the pull request")
+		key := cmd.StringArg("API_KEY", "", "API key of the project (deprecated, see --token-file)")
+		fetch := cmd.BoolOpt("fetch", false, "Fetch the head and the base branch of the pull request from the forge instead of using the local revisions")
+		merge := cmd.BoolOpt("merge", false, "Merge the pull request if it is approved and its checks passed")
+		autoMerge := cmd.BoolOpt("auto-merge", false, "Enable the auto-merge of the pull request if it is approved")
+		dryRun := cmd.BoolOpt("dry-run", false, "Print the merge instead of merging")
+		source := patchFileOpt(cmd, func() *changeSource { return &changeSource{kind: committedChanges} })
+		cmd.Spec = "[--merge | --auto-merge] [--dry-run] [--fetch | --patch-file] [REVISION] PULL_REQUEST_URL [API_KEY]"
+		cmd.Action = func() {
+			shiftTokenArgument(ref, prURL, key)
+			if *fetch && *ref != "" {
+				fmt.Println("REVISION can't be specified with --fetch")
+				os.Exit(15)
+			}
+			token, err := apiToken(*prURL, *key)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(15)
+			}
+			mode := ""
+			switch {
+			case *merge:
+				mode = mergeNow
+			case *autoMerge:
+				mode = mergeAuto
+			}
+			err = verifyApprovals(config, repoPath, *ref, source(), *prURL, token, *fetch, mode, *dryRun)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(15)
+			}
+		}
+	})
+	app.Command("version", "Chiefr version information", func(cmd *cli.Cmd) {
 		cmd.Action = func() {
-			err := list(config, "./", *path)
+			fmt.Printf("Chiefr v%s\n", VERSION)
+		}
+	})
+
+	app.Action = func() {
+		app.PrintHelp()
+	}
+
+	app.Run(os.Args)
+}
+
+func (s *ProjectSegment) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("[%s]\n", s.Name))
+	buf.WriteString(fmt.Sprintf(" Chiefs: %s\n", strings.Join(s.Chiefs, ", ")))
+	buf.WriteString(fmt.Sprintf(" Priority: %d\n", s.Priority))
+	if len(s.Topics) != 0 {
+		buf.WriteString(fmt.Sprintf(" Topics: %s\n", strings.Join(s.Topics, ", ")))
+	}
+	if len(s.Reviewers) != 0 {
+		buf.WriteString(fmt.Sprintf(" Reviewers: %s\n", strings.Join(s.Reviewers, ", ")))
+	}
+	if s.Repository != "" {
+		buf.WriteString(fmt.Sprintf(" Repository: %s\n", s.Repository))
+	}
+	if s.IssueTracker != "" {
+		buf.WriteString(fmt.Sprintf(" Issue tracker: %s\n", s.IssueTracker))
+	}
+	if s.MailList != "" {
+		buf.WriteString(fmt.Sprintf(" Mailing list: %s\n", s.MailList))
+	}
+	if s.Chat != "" {
+		buf.WriteString(fmt.Sprintf(" Chat: %s\n", s.Chat))
+	}
+	if s.Forum != "" {
+		buf.WriteString(fmt.Sprintf(" Forum: %s\n", s.Forum))
+	}
+	if s.Contributing != "" {
+		buf.WriteString(fmt.Sprintf(" Contribution guide: %s\n", s.Contributing))
+	}
+	if s.Milestone != "" {
+		buf.WriteString(fmt.Sprintf(" Milestone: %s\n", s.Milestone))
+	}
+	if len(s.QATags) != 0 {
+		buf.WriteString(fmt.Sprintf(" Q&A tags: %s\n", strings.Join(s.QATags, ", ")))
+	}
+	if len(s.Reviewers) != 0 {
+		buf.WriteString(fmt.Sprintf(" Reviewers: %s\n", strings.Join(s.Reviewers, ", ")))
+	}
+	if len(s.FilePatterns) != 0 {
+		buf.WriteString(fmt.Sprintf(" File patterns: %s\n", strings.Join(s.FilePatterns, ", ")))
+	}
+	if len(s.ContentPatterns) != 0 {
+		buf.WriteString(fmt.Sprintf(" Content patterns: %s\n", strings.Join(s.ContentPatterns, ", ")))
+	}
+	if len(s.FileContentPatterns) != 0 {
+		buf.WriteString(fmt.Sprintf(" File content patterns: %s\n", strings.Join(s.FileContentPatterns, ", ")))
+	}
+	if len(s.SymbolPatterns) != 0 {
+		buf.WriteString(fmt.Sprintf(" Symbol patterns: %s\n", strings.Join(s.SymbolPatterns, ", ")))
+	}
+	if len(s.FileExcludePatterns) != 0 {
+		buf.WriteString(fmt.Sprintf(" File exclude patterns: %s\n", strings.Join(s.FileExcludePatterns, ", ")))
+	}
+	if len(s.FileGlobs) != 0 {
+		buf.WriteString(fmt.Sprintf(" File globs: %s\n", strings.Join(s.FileGlobs, ", ")))
+	}
+	if len(s.ContentExcludePatterns) != 0 {
+		buf.WriteString(fmt.Sprintf(" Content exclude patterns: %s\n", strings.Join(s.ContentExcludePatterns, ", ")))
+	}
+	return buf.String()
+}
+
+func (s *ProjectSegment) HasTopic(topic string) bool {
+	for _, t := range s.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// fileNameSegments returns the segments matching the file name ordered by priority
+func (c *Config) fileNameSegments(path string) orderedSegmentList {
+	segments := make(orderedSegmentList, 0)
+	for _, s := range c.Segments {
+		if s.IsFileNameMatch(path) {
+			segments = append(segments, s)
+		}
+	}
+	sort.Sort(segments)
+	if len(segments) == 0 {
+		return c.fallbackSegments()
+	}
+	if c.Settings.MatchStrategy == matchStrategyClosest {
+		segments = closestSegments(segments, func(s *ProjectSegment) int {
+			return s.fileNameMatch(path).matchDepth(path)
+		})
+	}
+	return exclusiveSegments(segments)
+}
+
+// closestSegments keeps the segments matching the deepest directory,
+// segments with negative depth are not matched by file name and are kept
+func closestSegments(segments orderedSegmentList, depth func(*ProjectSegment) int) orderedSegmentList {
+	depths := make([]int, len(segments))
+	max := -1
+	for i, s := range segments {
+		depths[i] = depth(s)
+		if depths[i] > max {
+			max = depths[i]
+		}
+	}
+	closest := make(orderedSegmentList, 0, len(segments))
+	for i, s := range segments {
+		if depths[i] < 0 || depths[i] == max {
+			closest = append(closest, s)
+		}
+	}
+	return closest
+}
+
+// fallbackSegments returns the segments claiming the files not matching any other segment
+func (c *Config) fallbackSegments() orderedSegmentList {
+	segments := make(orderedSegmentList, 0)
+	for _, s := range sortedSegments(c.Segments) {
+		if s.Fallback {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// exclusiveSegments drops the segments with lower priority than the first exclusive segment,
+// segments must be ordered by priority
+func exclusiveSegments(segments orderedSegmentList) orderedSegmentList {
+	for i, s := range segments {
+		if !s.Exclusive {
+			continue
+		}
+		end := i + 1
+		for end < len(segments) && segments[end].Priority == s.Priority {
+			end++
+		}
+		return segments[:end]
+	}
+	return segments
+}
+
+func (s *ProjectSegment) IsFileNameMatch(path string) bool {
+	return s.fileNameMatch(path) != nil
+}
+
+// fileNameMatch returns the first file pattern matching the path or nil
+func (s *ProjectSegment) fileNameMatch(path string) *pattern {
+	for _, fp := range s.filePatterns {
+		if !fp.MatchString(path) {
+			continue
+		}
+		if s.fileNameExclude(path) == nil {
+			return fp
+		}
+	}
+	return nil
+}
+
+// fileNameExclude returns the first file exclude pattern matching the path or nil
+func (s *ProjectSegment) fileNameExclude(path string) *pattern {
+	for _, fep := range s.fileExcludePatterns {
+		if fep.MatchString(path) {
+			return fep
+		}
+	}
+	return nil
+}
+
+// compile compiles the file, glob and content patterns of the segment
+func (s *ProjectSegment) compile() error {
+	flags := ""
+	if s.CaseInsensitive {
+		flags = "(?i)"
+	}
+	filePatternFormat := "%s"
+	if s.AnchorPatterns {
+		filePatternFormat = "^(?:%s)$"
+	}
+	compile := func(key string, patterns []string, format string) ([]*pattern, error) {
+		compiled := make([]*pattern, 0, len(patterns))
+		for _, p := range patterns {
+			cp, err := newPattern(key, p, flags+fmt.Sprintf(format, p))
 			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(3)
+				return nil, fmt.Errorf("invalid '%s' pattern '%s': %s", key, p, err)
 			}
+			compiled = append(compiled, cp)
 		}
-	})
-	app.Command("submit", "Submit patches to maintainers", func(cmd *cli.Cmd) {
-		ref := cmd.StringArg("REVISION", "master", "Git revision of the patch's first commit")
-		cmd.Spec = "[REVISION]"
-		cmd.Action = func() {
-			err := submit(config, "./", *ref)
+		return compiled, nil
+	}
+	var err error
+	if s.filePatterns, err = compile("FilePatterns", s.FilePatterns, filePatternFormat); err != nil {
+		return err
+	}
+	if s.fileExcludePatterns, err = compile("FileExcludePatterns", s.FileExcludePatterns, filePatternFormat); err != nil {
+		return err
+	}
+	if s.contentPatterns, err = compile("ContentPatterns", s.ContentPatterns, "(?m).*%s.*"); err != nil {
+		return err
+	}
+	if s.fileContentPatterns, err = compile("FileContentPatterns", s.FileContentPatterns, "(?m)%s"); err != nil {
+		return err
+	}
+	if s.symbolPatterns, err = compile("SymbolPatterns", s.SymbolPatterns, "%s"); err != nil {
+		return err
+	}
+	if s.contentExcludePatterns, err = compile("ContentExcludePatterns", s.ContentExcludePatterns, "%s"); err != nil {
+		return err
+	}
+	if s.messagePatterns, err = compile("MessagePatterns", s.MessagePatterns, "(?m)%s"); err != nil {
+		return err
+	}
+	if s.binaryPatterns, err = compile("BinaryPatterns", s.BinaryPatterns, filePatternFormat); err != nil {
+		return err
+	}
+	s.patternWeights = make(map[string]float64, len(s.PatternWeights))
+	for _, pw := range s.PatternWeights {
+		i := strings.LastIndex(pw, "=")
+		if i == -1 {
+			return fmt.Errorf("invalid 'PatternWeights' value '%s': missing weight", pw)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(pw[i+1:]), 64)
+		if err != nil || weight < 0 {
+			return fmt.Errorf("invalid 'PatternWeights' value '%s': invalid weight", pw)
+		}
+		s.patternWeights[strings.TrimSpace(pw[:i])] = weight
+	}
+	for _, g := range s.FileGlobs {
+		exclude := strings.HasPrefix(g, "!")
+		cp, err := newPattern("FileGlobs", g, flags+globToRegexp(strings.TrimPrefix(g, "!")))
+		if err != nil {
+			return fmt.Errorf("invalid 'FileGlobs' glob '%s': %s", g, err)
+		}
+		if exclude {
+			s.fileExcludePatterns = append(s.fileExcludePatterns, cp)
+		} else {
+			s.filePatterns = append(s.filePatterns, cp)
+		}
+	}
+	return nil
+}
+
+func (s *ProjectSegment) IsConcerned(p diff.FilePatch, path string) bool {
+	return s.attribute(p, path, nil) != nil
+}
+
+// findRepositoryRoot returns the path of the closest directory containing .git walking up from the
+// working directory like git, the working directory is returned if it is not inside a repository
+func findRepositoryRoot() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	for dir := wd; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			if rel, err := filepath.Rel(wd, dir); err == nil {
+				return rel
+			}
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "."
+		}
+		dir = parent
+	}
+}
+
+// findMaintainersFile returns the first existing default maintainers file of the repository
+func findMaintainersFile(repoPath string) (string, error) {
+	for _, l := range maintainersFileLocations {
+		f := filepath.Join(repoPath, l)
+		if _, err := os.Stat(f); err == nil {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("Failed to find maintainers file in %s", strings.Join(maintainersFileLocations, ", "))
+}
+
+func initMaintainers(maintainersFileName string, offline bool) (*Config, error) {
+	return loadMaintainers(maintainersFileName, offline, nil)
+}
+
+// loadMaintainers loads the maintainers file and the organization maintainers file under it,
+// parents are the maintainers files overlaid on the loaded one
+func loadMaintainers(maintainersFileName string, offline bool, parents []string) (*Config, error) {
+	var source interface{} = maintainersFileName
+	if isRemoteFile(maintainersFileName) {
+		content, err := loadRemoteFile(maintainersFileName, offline)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to initialize maintainers: %s", err.Error())
+		}
+		source = content
+	}
+	return parseMaintainers(maintainersFileName, source, offline, parents)
+}
+
+// resolvePath returns the path or URL referenced by the maintainers file relative to the maintainers file
+func resolvePath(maintainersFileName, path string) string {
+	if path == "" || isRemoteFile(path) || filepath.IsAbs(path) {
+		return path
+	}
+	if isRemoteFile(maintainersFileName) {
+		base, err := url.Parse(maintainersFileName)
+		if err != nil {
+			return path
+		}
+		ref, err := url.Parse(filepath.ToSlash(path))
+		if err != nil {
+			return path
+		}
+		return base.ResolveReference(ref).String()
+	}
+	return filepath.Join(filepath.Dir(maintainersFileName), path)
+}
+
+// loadTreeMaintainers loads the first existing default maintainers file of the HEAD tree,
+// the files of sparse checkouts may be missing from the working tree, the name is empty if there is no such file
+// and it's joined to the repository path otherwise
+func loadTreeMaintainers(repoPath string, offline bool) (string, *Config, error) {
+	tree, err := getHeadTree(repoPath)
+	if err != nil {
+		return "", nil, nil
+	}
+	for _, l := range maintainersFileLocations {
+		f, err := tree.File(l)
+		if err != nil {
+			continue
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return "", nil, fmt.Errorf("Failed to read maintainers file %s of HEAD: %s", l, err)
+		}
+		name := filepath.Join(repoPath, l)
+		c, err := parseMaintainers(name, []byte(content), offline, nil)
+		return name, c, err
+	}
+	return "", nil, nil
+}
+
+// parseMaintainers parses the maintainers file source, the path, URL or content of the file
+func parseMaintainers(maintainersFileName string, source interface{}, offline bool, parents []string) (*Config, error) {
+	cfg, err := ini.Load(source)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize maintainers: %s", err.Error())
+	}
+	c := &Config{Segments: ProjectSegments{}, ShadowSegments: ProjectSegments{}, offline: offline}
+	for _, s := range cfg.Sections() {
+		if s.Name() == ini.DEFAULT_SECTION {
+			continue
+		}
+		if s.Name() == settingsSection {
+			err := s.MapTo(&c.Settings)
 			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(4)
+				return nil, fmt.Errorf("Failed to parse config section '%s': %s", s.Name(), err)
 			}
+			continue
 		}
-	})
-	app.Command("update-pull-request", "Update pull request chiefs and topics according to the maintainers file", func(cmd *cli.Cmd) {
-		ref := cmd.StringArg("REVISION", "", "Git revision of the patch's first commit")
-		repo := cmd.StringArg("PULL_REQUEST_URL", "", "URL of the pull request")
-		key := cmd.StringArg("API_KEY", "", "API key of the project")
-		close := cmd.BoolOpt("close", false, "Close pull request if it has no matching segments")
-		cmd.Action = func() {
-			err := checkPullRequest(config, "./", *ref, *repo, *key, *close)
+		if s.Name() == repositoriesSection {
+			c.Repositories = s.KeysHash()
+			continue
+		}
+		if s.Name() == commentsSection {
+			c.CommentTemplates = s.KeysHash()
+			for name := range c.CommentTemplates {
+				if _, found := defaultCommentTemplates[name]; !found {
+					return nil, fmt.Errorf("Invalid config section '%s': unknown comment template '%s'", s.Name(), name)
+				}
+			}
+			continue
+		}
+		if s.Name() == labelsSection {
+			c.Labels = make(map[string]*labelStyle)
+			for _, k := range s.Keys() {
+				c.Labels[k.Name()], err = parseLabelStyle(k.Value())
+				if err != nil {
+					return nil, fmt.Errorf("Invalid config section '%s': label '%s': %s", s.Name(), k.Name(), err)
+				}
+			}
+			continue
+		}
+		if s.Name() == unavailableSection {
+			c.Unavailable = make(map[string]time.Time)
+			for _, k := range s.Keys() {
+				c.Unavailable[k.Name()], err = parseUnavailable(k.Value())
+				if err != nil {
+					return nil, fmt.Errorf("Invalid config section '%s': invalid date of '%s': %s", s.Name(), k.Name(), err)
+				}
+			}
+			continue
+		}
+		if s.Name() == teamsSection {
+			c.Teams = make(map[string][]string)
+			for _, k := range s.Keys() {
+				c.Teams[k.Name()] = k.Strings(",")
+			}
+			continue
+		}
+		// template sections are only used through 'Extends'
+		if s.HasKey("Template") && s.Key("Template").MustBool(false) {
+			continue
+		}
+		ps := &ProjectSegment{Name: s.Name()}
+		err := cfg.Section(ini.DEFAULT_SECTION).MapTo(ps)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse config section '%s': %s", ini.DEFAULT_SECTION, err)
+		}
+		err = mapSection(cfg, s, ps, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		if len(ps.Chiefs) == 0 {
+			return nil, fmt.Errorf("Invalid config section '%s': missing 'Chiefs' property", s.Name())
+		}
+		err = ps.compile()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid config section '%s': %s", s.Name(), err)
+		}
+		if ps.AssignStrategy != "" && !validAssignStrategy(ps.AssignStrategy) {
+			return nil, fmt.Errorf("Invalid config section '%s': unknown 'AssignStrategy' '%s'", s.Name(), ps.AssignStrategy)
+		}
+		if ps.Project != "" {
+			if _, _, _, err := parseGitHubProjectURL(ps.Project); err != nil {
+				return nil, fmt.Errorf("Invalid config section '%s': 'Project': %s", s.Name(), err)
+			}
+		}
+		if ps.MaxAssignees < 0 || ps.MaxLabels < 0 || ps.RequiredApprovals < 0 {
+			return nil, fmt.Errorf("Invalid config section '%s': 'MaxAssignees', 'MaxLabels' and 'RequiredApprovals' can't be negative", s.Name())
+		}
+		if ps.Shadow {
+			if ps.ShadowUntil == "" {
+				return nil, fmt.Errorf("Invalid config section '%s': missing 'ShadowUntil' property", s.Name())
+			}
+			ps.shadowUntil, err = time.Parse(shadowDateFormat, ps.ShadowUntil)
 			if err != nil {
-				fmt.Println(err.Error())
-				os.Exit(5)
+				return nil, fmt.Errorf("Invalid config section '%s': invalid 'ShadowUntil' date: %s", s.Name(), err)
 			}
+			c.ShadowSegments[s.Name()] = ps
+			continue
 		}
-	})
-	app.Command("version", "Chiefr version information", func(cmd *cli.Cmd) {
-		cmd.Action = func() {
-			fmt.Printf("Chiefr v%s\n", VERSION)
+		c.Segments[s.Name()] = ps
+	}
+	// the paths of the maintainers file are relative to its directory, not to the working directory
+	for r, f := range c.Repositories {
+		c.Repositories[r] = resolvePath(maintainersFileName, f)
+	}
+	c.Settings.CommentTemplates = resolvePath(maintainersFileName, c.Settings.CommentTemplates)
+	c.Settings.Organization = resolvePath(maintainersFileName, c.Settings.Organization)
+	var org *Config
+	if c.Settings.Organization != "" {
+		for _, p := range append(parents, maintainersFileName) {
+			if p == c.Settings.Organization {
+				return nil, fmt.Errorf("Circular organization maintainers file reference '%s'", p)
+			}
+		}
+		org, err = loadMaintainers(c.Settings.Organization, offline, append(parents, maintainersFileName))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load organization maintainers file: %s", err)
+		}
+		for name, members := range org.Teams {
+			if c.Teams == nil {
+				c.Teams = make(map[string][]string)
+			}
+			if _, found := c.Teams[name]; !found {
+				c.Teams[name] = members
+			}
+		}
+		for name, text := range org.CommentTemplates {
+			if c.CommentTemplates == nil {
+				c.CommentTemplates = make(map[string]string)
+			}
+			if _, found := c.CommentTemplates[name]; !found {
+				c.CommentTemplates[name] = text
+			}
+		}
+		for user, until := range org.Unavailable {
+			if c.Unavailable == nil {
+				c.Unavailable = make(map[string]time.Time)
+			}
+			if _, found := c.Unavailable[user]; !found {
+				c.Unavailable[user] = until
+			}
+		}
+		for name, style := range org.Labels {
+			if c.Labels == nil {
+				c.Labels = make(map[string]*labelStyle)
+			}
+			if _, found := c.Labels[name]; !found {
+				c.Labels[name] = style
+			}
+		}
+	}
+	for _, segments := range []ProjectSegments{c.Segments, c.ShadowSegments} {
+		for _, ps := range segments {
+			ps.Chiefs, err = c.expandTeams(ps.Chiefs, nil)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid config section '%s': %s", ps.Name, err)
+			}
+			ps.Reviewers, err = c.expandTeams(ps.Reviewers, nil)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid config section '%s': %s", ps.Name, err)
+			}
+		}
+	}
+	if org != nil {
+		// repository segments override the organization segments with the same name
+		for name, ps := range org.Segments {
+			if !c.hasSegment(name) {
+				c.Segments[name] = ps
+			}
+		}
+		for name, ps := range org.ShadowSegments {
+			if !c.hasSegment(name) {
+				c.ShadowSegments[name] = ps
+			}
 		}
-	})
-
-	app.Action = func() {
-		app.PrintHelp()
 	}
-
-	app.Run(os.Args)
-}
-
-func (s *ProjectSegment) String() string {
-	var buf bytes.Buffer
-	buf.WriteString(fmt.Sprintf("[%s]\n", s.Name))
-	buf.WriteString(fmt.Sprintf(" Chiefs: %s\n", strings.Join(s.Chiefs, ", ")))
-	buf.WriteString(fmt.Sprintf(" Priority: %d\n", s.Priority))
-	if len(s.Topics) != 0 {
-		buf.WriteString(fmt.Sprintf(" Topics: %s\n", strings.Join(s.Topics, ", ")))
+	if c.Settings.Version == 0 {
+		c.Settings.Version = 1
 	}
-	if len(s.Reviewers) != 0 {
-		buf.WriteString(fmt.Sprintf(" Reviewers: %s\n", strings.Join(s.Reviewers, ", ")))
+	if c.Settings.Version > configVersion {
+		return nil, fmt.Errorf("Maintainers file version %d is not supported, please upgrade chiefr", c.Settings.Version)
 	}
-	if s.Repository != "" {
-		buf.WriteString(fmt.Sprintf(" Repository: %s\n", s.Repository))
+	switch c.Settings.LabelStrategy {
+	case "":
+		c.Settings.LabelStrategy = labelStrategyTopics
+	case labelStrategyTopics, labelStrategySegment:
+	default:
+		return nil, fmt.Errorf("Invalid config section '%s': unknown 'LabelStrategy' '%s'", settingsSection, c.Settings.LabelStrategy)
 	}
-	if s.IssueTracker != "" {
-		buf.WriteString(fmt.Sprintf(" Issue tracker: %s\n", s.IssueTracker))
+	switch c.Settings.RankStrategy {
+	case "":
+		c.Settings.RankStrategy = rankStrategyPriority
+	case rankStrategyPriority, rankStrategyScore:
+	default:
+		return nil, fmt.Errorf("Invalid config section '%s': unknown 'RankStrategy' '%s'", settingsSection, c.Settings.RankStrategy)
 	}
-	if s.MailList != "" {
-		buf.WriteString(fmt.Sprintf(" Mailing list: %s\n", s.MailList))
+	if c.Settings.AssignStrategy == "" {
+		c.Settings.AssignStrategy = assignStrategyAll
 	}
-	if s.Chat != "" {
-		buf.WriteString(fmt.Sprintf(" Chat: %s\n", s.Chat))
+	if !validAssignStrategy(c.Settings.AssignStrategy) {
+		return nil, fmt.Errorf("Invalid config section '%s': unknown 'AssignStrategy' '%s'", settingsSection, c.Settings.AssignStrategy)
 	}
-	if len(s.Reviewers) != 0 {
-		buf.WriteString(fmt.Sprintf(" Reviewers: %s\n", strings.Join(s.Reviewers, ", ")))
+	if c.Settings.MaxAssignees < 0 || c.Settings.MaxLabels < 0 || c.Settings.RequiredApprovals < 0 {
+		return nil, fmt.Errorf("Invalid config section '%s': 'MaxAssignees', 'MaxLabels' and 'RequiredApprovals' can't be negative", settingsSection)
 	}
-	if len(s.FilePatterns) != 0 {
-		buf.WriteString(fmt.Sprintf(" File patterns: %s\n", strings.Join(s.FilePatterns, ", ")))
+	if c.Settings.MaxAssignees == 0 || c.Settings.MaxAssignees > maxGitHubAssignees {
+		c.Settings.MaxAssignees = maxGitHubAssignees
 	}
-	if len(s.ContentPatterns) != 0 {
-		buf.WriteString(fmt.Sprintf(" Content patterns: %s\n", strings.Join(s.ContentPatterns, ", ")))
+	for _, s := range c.Segments {
+		if err := c.checkRequiredApprovals(s); err != nil {
+			return nil, fmt.Errorf("Invalid config section '%s': %s", s.Name, err)
+		}
 	}
-	if len(s.FileExcludePatterns) != 0 {
-		buf.WriteString(fmt.Sprintf(" File exclude patterns: %s\n", strings.Join(s.FileExcludePatterns, ", ")))
+	c.Settings.sizeLabels, err = parseSizeLabels(c.Settings.SizeLabels)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid config section '%s': 'SizeLabels': %s", settingsSection, err)
 	}
-	if len(s.ContentExcludePatterns) != 0 {
-		buf.WriteString(fmt.Sprintf(" Content exclude patterns: %s\n", strings.Join(s.ContentExcludePatterns, ", ")))
+	switch c.Settings.WrongRepositoryAction {
+	case "":
+		c.Settings.WrongRepositoryAction = wrongRepositoryClose
+	case wrongRepositoryClose, wrongRepositoryComment:
+	default:
+		return nil, fmt.Errorf("Invalid config section '%s': unknown 'WrongRepositoryAction' '%s'", settingsSection, c.Settings.WrongRepositoryAction)
 	}
-	return buf.String()
+	switch c.Settings.SuggestRepositories {
+	case "":
+		c.Settings.SuggestRepositories = suggestFirstRepository
+	case suggestFirstRepository, suggestAllRepositories:
+	default:
+		return nil, fmt.Errorf("Invalid config section '%s': unknown 'SuggestRepositories' '%s'", settingsSection, c.Settings.SuggestRepositories)
+	}
+	switch c.Settings.DraftPolicy {
+	case "":
+		c.Settings.DraftPolicy = draftPolicyAssign
+	case draftPolicyAssign, draftPolicyLabel, draftPolicySkip:
+	default:
+		return nil, fmt.Errorf("Invalid config section '%s': unknown 'DraftPolicy' '%s'", settingsSection, c.Settings.DraftPolicy)
+	}
+	switch c.Settings.MergeMethod {
+	case "":
+		c.Settings.MergeMethod = "merge"
+	case "merge", "squash", "rebase":
+	default:
+		return nil, fmt.Errorf("Invalid config section '%s': unknown 'MergeMethod' '%s'", settingsSection, c.Settings.MergeMethod)
+	}
+	switch c.Settings.MatchStrategy {
+	case "":
+		c.Settings.MatchStrategy = matchStrategyAll
+	case matchStrategyAll, matchStrategyClosest:
+	default:
+		return nil, fmt.Errorf("Invalid config section '%s': unknown 'MatchStrategy' '%s'", settingsSection, c.Settings.MatchStrategy)
+	}
+	if err := c.parseCommentTemplates(); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
-func (s *ProjectSegment) IsFileNameMatch(path string) bool {
-	for _, fp := range s.FilePatterns {
-		if match, err := regexp.MatchString(fp, path); !match || err != nil {
-			continue
+// getLabels returns the labels of the segments according to the labeling strategy,
+// segments must be ordered by priority
+func (s *Settings) getLabels(segments orderedSegmentList) []string {
+	labels := make([]string, 0)
+	usedGroups := make(map[string]bool)
+	for _, seg := range segments {
+		segLabels := seg.Topics
+		if s.LabelStrategy == labelStrategySegment {
+			segLabels = []string{seg.Name}
 		}
-		excluded := false
-		for _, fep := range s.FileExcludePatterns {
-			if match, err := regexp.MatchString(fep, path); match && err == nil {
-				excluded = true
-				break
+		if seg.MaxLabels > 0 && len(segLabels) > seg.MaxLabels {
+			segLabels = segLabels[:seg.MaxLabels]
+		}
+		segGroups := make([]string, 0)
+		for _, l := range segLabels {
+			group := s.labelGroup(l)
+			if group != "" {
+				if usedGroups[group] {
+					continue
+				}
+				appendNew(&segGroups, group)
 			}
+			appendNew(&labels, s.LabelPrefix+l)
 		}
-		if !excluded {
-			return true
+		for _, g := range segGroups {
+			usedGroups[g] = true
 		}
 	}
-	return false
+	// the labels of the higher priority segments are kept
+	if s.MaxLabels > 0 && len(labels) > s.MaxLabels {
+		labels = labels[:s.MaxLabels]
+	}
+	return labels
 }
 
-func (s *ProjectSegment) IsConcerned(p diff.FilePatch, path string) bool {
-	if s.IsFileNameMatch(path) {
-		return true
+func (s *Settings) labelGroup(label string) string {
+	for _, g := range s.LabelGroups {
+		if strings.HasPrefix(label, g) {
+			return g
+		}
+	}
+	return ""
+}
+
+// mapSection maps the section and all the sections it extends to the segment,
+// properties of the extending section override the inherited ones
+func mapSection(cfg *ini.File, s *ini.Section, ps *ProjectSegment, visited map[string]bool) error {
+	if visited[s.Name()] {
+		return fmt.Errorf("Invalid config section '%s': circular 'Extends' property", s.Name())
+	}
+	visited[s.Name()] = true
+	if s.HasKey("Extends") {
+		parentName := s.Key("Extends").String()
+		parent, err := cfg.GetSection(parentName)
+		if err != nil {
+			return fmt.Errorf("Invalid config section '%s': cannot extend unknown section '%s'", s.Name(), parentName)
+		}
+		err = mapSection(cfg, parent, ps, visited)
+		if err != nil {
+			return err
+		}
+	}
+	err := s.MapTo(ps)
+	if err != nil {
+		return fmt.Errorf("Failed to parse config section '%s': %s", s.Name(), err)
 	}
-	// file name check
-	// TODO sophisticated content matching
-	var buffer bytes.Buffer
-	for _, chunk := range p.Chunks() {
-		// chunk.Type() -> 0: Equal, 1: Add, 2: Delete
-		buffer.WriteString(chunk.Content())
+	return nil
+}
 
+func (c *Config) hasSegment(name string) bool {
+	_, found := c.Segments[name]
+	if !found {
+		_, found = c.ShadowSegments[name]
 	}
-	diffContent := buffer.String()
-	// content match
-	for _, cp := range s.ContentPatterns {
-		if match, err := regexp.MatchString(cp, diffContent); !match || err != nil {
+	return found
+}
+
+// expandTeams replaces the team names with the members of the teams recursively,
+// GitHub team references (@org/team) are kept to be resolved by the project manager
+func (c *Config) expandTeams(members []string, parents []string) ([]string, error) {
+	expanded := make([]string, 0, len(members))
+	for _, m := range members {
+		team, found := c.Teams[m]
+		if !found {
+			appendNew(&expanded, m)
 			continue
 		}
-		excluded := false
-		for _, cep := range s.ContentExcludePatterns {
-			if match, err := regexp.MatchString(cep, diffContent); match && err == nil {
-				excluded = true
-				break
+		for _, p := range parents {
+			if p == m {
+				return nil, fmt.Errorf("circular team reference '%s'", m)
 			}
 		}
-		if !excluded {
-			return true
+		teamMembers, err := c.expandTeams(team, append(parents, m))
+		if err != nil {
+			return nil, err
+		}
+		for _, tm := range teamMembers {
+			appendNew(&expanded, tm)
 		}
 	}
-	return false
+	return expanded, nil
+}
+
+// Options of update-pull-request
+type pullRequestOptions struct {
+	// Close the pull request if it belongs to another repository
+	close bool
+	// Lock the conversation of the closed pull request with the reason
+	lock       bool
+	lockReason string
+	dryRun     bool
+	// Remove the labels and assignees of the segments not matching anymore
+	sync            bool
+	requireCoverage bool
+	// Fetch the pull request from the forge
+	fetch bool
+	// Routing directives applied after the directives of the description
+	directives *routingDirectives
+	// Users not assigned or requested to review
+	excludedUsers []string
+	// Publish the ownership report as a check run
+	checkRun bool
+	// Publish the ownership report as a commit status
+	commitStatus bool
+	// Print the ownership report as GitHub Actions annotations
+	annotations bool
+	// Event triggering the update, e.g. the command or the webhook, see audit
+	event string
+	// Notify the mailing lists of the matching segments, nil if they aren't notified
+	mail *smtpOptions
+}
+
+// pullRequestRevision returns the revision range of the pull request, the head and the base branch
+// are fetched from the forge with --fetch
+func pullRequestRevision(pm ProjectManager, repoPath, revision, prURL, APIKey string, opts *pullRequestOptions) (string, error) {
+	if !opts.fetch {
+		return revision, nil
+	}
+	refs, err := pm.PullRequestRefs(prURL)
+	if err != nil {
+		return "", err
+	}
+	return fetchPullRequest(repoPath, refs, APIKey)
 }
 
-func initMaintainers(maintainersFileName string) (*Config, error) {
-	cfg, err := ini.Load(maintainersFileName)
+// matchPullRequest returns the changes of the pull request and its ranked segments, the directives of its description,
+// the route recorded by the route slash command and the directives of the options are applied in that order
+func matchPullRequest(c *Config, pm ProjectManager, repoPath, revision string, source *changeSource, prURL, APIKey string, opts *pullRequestOptions) (*PatchInfo, orderedSegmentList, error) {
+	info, err := analyzeChanges(c, repoPath, revision, source)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to initialize maintainers: %s", err.Error())
+		return nil, nil, err
 	}
-	c := &Config{Segments: ProjectSegments{}}
-	for _, s := range cfg.Sections() {
-		if s.Name() == "DEFAULT" {
-			continue
+	segments := c.rankSegments(info)
+	// dry runs without API token can't read the description and the state comment
+	if opts.dryRun && APIKey == "" {
+		if opts.directives != nil {
+			segments = c.applyDirectives(segments, opts.directives)
 		}
-		ps := &ProjectSegment{Name: s.Name()}
-		err := s.MapTo(ps)
+		return info, segments, nil
+	}
+	if c.Settings.Directives {
+		description, err := pm.PullRequestDescription(prURL)
 		if err != nil {
-			return nil, fmt.Errorf("Failed to parse config section '%s': %s", s.Name(), err)
-		}
-		if len(ps.Chiefs) == 0 {
-			return nil, fmt.Errorf("Invalid config section '%s': missing 'Chiefs' property", s.Name())
-		}
-		for i, p := range ps.ContentPatterns {
-			ps.ContentPatterns[i] = fmt.Sprintf("(?m).*%s.*", p)
+			return nil, nil, err
 		}
-		c.Segments[s.Name()] = ps
+		segments = c.applyDirectives(segments, parseDirectives(description))
 	}
-	return c, nil
+	state, err := pm.PullRequestState(prURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(state.Route) != 0 {
+		segments = c.applyDirectives(segments, &routingDirectives{Include: state.Route})
+	}
+	if opts.directives != nil {
+		segments = c.applyDirectives(segments, opts.directives)
+	}
+	return info, segments, nil
 }
 
-func checkPullRequest(c *Config, repoPath, revision, prURL, APIKey string, close bool) error {
+func checkPullRequest(c *Config, repoPath, revision string, source *changeSource, prURL, APIKey string, opts *pullRequestOptions) error {
 	pm, err := getProjectManagerFromURL(prURL)
 	if err != nil {
 		return err
 	}
-	segments, _, err := getPatchInfo(c, repoPath, revision)
+	return checkPullRequestWith(pm, c, repoPath, revision, source, prURL, APIKey, opts)
+}
+
+// checkPullRequestWith updates the pull request with the manager, sweep reuses one manager,
+// so the cached loads of the users include the assignments of the earlier pull requests
+func checkPullRequestWith(pm ProjectManager, c *Config, repoPath, revision string, source *changeSource, prURL, APIKey string, opts *pullRequestOptions) error {
+	pm.SetAPIKey(APIKey)
+	pm.SetDryRun(opts.dryRun)
+	pm.SetSync(opts.sync)
+	pm.SetExcludedUsers(opts.excludedUsers)
+	pm.SetEvent(opts.event)
+	if opts.lock {
+		pm.SetLockReason(opts.lockReason)
+	}
+	revision, err := pullRequestRevision(pm, repoPath, revision, prURL, APIKey, opts)
+	if err != nil {
+		return err
+	}
+	info, segments, err := matchPullRequest(c, pm, repoPath, revision, source, prURL, APIKey, opts)
 	if err != nil {
 		return err
 	}
-	pm.SetAPIKey(APIKey)
-	return pm.HandlePullRequest(prURL, segments, close)
+	report := &ownershipReport{
+		Segments:          segments,
+		Uncovered:         info.uncoveredFiles(),
+		RequireCoverage:   opts.requireCoverage,
+		RequiredApprovals: make(map[string]int),
+	}
+	for _, s := range segments {
+		report.RequiredApprovals[s.Name] = c.requiredApprovals(s)
+	}
+	if opts.annotations {
+		writeAnnotations(os.Stdout, info, report)
+	}
+	if opts.checkRun {
+		if err := pm.PublishCheckRun(prURL, report); err != nil {
+			return err
+		}
+	}
+	if opts.commitStatus {
+		if err := pm.PublishCommitStatus(prURL, report); err != nil {
+			return err
+		}
+	}
+	if opts.requireCoverage {
+		if err := info.checkCoverage(); err != nil {
+			return err
+		}
+	}
+	if len(c.ShadowSegments) != 0 {
+		err = reportShadowSegments(pm, c, repoPath, revision, source, prURL)
+		if err != nil {
+			fmt.Println("Warning!", err.Error())
+		}
+	}
+	if opts.close && len(c.Repositories) != 0 {
+		err = checkRoutingLoop(c, repoPath, revision, source, pullRequestRepository(prURL), segments)
+		if err != nil {
+			return err
+		}
+	}
+	extraLabels := make([]string, 0)
+	if l := c.Settings.sizeLabel(info.Additions + info.Deletions); l != "" {
+		extraLabels = append(extraLabels, l)
+	}
+	if err := pm.HandlePullRequest(prURL, c, segments, extraLabels, opts.close); err != nil {
+		return err
+	}
+	// the pull requests closed as misdirected aren't announced on the mailing lists
+	if opts.mail != nil && !(opts.close && misdirected(prURL, segments)) {
+		return notifyMailLists(pm, c, prURL, info, segments, opts.mail, opts.dryRun, opts.event)
+	}
+	return nil
 }
 
 func appendNew(arr *[]string, s string) {
@@ -426,7 +3050,7 @@ func appendNew(arr *[]string, s string) {
 func ask(config *Config, topic string) error {
 	if topic == "" {
 		topics := make([]string, 0)
-		for _, s := range config.Segments {
+		for _, s := range sortedSegments(config.Segments) {
 			for _, t := range s.Topics {
 				appendNew(&topics, t)
 			}
@@ -438,24 +3062,33 @@ func ask(config *Config, topic string) error {
 		fmt.Println("Run `chiefr ask [topic]` to get issue trackers belongs to the topic")
 		return nil
 	}
-	os := make(orderedSegmentList, 0, len(config.Segments))
-	for _, s := range config.Segments {
-		os = append(os, s)
-	}
-	sort.Sort(os)
+	os := sortedSegments(config.Segments)
 	issueTrackers := make([]string, 0, len(config.Segments))
+	forums := make([]string, 0, len(config.Segments))
 	for _, s := range os {
-		if s.IssueTracker == "" {
+		if !s.HasTopic(topic) {
 			continue
 		}
-		for _, t := range s.Topics {
-			if t == topic {
-				appendNew(&issueTrackers, s.IssueTracker)
-				break
-			}
+		if s.IssueTracker != "" {
+			appendNew(&issueTrackers, s.IssueTracker)
+		}
+		if s.Forum != "" {
+			appendNew(&forums, s.Forum)
 		}
+		for _, t := range s.QATags {
+			appendNew(&forums, stackOverflowTagURL+url.PathEscape(t))
+		}
+	}
+	if len(forums) == 0 {
+		fmt.Println("Please submit your questions to one of the following issue trackers:")
+	} else {
+		fmt.Println("Please ask usage questions on one of the following forums:")
+		for _, f := range forums {
+			fmt.Println(" -", f)
+		}
+		fmt.Println()
+		fmt.Println("Please submit bug reports to one of the following issue trackers:")
 	}
-	fmt.Println("Please submit your questions to one of the following issue trackers:")
 	for _, it := range issueTrackers {
 		fmt.Println(" -", it)
 	}
@@ -463,62 +3096,129 @@ func ask(config *Config, topic string) error {
 	return nil
 }
 
-func list(c *Config, repoPath, pathRe string) error {
-	repo, err := git.PlainOpen(repoPath)
+// Git directory of the repository if it is not the .git directory of the work tree
+var gitDir string
+
+// openRepository opens the repository of the work tree, or of the git directory with the work tree if set
+func openRepository(repoPath string) (*git.Repository, error) {
+	if gitDir == "" {
+		return git.PlainOpen(repoPath)
+	}
+	if _, err := os.Stat(gitDir); err != nil {
+		return nil, err
+	}
+	storage := filesystem.NewStorage(osfs.New(gitDir), cache.NewObjectLRUDefault())
+	return git.Open(storage, osfs.New(repoPath))
+}
+
+func getHeadTree(repoPath string) (*object.Tree, error) {
+	repo, err := openRepository(repoPath)
 	if err != nil {
-		return fmt.Errorf("Failed to open git repository: %s", err.Error())
+		return nil, fmt.Errorf("Failed to open git repository: %s", err.Error())
 	}
+	return repoHeadTree(repo)
+}
+
+func repoHeadTree(repo *git.Repository) (*object.Tree, error) {
 	head, err := repo.Head()
 	if err != nil {
-		return fmt.Errorf("Failed to get HEAD reference: %s", err.Error())
+		return nil, fmt.Errorf("Failed to get HEAD reference: %s", err.Error())
 	}
 	headCommit, err := repo.CommitObject(head.Hash())
 	if err != nil {
-		return fmt.Errorf("Failed to get HEAD commit %s", err.Error())
+		return nil, fmt.Errorf("Failed to get HEAD commit %s", err.Error())
 	}
 	tree, err := headCommit.Tree()
 	if err != nil {
-		return fmt.Errorf("Failed to get files from repository: %s", err.Error())
+		return nil, fmt.Errorf("Failed to get files from repository: %s", err.Error())
 	}
-	tree.Files().ForEach(func(f *object.File) error {
-		if match, err := regexp.MatchString(pathRe, f.Name); !match || err != nil {
-			return nil
-		}
-		segments := make([]string, 0)
-		for _, s := range c.Segments {
-			if s.IsFileNameMatch(f.Name) {
-				segments = append(segments, s.Name)
-			}
+	return tree, nil
+}
+
+// list prints the segments of the files under the path prefix matching the regex,
+// the files of the HEAD tree are streamed to keep the memory use bounded
+func list(c *Config, repoPath, prefix, pathRe string, source *changeSource) error {
+	pathFilter, err := regexp.Compile(pathRe)
+	if err != nil {
+		return fmt.Errorf("Invalid path regex: %s", err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	printFile := func(f cachedTreeFile) {
+		if !pathFilter.MatchString(f.Path) {
+			return
 		}
+		segments := f.Segments
 		if len(segments) == 0 {
-			segments = append(segments, "[No segments found]")
+			segments = []string{"[No segments found]"}
 		}
-		fmt.Printf("%20s: %s\n", strings.Join(segments, ", "), f.Name)
-		return nil
-	})
+		fmt.Fprintf(out, "%20s: %s\n", strings.Join(segments, ", "), f.Path)
+	}
+	if source.kind == committedChanges {
+		tree, err := getHeadTree(repoPath)
+		if err != nil {
+			return err
+		}
+		return c.walkTreeSegments(tree, prefix, printFile)
+	}
+	paths, err := worktreePaths(repoPath, source.kind == stagedChanges)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		segments := make([]string, 0)
+		for _, s := range c.fileNameSegments(p) {
+			segments = append(segments, s.Name)
+		}
+		printFile(cachedTreeFile{Path: p, Segments: segments})
+	}
 	return nil
 }
 
-func submit(c *Config, repoPath, revision string) error {
-	segments, files, err := getPatchInfo(c, repoPath, revision)
+func submit(c *Config, repoPath, revision string, source *changeSource, requireCoverage bool) error {
+	info, err := analyzeChanges(c, repoPath, revision, source)
 	if err != nil {
 		return err
 	}
+	segments, files := info.Segments, info.Files
 	if len(files) == 0 {
 		return fmt.Errorf("No files to submit")
 	}
+	if requireCoverage {
+		if err := info.checkCoverage(); err != nil {
+			return err
+		}
+	}
 	if len(segments) == 0 {
 		return fmt.Errorf("No matching segments found for this patch")
 	}
-	os := make(orderedSegmentList, 0, len(segments))
-	for _, s := range segments {
-		os = append(os, s)
-	}
-	sort.Sort(os)
+	os := c.rankSegments(info)
 
 	fmt.Printf("The following files are affected by this patch: %s\n\n", strings.Join(files, ", "))
+	if len(info.Renames) != 0 {
+		fmt.Println("The following files are renamed by this patch:")
+		for _, f := range files {
+			if old, found := info.Renames[f]; found {
+				fmt.Printf(" - %s -> %s\n", old, f)
+			}
+		}
+		fmt.Println("")
+	}
+
+	fmt.Println("The patch concerns the following segments:")
+	for _, s := range os {
+		fmt.Printf(" - %s (%s)\n", s.Name, strings.Join(s.Chiefs, ", "))
+		for _, a := range info.segmentAttributions(s.Name) {
+			fmt.Printf("    %s\n", a)
+		}
+	}
+	fmt.Println("")
 
-	fmt.Println("Please submit your patch to one of the following repositories:\n")
+	fmt.Println("Please submit your patch to one of the following repositories:")
+	fmt.Println("")
 	for i, s := range os {
 		new := true
 		for _, s2 := range os[:i] {
@@ -535,80 +3235,236 @@ func submit(c *Config, repoPath, revision string) error {
 	return nil
 }
 
-func getPatchInfo(c *Config, repoPath, revision string) (ProjectSegments, []string, error) {
-	repo, err := git.PlainOpen(repoPath)
+func getPatchInfo(c *Config, repoPath, revision string, source *changeSource) (ProjectSegments, []string, error) {
+	info, err := analyzeChanges(c, repoPath, revision, source)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to open git repository:", err.Error())
+		return nil, nil, err
 	}
-	head, err := repo.Head()
+	return info.Segments, info.Files, nil
+}
+
+func analyzePatch(c *Config, repoPath, revision string) (*PatchInfo, error) {
+	repo, err := openRepository(repoPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to get HEAD of repository: %s", err.Error())
+		return nil, fmt.Errorf("Failed to open git repository: %s", err.Error())
+	}
+	from, to, symmetric := parseRevisionRange(revision)
+	// HEAD may be detached or missing if the end of the range is specified
+	if to == "" {
+		to = "HEAD"
+	}
+	headCommit, err := getCommitByRev(repo, to)
+	if err != nil {
+		return nil, shallowHint(repo, err)
+	}
+	var firstCommit *object.Commit
+	switch {
+	case from == "":
+		firstCommit, err = detectBase(repo, headCommit, c.Settings.BaseBranch)
+	case symmetric:
+		firstCommit, err = getCommitByRev(repo, from)
+		if err == nil {
+			firstCommit, err = mergeBase(headCommit, firstCommit)
+		}
+	default:
+		firstCommit, err = getCommitByRev(repo, from)
 	}
-	headCommit, err := repo.CommitObject(head.Hash())
 	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to get HEAD commit: %s", err.Error())
+		return nil, shallowHint(repo, err)
 	}
-	firstCommit, err := getCommitByRev(repo, revision)
+	firstTree, err := firstCommit.Tree()
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("Failed to get tree of commit %s: %s", firstCommit.Hash, err)
+	}
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get tree of commit %s: %s", headCommit.Hash, err)
+	}
+	patches, err := treePatches(firstTree, headTree)
+	if err != nil {
+		return nil, err
 	}
-	patch, err := firstCommit.Patch(headCommit)
+	commits, err := getRangeCommits(repo, headCommit, firstCommit)
 	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to create patch: %s", err.Error())
+		return nil, err
+	}
+	return attributePatch(c, newBlobReader(repo), patches, commits), nil
+}
+
+// attributePatch matches the file patches and the commit messages against the segments
+func attributePatch(c *Config, blobs *blobReader, patches []diff.FilePatch, commits []*object.Commit) *PatchInfo {
+	info := &PatchInfo{
+		Segments:     ProjectSegments{},
+		Files:        make([]string, 0),
+		Attributions: make([]*Attribution, 0),
+		Renames:      make(map[string]string),
+		Hidden:       make([]*Attribution, 0),
+		Scores:       make(map[string]float64),
+	}
+	renamed := detectRenames(patches)
+	info.Additions, info.Deletions = patchSize(renamed)
+	for _, f := range attributeFiles(c, blobs, renamed) {
+		appendNew(&info.Files, f.path)
+		if f.oldPath != "" {
+			info.Renames[f.path] = f.oldPath
+		}
+		for _, a := range f.attributions {
+			s := c.Segments[a.Segment]
+			info.Segments[a.Segment] = s
+			info.Scores[a.Segment] += s.weight(a.Pattern) * float64(f.lines)
+		}
+		info.Attributions = append(info.Attributions, f.attributions...)
+		info.Hidden = append(info.Hidden, f.hidden...)
 	}
-	relatedSegments := ProjectSegments{}
-	paths := make([]string, 0)
-	for _, p := range patch.FilePatches() {
-		from, to := p.Files()
-		// deletion
-		if to == nil {
-			to = from
+	if c.Settings.RecurseSubmodules && blobs != nil && blobs.repo != nil {
+		for _, p := range patches {
+			if !isSubmodulePatch(p) {
+				continue
+			}
+			path, sub, err := attributeSubmodule(c, blobs.repo, p)
+			if err != nil {
+				fmt.Printf("Warning! %s\n", err)
+				continue
+			}
+			if sub != nil {
+				info.addSubmodule(path, sub)
+			}
 		}
-		path := to.Path()
-		appendNew(&paths, path)
-		for sName, s := range c.Segments {
-			if s.IsConcerned(p, path) {
-				relatedSegments[sName] = s
+	}
+	for _, commit := range commits {
+		for _, s := range sortedSegments(c.Segments) {
+			if a := s.attributeMessage(commit); a != nil {
+				info.Segments[s.Name] = s
+				info.Scores[s.Name] += s.weight(a.Pattern)
+				info.Attributions = append(info.Attributions, a)
 			}
 		}
 	}
-	return relatedSegments, paths, nil
+	return info
 }
 
-func getCommitByRev(repo *git.Repository, revision string) (*object.Commit, error) {
-	head, err := repo.Head()
-	if err != nil {
-		return nil, fmt.Errorf("Failed to get HEAD of repository: %s", err.Error())
-	}
-	cIter, err := repo.Log(&git.LogOptions{From: head.Hash()})
-	if err != nil {
-		return nil, fmt.Errorf("Failed to get history of commit range %v..%s: %s", head, revision, err.Error())
-	}
-	var commit *object.Commit
-	err = cIter.ForEach(func(c *object.Commit) error {
-		if strings.HasPrefix(c.Hash.String(), revision) {
-			commit = c
-			return fmt.Errorf("stop")
+// Default branches checked in order if the base branch is not configured
+var defaultBaseBranches = []string{
+	"refs/remotes/upstream/HEAD",
+	"refs/remotes/origin/HEAD",
+	"refs/heads/main",
+	"refs/heads/master",
+	"refs/remotes/origin/main",
+	"refs/remotes/origin/master",
+}
+
+// baseBranchCandidates returns the branches checked in order if the base branch is not configured,
+// the target branch of the pull request is the first in detached CI checkouts without local branches
+func baseBranchCandidates() []string {
+	candidates := make([]string, 0, len(defaultBaseBranches)+1)
+	for _, env := range []string{"GITHUB_BASE_REF", "CI_MERGE_REQUEST_TARGET_BRANCH_NAME"} {
+		if b := os.Getenv(env); b != "" {
+			candidates = append(candidates, "refs/remotes/origin/"+b)
 		}
-		return nil
-	})
-	var rev *plumbing.Hash
-	if commit == nil {
-		rev, err = repo.ResolveRevision(plumbing.Revision(revision))
+	}
+	return append(candidates, defaultBaseBranches...)
+}
+
+// detectBase returns the merge base of HEAD and the base branch,
+// the first existing default branch is used if the base branch is not configured
+func detectBase(repo *git.Repository, head *object.Commit, baseBranch string) (*object.Commit, error) {
+	var base *object.Commit
+	if baseBranch != "" {
+		c, err := getCommitByRev(repo, baseBranch)
 		if err != nil {
-			rev, err = repo.ResolveRevision(plumbing.Revision("refs/heads/" + revision))
+			return nil, fmt.Errorf("Failed to resolve base branch: %s", err)
+		}
+		base = c
+	} else {
+		for _, b := range baseBranchCandidates() {
+			ref, err := repo.Reference(plumbing.ReferenceName(b), true)
 			if err != nil {
-				ref, err := repo.Reference(plumbing.ReferenceName("refs/remotes/"+revision), true)
-				if err != nil {
-					return nil, fmt.Errorf("Failed to resolve revision '%s'", revision)
-				}
-				*rev = ref.Hash()
+				continue
+			}
+			c, err := repo.CommitObject(ref.Hash())
+			if err != nil {
+				continue
 			}
+			base = c
+			break
 		}
-		commit, err = repo.CommitObject(*rev)
-		if err != nil {
-			return nil, fmt.Errorf("Failed to resolve revision '%s'", revision)
+		if base == nil {
+			return nil, errors.New("Failed to detect base branch, specify the revision or set 'BaseBranch' in the maintainers file")
 		}
 	}
-	return commit, nil
+	return mergeBase(head, base)
+}
+
+func mergeBase(a, b *object.Commit) (*object.Commit, error) {
+	bases, err := a.MergeBase(b)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find merge base of %s and %s: %s", a.Hash, b.Hash, err)
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("%s has no common history with %s", a.Hash, b.Hash)
+	}
+	return bases[0], nil
+}
+
+// parseRevisionRange splits the REV1..REV2 and REV1...REV2 revision ranges,
+// symmetric is true for the latter which starts at the merge base of the revisions,
+// a single revision is the first commit of the range ending at HEAD, omitted range ends are HEAD
+func parseRevisionRange(revision string) (from, to string, symmetric bool) {
+	sep := "..."
+	i := strings.Index(revision, sep)
+	if i == -1 {
+		sep = ".."
+		i = strings.Index(revision, sep)
+	}
+	if i == -1 {
+		return revision, "", false
+	}
+	from, to = revision[:i], revision[i+len(sep):]
+	if from == "" {
+		from = "HEAD"
+	}
+	return from, to, sep == "..."
+}
+
+// shallowHint extends the error of resolving revisions with the instructions to fetch the missing history of shallow clones
+func shallowHint(repo *git.Repository, err error) error {
+	shallows, shallowErr := repo.Storer.Shallow()
+	if shallowErr != nil || len(shallows) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s\nThe repository is a shallow clone and the revision is missing from the fetched history. "+
+		"Fetch the missing history with `git fetch --deepen=N` or `git fetch --unshallow` "+
+		"(e.g. set `fetch-depth: 0` for actions/checkout in GitHub Actions)", err)
+}
+
+// getRangeCommits returns the commits reachable from head but not from first, newest first,
+// first must be an ancestor of head
+func getRangeCommits(repo *git.Repository, head, first *object.Commit) ([]*object.Commit, error) {
+	ancestor, err := first.IsAncestor(head)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get history of commit range %s..%s: %s", first.Hash, head.Hash, err.Error())
+	}
+	if !ancestor {
+		return nil, fmt.Errorf("Commit %s is not an ancestor of %s, use the REV1...REV2 range to compare from their merge base", first.Hash, head.Hash)
+	}
+	// the ancestors of first are collected up front and the history of head is walked by commit
+	// time like `git rev-list` without entering them, so merged branches forking before first
+	// and commits with skewed dates can't pull the history before the range into it
+	excluded := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(first, nil, nil).ForEach(func(c *object.Commit) error {
+		excluded[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get history of commit range %s..%s: %s", first.Hash, head.Hash, err.Error())
+	}
+	commits := make([]*object.Commit, 0)
+	err = object.NewCommitIterCTime(head, excluded, nil).ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get history of commit range %s..%s: %s", first.Hash, head.Hash, err.Error())
+	}
+	return commits, nil
 }
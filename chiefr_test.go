@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestGetRangeCommits(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	commit := func(msg string, hour int, parents ...plumbing.Hash) plumbing.Hash {
+		sig := &object.Signature{Name: "alice", Email: "alice@example.com", When: base.Add(time.Duration(hour) * time.Hour)}
+		h, err := w.Commit(msg, &git.CommitOptions{Author: sig, Committer: sig, Parents: parents})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	// b is an ancestor of first dated after the range, so it is walked before first
+	a := commit("a", 1)
+	b := commit("b", 10, a)
+	first := commit("first", 3, b)
+	side := commit("side", 4, b)
+	head := commit("head", 11, first, side)
+	unrelated := commit("unrelated", 12, a)
+	get := func(h plumbing.Hash) *object.Commit {
+		c, err := repo.CommitObject(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	tests := []struct {
+		name    string
+		head    plumbing.Hash
+		first   plumbing.Hash
+		want    []string
+		wantErr bool
+	}{
+		{name: "skewed commit dates", head: head, first: first, want: []string{"head", "side"}},
+		{name: "linear range", head: first, first: a, want: []string{"first", "b"}},
+		{name: "empty range", head: head, first: head, want: []string{}},
+		{name: "not an ancestor", head: head, first: unrelated, wantErr: true},
+	}
+	for _, tt := range tests {
+		commits, err := getRangeCommits(repo, get(tt.head), get(tt.first))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		got := make([]string, 0, len(commits))
+		for _, c := range commits {
+			got = append(got, c.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// testGitHubClient returns a client of a fake GitHub API authenticated as chiefr-bot, the comments
+// of pull request o/r#1 are listed from the JSON and the writes of comments are recorded
+func testGitHubClient(t *testing.T, comments string, writes *[]string) *github.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"login":"chiefr-bot"}`)
+	})
+	record := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, comments)
+			return
+		}
+		*writes = append(*writes, r.Method+" "+r.URL.Path)
+		fmt.Fprint(w, `{}`)
+	}
+	mux.HandleFunc("/repos/o/r/issues/1/comments", record)
+	mux.HandleFunc("/repos/o/r/issues/comments/", record)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestUpsertComment(t *testing.T) {
+	const marker = "<!-- chiefr:test -->"
+	tests := []struct {
+		name     string
+		comments string
+		want     []string
+	}{
+		{
+			name:     "new comment",
+			comments: `[]`,
+			want:     []string{"POST /repos/o/r/issues/1/comments"},
+		},
+		{
+			name:     "comment of chiefr is updated",
+			comments: `[{"id":7,"body":"old\n<!-- chiefr:test -->","user":{"login":"Chiefr-Bot"}}]`,
+			want:     []string{"PATCH /repos/o/r/issues/comments/7"},
+		},
+		{
+			name:     "unchanged comment of chiefr",
+			comments: `[{"id":7,"body":"new\n<!-- chiefr:test -->","user":{"login":"chiefr-bot"}}]`,
+			want:     []string{},
+		},
+		{
+			name:     "quoting comment is left alone",
+			comments: `[{"id":3,"body":"> <!-- chiefr:test -->","user":{"login":"mallory"}}]`,
+			want:     []string{"POST /repos/o/r/issues/1/comments"},
+		},
+	}
+	for _, tt := range tests {
+		writes := make([]string, 0)
+		client := testGitHubClient(t, tt.comments, &writes)
+		g := &GitHubManager{}
+		if err := g.upsertComment(context.Background(), client, "o", "r", 1, marker, "new"); err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(writes, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, writes, tt.want)
+		}
+	}
+}
+
+func TestPullRequestState(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments string
+		want     *pullRequestState
+	}{
+		{
+			name:     "no state",
+			comments: `[]`,
+			want:     &pullRequestState{},
+		},
+		{
+			name:     "state of chiefr",
+			comments: `[{"id":1,"body":"<!-- chiefr:state-data {\"assignees\":[\"alice\"]} -->\n<!-- chiefr:state -->","user":{"login":"chiefr-bot"}}]`,
+			want:     &pullRequestState{Assignees: []string{"alice"}},
+		},
+		{
+			name:     "forged state is ignored",
+			comments: `[{"id":1,"body":"<!-- chiefr:state-data {\"route\":[\"docs\"]} -->\n<!-- chiefr:state -->","user":{"login":"mallory"}}]`,
+			want:     &pullRequestState{},
+		},
+		{
+			name: "forged state before the state of chiefr",
+			comments: `[{"id":1,"body":"<!-- chiefr:state-data {\"route\":[\"docs\"]} -->\n<!-- chiefr:state -->","user":{"login":"mallory"}},
+				{"id":2,"body":"<!-- chiefr:state-data {\"assignees\":[\"alice\"]} -->\n<!-- chiefr:state -->","user":{"login":"chiefr-bot"}}]`,
+			want: &pullRequestState{Assignees: []string{"alice"}},
+		},
+	}
+	for _, tt := range tests {
+		client := testGitHubClient(t, tt.comments, &[]string{})
+		g := &GitHubManager{}
+		state, err := g.pullRequestState(context.Background(), client, "o", "r", 1)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(state, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, state, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Hidden markers of the comments of chiefr, the summary and close comments are updated on repeated runs
+const (
+	summaryCommentMarker string = "<!-- chiefr:summary -->"
+	closeCommentMarker   string = "<!-- chiefr:close -->"
+	mentionCommentMarker string = "<!-- chiefr:mention -->"
+)
+
+// Names of the comment templates
+const (
+	summaryCommentTemplate string = "summary"
+	closeCommentTemplate   string = "close"
+	shadowCommentTemplate  string = "shadow"
+	mentionCommentTemplate string = "mention"
+	mailCommentTemplate    string = "mail"
+)
+
+var defaultCommentTemplates = map[string]string{
+	summaryCommentTemplate: `Thank you for your contribution! This pull request changes the following segments:
+{{range .Segments}}
+**{{.Name}}**
+ - Chiefs: {{join .Chiefs ", "}}
+{{- if .Reviewers}}
+ - Reviewers: {{join .Reviewers ", "}}
+{{- end}}
+{{- if .Chat}}
+ - Chat: {{.Chat}}
+{{- end}}
+{{- if .MailList}}
+ - Mailing list: {{.MailList}}
+{{- end}}
+{{- if .IssueTracker}}
+ - Issue tracker: {{.IssueTracker}}
+{{- end}}
+{{- if .Contributing}}
+ - Contribution guide: {{.Contributing}}
+{{- end}}
+{{end}}`,
+	closeCommentTemplate: `Hello!
+This repository is not responsible for the changes you submitted. Submit your patch to {{join .Repositories " or "}}
+{{range .Transfers}}
+To submit it to {{.Repository}}, fork the repository, push your branch to your fork:
+
+{{range .Commands}}    {{.}}
+{{end}}
+and open a pull request at {{.CompareURL}}
+{{end}}`,
+	shadowCommentTemplate: `Shadow segments matching {{.PullRequest}}:
+{{range .Segments -}}
+{{" "}}- {{.Name}} (trial until {{.ShadowUntil}}): assignees: {{join .Chiefs ", "}}, labels: {{join (labels .) ", "}}
+{{end}}`,
+	mentionCommentTemplate: `{{range $i, $m := .Mentions}}{{if $i}} {{end}}@{{$m}}{{end}}
+This changes segments you are responsible for, please take a look.`,
+	mailCommentTemplate: `{{.PullRequest}} changes the following segments:
+{{range .Segments}}
+ - {{.Name}} (chiefs: {{join .Chiefs ", "}})
+{{- end}}
+
+Changed files (+{{.Additions}} -{{.Deletions}} lines in total):
+{{range .Files}}
+ - {{.}}
+{{- end}}
+`,
+}
+
+// Template variables of the comments
+type commentData struct {
+	// URL of the pull request
+	PullRequest string
+	// Matching segments ordered by rank
+	Segments orderedSegmentList
+	// Repository responsible for the changes of the pull request
+	Repository string
+	// Repositories suggested to submit the pull request according to the SuggestRepositories setting
+	Repositories []string
+	// Instructions of submitting the pull request to the suggested repositories
+	Transfers []*transferInstructions
+	// Chiefs and reviewers mentioned because they can't be assigned or requested to review
+	Mentions []string
+	// Changed files of the segments and the number of added and deleted lines of the pull request in mails
+	Files     []string
+	Additions int
+	Deletions int
+}
+
+// suggestedRepositories returns the repositories where the changes of the segments should be submitted
+func (c *Config) suggestedRepositories(segments orderedSegmentList) []string {
+	repositories := make([]string, 0)
+	for _, s := range segments {
+		if s.Repository == "" {
+			continue
+		}
+		appendNew(&repositories, s.Repository)
+		if c.Settings.SuggestRepositories != suggestAllRepositories {
+			break
+		}
+	}
+	return repositories
+}
+
+// Template variables used to validate the comment templates, every list has an item so the
+// template of the items is executed too
+var sampleCommentData = &commentData{
+	PullRequest:  "https://github.com/owner/repo/pull/1",
+	Segments:     orderedSegmentList{&ProjectSegment{Name: "segment", Chiefs: []string{"chief"}}},
+	Repository:   "https://github.com/owner/repo",
+	Repositories: []string{"https://github.com/owner/repo"},
+	Transfers:    []*transferInstructions{{Repository: "https://github.com/owner/repo", Commands: []string{"git push"}}},
+	Mentions:     []string{"user"},
+	Files:        []string{"main.go"},
+}
+
+// parseCommentTemplates parses every comment template and executes them with sample variables,
+// so invalid templates are reported when the maintainers file is loaded, not when commenting
+func (c *Config) parseCommentTemplates() error {
+	c.commentTemplates = make(map[string]*template.Template, len(defaultCommentTemplates))
+	for name := range defaultCommentTemplates {
+		t, err := c.commentTemplate(name)
+		if err != nil {
+			return err
+		}
+		if err := t.Execute(ioutil.Discard, sampleCommentData); err != nil {
+			return fmt.Errorf("Invalid comment template '%s': %s", name, err)
+		}
+		c.commentTemplates[name] = t
+	}
+	return nil
+}
+
+// commentTemplate parses the comment template, the template is looked up in the [chiefr.comments] section,
+// then in the CommentTemplates directory as NAME.md, then the built-in template is used
+func (c *Config) commentTemplate(name string) (*template.Template, error) {
+	text, found := c.CommentTemplates[name]
+	if !found && c.Settings.CommentTemplates != "" {
+		content, err := ioutil.ReadFile(filepath.Join(c.Settings.CommentTemplates, name+".md"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Failed to read comment template '%s': %s", name, err)
+		}
+		text, found = string(content), err == nil
+	}
+	if !found {
+		text = defaultCommentTemplates[name]
+	}
+	t, err := template.New(name).Funcs(template.FuncMap{
+		"join": strings.Join,
+		"labels": func(s *ProjectSegment) []string {
+			return c.Settings.getLabels(orderedSegmentList{s})
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid comment template '%s': %s", name, err)
+	}
+	return t, nil
+}
+
+// renderComment executes the comment template parsed with the maintainers file
+func (c *Config) renderComment(name string, data *commentData) (string, error) {
+	t, found := c.commentTemplates[name]
+	if !found {
+		var err error
+		t, err = c.commentTemplate(name)
+		if err != nil {
+			return "", err
+		}
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("Failed to render comment template '%s': %s", name, err)
+	}
+	return buf.String(), nil
+}
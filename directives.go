@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Directives of pull request descriptions, e.g. "Chiefr-Segment: core" or "/chiefr route core"
+// forces the segment, "Chiefr-Exclude: docs" or "/chiefr exclude docs" excludes it
+var (
+	segmentDirectiveRe = regexp.MustCompile(`(?im)^[ \t]*(?:chiefr-segment:|/chiefr[ \t]+route[ \t])[ \t]*(.+?)[ \t]*$`)
+	excludeDirectiveRe = regexp.MustCompile(`(?im)^[ \t]*(?:chiefr-exclude:|/chiefr[ \t]+exclude[ \t])[ \t]*(.+?)[ \t]*$`)
+)
+
+// Segments forced and excluded by the directives of a pull request description
+type routingDirectives struct {
+	Include []string
+	Exclude []string
+}
+
+// parseDirectives returns the segment names of the directives, the names are separated by commas or spaces
+func parseDirectives(description string) *routingDirectives {
+	names := func(re *regexp.Regexp) []string {
+		result := make([]string, 0)
+		for _, m := range re.FindAllStringSubmatch(description, -1) {
+			for _, name := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+				appendNew(&result, name)
+			}
+		}
+		return result
+	}
+	return &routingDirectives{
+		Include: names(segmentDirectiveRe),
+		Exclude: names(excludeDirectiveRe),
+	}
+}
+
+// applyDirectives puts the forced segments in front of the ranked segments and removes the excluded ones,
+// unknown segment names are reported and ignored
+func (c *Config) applyDirectives(segments orderedSegmentList, d *routingDirectives) orderedSegmentList {
+	lookup := func(name string) *ProjectSegment {
+		s, found := c.Segments[name]
+		if !found {
+			fmt.Fprintf(os.Stderr, "Warning! Unknown segment '%s' in the pull request directives\n", name)
+		}
+		return s
+	}
+	excluded := make(orderedSegmentList, 0)
+	for _, name := range d.Exclude {
+		if s := lookup(name); s != nil {
+			excluded = append(excluded, s)
+		}
+	}
+	result := make(orderedSegmentList, 0, len(segments))
+	for _, name := range d.Include {
+		if s := lookup(name); s != nil && !excluded.contains(s) && !result.contains(s) {
+			result = append(result, s)
+		}
+	}
+	for _, s := range segments {
+		if !excluded.contains(s) && !result.contains(s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func (g *GitHubManager) PullRequestDescription(u string) (string, error) {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return "", errors.New("Invalid pull request URL")
+	}
+	ctx := context.Background()
+	pr, _, err := g.client(ctx).PullRequests.Get(ctx, user, repo, prNum)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get pull request: %s", err)
+	}
+	return pr.GetBody(), nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tests := []struct {
+		description string
+		include     []string
+		exclude     []string
+	}{
+		{"", []string{}, []string{}},
+		{"Chiefr-Segment: core", []string{"core"}, []string{}},
+		{"chiefr-segment: core, docs\nChiefr-Exclude: tests", []string{"core", "docs"}, []string{"tests"}},
+		{"/chiefr route core docs\n/chiefr exclude ci", []string{"core", "docs"}, []string{"ci"}},
+		{"Fixes the parser.\n\n  Chiefr-Segment:\tcore  \n", []string{"core"}, []string{}},
+		{"Chiefr-Segment: core\nChiefr-Segment: core, docs", []string{"core", "docs"}, []string{}},
+		{"See the Chiefr-Segment: core directive", []string{}, []string{}},
+		{"/chiefr routed core", []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		d := parseDirectives(tt.description)
+		if !reflect.DeepEqual(d.Include, tt.include) || !reflect.DeepEqual(d.Exclude, tt.exclude) {
+			t.Errorf("parseDirectives(%q) = %q, %q, want %q, %q", tt.description, d.Include, d.Exclude, tt.include, tt.exclude)
+		}
+	}
+}
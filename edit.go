@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-ini/ini"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+const addPreviewLimit int = 20
+
+// iniString returns the segment in maintainers file format
+func (s *ProjectSegment) iniString() string {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("[%s]\n", s.Name))
+	writeList := func(key string, values []string) {
+		if len(values) != 0 {
+			buf.WriteString(fmt.Sprintf("%s = %s\n", key, strings.Join(values, ", ")))
+		}
+	}
+	writeString := func(key, value string) {
+		if value != "" {
+			buf.WriteString(fmt.Sprintf("%s = %s\n", key, quoteValue(value)))
+		}
+	}
+	writeString("Extends", s.Extends)
+	writeString("Repository", s.Repository)
+	writeString("IssueTracker", s.IssueTracker)
+	writeString("MailList", s.MailList)
+	writeString("Chat", s.Chat)
+	writeString("Forum", s.Forum)
+	writeList("QATags", s.QATags)
+	writeString("Contributing", s.Contributing)
+	writeList("Chiefs", s.Chiefs)
+	writeString("AssignStrategy", s.AssignStrategy)
+	writeList("Reviewers", s.Reviewers)
+	writeList("Topics", s.Topics)
+	writeString("Milestone", s.Milestone)
+	writeString("Project", s.Project)
+	writeString("ProjectStatus", s.ProjectStatus)
+	writeList("FilePatterns", s.FilePatterns)
+	writeList("FileExcludePatterns", s.FileExcludePatterns)
+	writeList("FileGlobs", s.FileGlobs)
+	writeList("ContentPatterns", s.ContentPatterns)
+	writeList("ContentExcludePatterns", s.ContentExcludePatterns)
+	writeList("FileContentPatterns", s.FileContentPatterns)
+	writeList("SymbolPatterns", s.SymbolPatterns)
+	writeList("MessagePatterns", s.MessagePatterns)
+	writeList("BinaryPatterns", s.BinaryPatterns)
+	writeList("PatternWeights", s.PatternWeights)
+	if s.ContentChangesOnly {
+		buf.WriteString("ContentChangesOnly = true\n")
+	}
+	if s.MaxAssignees != 0 {
+		buf.WriteString(fmt.Sprintf("MaxAssignees = %d\n", s.MaxAssignees))
+	}
+	if s.RequiredApprovals != 0 {
+		buf.WriteString(fmt.Sprintf("RequiredApprovals = %d\n", s.RequiredApprovals))
+	}
+	if s.MaxLabels != 0 {
+		buf.WriteString(fmt.Sprintf("MaxLabels = %d\n", s.MaxLabels))
+	}
+	if s.Priority != 0 {
+		buf.WriteString(fmt.Sprintf("Priority = %d\n", s.Priority))
+	}
+	return buf.String()
+}
+
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+type prompter struct {
+	r *bufio.Reader
+}
+
+func (p *prompter) ask(question, defaultValue string) (string, error) {
+	if defaultValue != "" {
+		fmt.Printf("%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, err := p.r.ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		return "", errors.New("Aborted")
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return defaultValue, nil
+	}
+	return answer, nil
+}
+
+func (p *prompter) askRequired(question string) (string, error) {
+	for {
+		answer, err := p.ask(question, "")
+		if err != nil || answer != "" {
+			return answer, err
+		}
+		fmt.Println("This field is required")
+	}
+}
+
+// appendToMaintainersFile appends the text to the end of the maintainers file
+// without touching the existing content
+func appendToMaintainersFile(fileName, text string) error {
+	if isRemoteFile(fileName) {
+		return errors.New("Remote maintainers files cannot be modified")
+	}
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("Failed to read maintainers file: %s", err)
+	}
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to open maintainers file: %s", err)
+	}
+	defer f.Close()
+	if len(content) != 0 {
+		text = "\n" + text
+		if content[len(content)-1] != '\n' {
+			text = "\n" + text
+		}
+	}
+	_, err = f.WriteString(text)
+	if err != nil {
+		return fmt.Errorf("Failed to write maintainers file: %s", err)
+	}
+	return nil
+}
+
+func addSegment(c *Config, repoPath, maintainersFileName string, in io.Reader) error {
+	p := &prompter{r: bufio.NewReader(in)}
+	s := &ProjectSegment{}
+	e, err := loadIniEditor(maintainersFileName)
+	if err != nil {
+		return err
+	}
+	for {
+		s.Name, err = p.askRequired("Segment name")
+		if err != nil {
+			return err
+		}
+		err = checkSegmentName(c, e, s.Name)
+		if err == nil {
+			break
+		}
+		fmt.Println(err.Error())
+	}
+	chiefs, err := p.askRequired("Chiefs (comma separated)")
+	if err != nil {
+		return err
+	}
+	s.Chiefs = splitList(chiefs)
+	for {
+		patterns, err := p.ask("File patterns (comma separated regexps)", "")
+		if err != nil {
+			return err
+		}
+		s.FilePatterns = splitList(patterns)
+		if err := s.compile(); err != nil {
+			fmt.Println(err.Error())
+			continue
+		}
+		break
+	}
+	s.Repository, err = p.ask("Repository", "")
+	if err != nil {
+		return err
+	}
+	topics, err := p.ask("Topics (comma separated)", "")
+	if err != nil {
+		return err
+	}
+	s.Topics = splitList(topics)
+	for {
+		priority, err := p.ask("Priority", "0")
+		if err != nil {
+			return err
+		}
+		s.Priority, err = strconv.Atoi(priority)
+		if err == nil {
+			break
+		}
+		fmt.Println("Priority must be a number")
+	}
+
+	if len(s.FilePatterns) != 0 {
+		tree, err := getHeadTree(repoPath)
+		if err != nil {
+			return err
+		}
+		matches := make([]string, 0)
+		tree.Files().ForEach(func(f *object.File) error {
+			if s.IsFileNameMatch(f.Name) {
+				matches = append(matches, f.Name)
+			}
+			return nil
+		})
+		fmt.Printf("\nThe segment matches %d file(s)\n", len(matches))
+		for i, m := range matches {
+			if i == addPreviewLimit {
+				fmt.Printf(" ... and %d more\n", len(matches)-addPreviewLimit)
+				break
+			}
+			fmt.Println(" -", m)
+		}
+	}
+	fmt.Printf("\n%s\n", s.iniString())
+	confirm, err := p.ask(fmt.Sprintf("Add segment to %s? (y/n)", maintainersFileName), "y")
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(confirm) != "y" {
+		return errors.New("Aborted")
+	}
+	err = appendToMaintainersFile(maintainersFileName, s.iniString())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Segment '%s' added to %s\n", s.Name, maintainersFileName)
+	return nil
+}
+
+// Line based maintainers file editor which keeps the formatting and the comments of the file
+type iniEditor struct {
+	lines []string
+}
+
+var (
+	iniSectionRe = regexp.MustCompile(`^\s*\[([^\]]*)\]\s*$`)
+	iniCommentRe = regexp.MustCompile(`^\s*[;#]`)
+)
+
+func loadIniEditor(fileName string) (*iniEditor, error) {
+	if isRemoteFile(fileName) {
+		return nil, errors.New("Remote maintainers files cannot be modified")
+	}
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read maintainers file: %s", err)
+	}
+	return &iniEditor{lines: strings.Split(string(content), "\n")}, nil
+}
+
+func (e *iniEditor) String() string {
+	return strings.Join(e.lines, "\n")
+}
+
+// save writes the file and restores the original content if the result is not a valid maintainers file
+func (e *iniEditor) save(fileName string) error {
+	original, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("Failed to read maintainers file: %s", err)
+	}
+	err = ioutil.WriteFile(fileName, []byte(e.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to write maintainers file: %s", err)
+	}
+	if _, err = initMaintainers(fileName, true); err != nil {
+		ioutil.WriteFile(fileName, original, 0644)
+		return fmt.Errorf("Maintainers file is not modified: %s", err)
+	}
+	return nil
+}
+
+// section returns the line index of the section header and the end of the section,
+// the end excludes the comments preceding the next section
+func (e *iniEditor) section(name string) (int, int, error) {
+	start := -1
+	for i, l := range e.lines {
+		m := iniSectionRe.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		if start != -1 {
+			end := i
+			for end > start+1 && (iniCommentRe.MatchString(e.lines[end-1]) || strings.TrimSpace(e.lines[end-1]) == "") {
+				end--
+			}
+			return start, end, nil
+		}
+		if strings.TrimSpace(m[1]) == name {
+			start = i
+		}
+	}
+	if start == -1 {
+		return 0, 0, fmt.Errorf("Segment '%s' not found in maintainers file", name)
+	}
+	end := len(e.lines)
+	for end > start+1 && strings.TrimSpace(e.lines[end-1]) == "" {
+		end--
+	}
+	return start, end, nil
+}
+
+func (e *iniEditor) removeSection(name string) error {
+	start, end, err := e.section(name)
+	if err != nil {
+		return err
+	}
+	// the comments directly above the header belong to the section
+	for start > 0 && iniCommentRe.MatchString(e.lines[start-1]) {
+		start--
+	}
+	for end < len(e.lines) && strings.TrimSpace(e.lines[end]) == "" {
+		end++
+	}
+	e.lines = append(e.lines[:start], e.lines[end:]...)
+	return nil
+}
+
+func (e *iniEditor) renameSection(name, newName string) error {
+	start, _, err := e.section(name)
+	if err != nil {
+		return err
+	}
+	// the header is rebuilt, replacing the name in it could hit the brackets or the spaces
+	e.lines[start] = fmt.Sprintf("[%s]", newName)
+	return nil
+}
+
+// keyLine returns the index of the line defining the key in the section or -1
+func (e *iniEditor) keyLine(start, end int, key string) int {
+	for i := start + 1; i < end; i++ {
+		if iniCommentRe.MatchString(e.lines[i]) {
+			continue
+		}
+		parts := strings.SplitN(e.lines[i], "=", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// setKey sets the value of the key in the section, empty value removes the key
+func (e *iniEditor) setKey(name, key, value string) error {
+	start, end, err := e.section(name)
+	if err != nil {
+		return err
+	}
+	i := e.keyLine(start, end, key)
+	switch {
+	case i != -1 && value == "":
+		e.lines = append(e.lines[:i], e.lines[i+1:]...)
+	case i != -1:
+		e.lines[i] = fmt.Sprintf("%s= %s", e.lines[i][:strings.Index(e.lines[i], "=")], quoteValue(value))
+	case value != "":
+		e.lines = append(e.lines[:end], append([]string{fmt.Sprintf("%s = %s", key, quoteValue(value))}, e.lines[end:]...)...)
+	}
+	return nil
+}
+
+// addSection inserts an empty section before the first section of the file,
+// after the properties of the DEFAULT section
+func (e *iniEditor) addSection(name string) {
+	i := 0
+	for i < len(e.lines) && !iniSectionRe.MatchString(e.lines[i]) {
+		i++
+	}
+	for i > 0 && iniCommentRe.MatchString(e.lines[i-1]) {
+		i--
+	}
+	e.lines = append(e.lines[:i], append([]string{fmt.Sprintf("[%s]", name), ""}, e.lines[i:]...)...)
+}
+
+func (e *iniEditor) sectionNames() []string {
+	names := make([]string, 0)
+	for _, l := range e.lines {
+		if m := iniSectionRe.FindStringSubmatch(l); m != nil {
+			names = append(names, strings.TrimSpace(m[1]))
+		}
+	}
+	return names
+}
+
+func removeSegment(c *Config, maintainersFileName, name string) error {
+	e, err := loadIniEditor(maintainersFileName)
+	if err != nil {
+		return err
+	}
+	err = e.removeSection(name)
+	if err != nil {
+		return err
+	}
+	err = e.save(maintainersFileName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Segment '%s' removed from %s\n", name, maintainersFileName)
+	return nil
+}
+
+// checkSegmentName returns an error if the name is reserved or used by a segment, a shadow segment
+// or another section of the maintainers file (e.g. a template section)
+func checkSegmentName(c *Config, e *iniEditor, name string) error {
+	if strings.ContainsAny(name, "[]\n") {
+		return fmt.Errorf("Invalid segment name '%s'", name)
+	}
+	if name == ini.DEFAULT_SECTION || name == settingsSection || strings.HasPrefix(name, settingsSection+".") {
+		return fmt.Errorf("Section name '%s' is reserved", name)
+	}
+	if _, found := c.Segments[name]; found {
+		return fmt.Errorf("Segment '%s' already exists", name)
+	}
+	if _, found := c.ShadowSegments[name]; found {
+		return fmt.Errorf("Shadow segment '%s' already exists", name)
+	}
+	for _, s := range e.sectionNames() {
+		if s == name {
+			return fmt.Errorf("Section '%s' already exists", name)
+		}
+	}
+	return nil
+}
+
+func renameSegment(c *Config, maintainersFileName, name, newName string) error {
+	e, err := loadIniEditor(maintainersFileName)
+	if err != nil {
+		return err
+	}
+	err = checkSegmentName(c, e, newName)
+	if err != nil {
+		return err
+	}
+	err = e.renameSection(name, newName)
+	if err != nil {
+		return err
+	}
+	// keep the inheritance of the extending sections
+	for _, s := range e.sectionNames() {
+		start, end, _ := e.section(s)
+		if i := e.keyLine(start, end, "Extends"); i != -1 {
+			if strings.TrimSpace(strings.SplitN(e.lines[i], "=", 2)[1]) == name {
+				e.setKey(s, "Extends", newName)
+			}
+		}
+	}
+	err = e.save(maintainersFileName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Segment '%s' renamed to '%s'\n", name, newName)
+	return nil
+}
+
+func editSegment(c *Config, maintainersFileName, name string, properties []string) error {
+	e, err := loadIniEditor(maintainersFileName)
+	if err != nil {
+		return err
+	}
+	for _, p := range properties {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("Invalid property '%s', use KEY=VALUE format", p)
+		}
+		err = e.setKey(name, strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		if err != nil {
+			return err
+		}
+	}
+	err = e.save(maintainersFileName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Segment '%s' updated\n", name)
+	return nil
+}
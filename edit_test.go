@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIniEditor(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		edit    func(e *iniEditor) error
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "set existing key",
+			content: "[a]\nChiefs = x\n",
+			edit:    func(e *iniEditor) error { return e.setKey("a", "Chiefs", "y") },
+			want:    "[a]\nChiefs = y\n",
+		},
+		{
+			name:    "add key before the comments of the next section",
+			content: "[a]\nChiefs = x\n\n; b\n[b]\nChiefs = y\n",
+			edit:    func(e *iniEditor) error { return e.setKey("a", "Topics", "t") },
+			want:    "[a]\nChiefs = x\nTopics = t\n\n; b\n[b]\nChiefs = y\n",
+		},
+		{
+			name:    "empty value removes the key",
+			content: "[a]\nChiefs = x\nTopics = t\n",
+			edit:    func(e *iniEditor) error { return e.setKey("a", "Topics", "") },
+			want:    "[a]\nChiefs = x\n",
+		},
+		{
+			name:    "comment characters are quoted",
+			content: "[a]\nChiefs = x\n",
+			edit:    func(e *iniEditor) error { return e.setKey("a", "Chat", "irc://libera/#chiefr") },
+			want:    "[a]\nChiefs = x\nChat = \"\"\"irc://libera/#chiefr\"\"\"\n",
+		},
+		{
+			name:    "commented out keys are ignored",
+			content: "[a]\n; Topics = old\nChiefs = x\n",
+			edit:    func(e *iniEditor) error { return e.setKey("a", "Topics", "t") },
+			want:    "[a]\n; Topics = old\nChiefs = x\nTopics = t\n",
+		},
+		{
+			name:    "remove section with its comments",
+			content: "[a]\nChiefs = x\n\n; b\n[b]\nChiefs = y\n",
+			edit:    func(e *iniEditor) error { return e.removeSection("b") },
+			want:    "[a]\nChiefs = x\n",
+		},
+		{
+			name:    "remove section in the middle",
+			content: "[a]\nChiefs = x\n\n[b]\nChiefs = y\n\n[c]\nChiefs = z\n",
+			edit:    func(e *iniEditor) error { return e.removeSection("b") },
+			want:    "[a]\nChiefs = x\n\n[c]\nChiefs = z\n",
+		},
+		{
+			name:    "rename rebuilds the header",
+			content: "[ a ]\nChiefs = x\n",
+			edit:    func(e *iniEditor) error { return e.renameSection("a", "b") },
+			want:    "[b]\nChiefs = x\n",
+		},
+		{
+			name:    "add section after the default properties",
+			content: "Chiefs = d\n\n; a\n[a]\nChiefs = x\n",
+			edit: func(e *iniEditor) error {
+				e.addSection("chiefr")
+				return nil
+			},
+			want: "Chiefs = d\n\n[chiefr]\n\n; a\n[a]\nChiefs = x\n",
+		},
+		{
+			name:    "missing section",
+			content: "[a]\nChiefs = x\n",
+			edit:    func(e *iniEditor) error { return e.setKey("b", "Chiefs", "y") },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		e := &iniEditor{lines: strings.Split(tt.content, "\n")}
+		err := tt.edit(e)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if got := e.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSegmentName(t *testing.T) {
+	c := &Config{
+		Segments:       ProjectSegments{"core": &ProjectSegment{Name: "core"}},
+		ShadowSegments: ProjectSegments{"trial": &ProjectSegment{Name: "trial"}},
+	}
+	e := &iniEditor{lines: strings.Split("[core]\nChiefs = x\n\n[base]\nTemplate = true\n", "\n")}
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"docs", false},
+		{"core", true},
+		{"trial", true},
+		{"base", true},
+		{"chiefr", true},
+		{"chiefr.teams", true},
+		{"DEFAULT", true},
+		{"a]b", true},
+	}
+	for _, tt := range tests {
+		if err := checkSegmentName(c, e, tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("checkSegmentName(%q) = %v, want error: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Directory of the cached forge API responses, empty if the cache is disabled
+var apiCacheDir string
+
+// The cache keeps at most apiCacheMaxEntries responses used in the last apiCacheMaxAge,
+// it's pruned on the first and then on every apiCachePruneInterval stored response
+const (
+	apiCacheMaxEntries    int           = 2000
+	apiCacheMaxAge        time.Duration = 30 * 24 * time.Hour
+	apiCachePruneInterval uint64        = 100
+	// Prefix of the temporary files of the cache entries being stored
+	cacheTempPrefix string = "tmp-"
+)
+
+// Number of the stored responses, see apiCachePruneInterval
+var apiCacheSaves uint64
+
+func apiResponseCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "chiefr", "api"), nil
+}
+
+// etagTransport caches the GET responses having an ETag and revalidates them with If-None-Match,
+// unchanged resources are served from the cache and don't count against the rate limit of GitHub
+type etagTransport struct {
+	base http.RoundTripper
+	dir  string
+	// Token of the requests, responses aren't shared between tokens
+	token string
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.dir == "" || req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+	path := filepath.Join(t.dir, t.key(req))
+	cached := t.load(path, req)
+	r := req
+	if cached != nil {
+		r = req.Clone(req.Context())
+		r.Header.Set("If-None-Match", cached.Header.Get("ETag"))
+	}
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		// the modification time is the last use of the response, see prune
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return cached, nil
+	}
+	if resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "" {
+		t.save(path, resp)
+	}
+	return resp, nil
+}
+
+// key returns the cache key of the request
+func (t *etagTransport) key(req *http.Request) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(t.token+"\x00"+req.Header.Get("Accept")+"\x00"+req.URL.String())))
+}
+
+// load returns the cached response of the request, nil if it isn't cached or the cache is corrupt
+func (t *etagTransport) load(path string, req *http.Request) *http.Response {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(content)), req)
+	if err != nil || resp.Header.Get("ETag") == "" {
+		return nil
+	}
+	return resp
+}
+
+// save stores the response, errors are ignored because the cache is optional
+func (t *etagTransport) save(path string, resp *http.Response) {
+	// DumpResponse restores the body of the response after reading it
+	content, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return
+	}
+	// the response is written to a unique temporary file and renamed, so concurrent
+	// processes never read partially written responses;
+	// responses of private repositories are only readable by the user
+	f, err := ioutil.TempFile(t.dir, cacheTempPrefix)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	if atomic.AddUint64(&apiCacheSaves, 1)%apiCachePruneInterval == 1 {
+		pruneAPICache(t.dir, time.Now())
+	}
+}
+
+// pruneAPICache removes the responses not used for apiCacheMaxAge and the least recently used
+// responses above apiCacheMaxEntries
+func pruneAPICache(dir string, now time.Time) {
+	pruneCacheDir(dir, now, apiCacheMaxEntries, apiCacheMaxAge)
+}
+
+// pruneCacheDir removes the entries of the cache directory not used for maxAge and the least recently
+// used entries above maxEntries, the temporary files left by interrupted runs are removed too
+func pruneCacheDir(dir string, now time.Time, maxEntries int, maxAge time.Duration) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	entries := make([]os.FileInfo, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(f.Name(), cacheTempPrefix) {
+			if now.Sub(f.ModTime()) > time.Hour {
+				os.Remove(filepath.Join(dir, f.Name()))
+			}
+			continue
+		}
+		if now.Sub(f.ModTime()) > maxAge {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		entries = append(entries, f)
+	}
+	if len(entries) <= maxEntries {
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	for _, f := range entries[:len(entries)-maxEntries] {
+		os.Remove(filepath.Join(dir, f.Name()))
+	}
+}
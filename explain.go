@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// explain prints the segments of every changed file and commit with the patterns causing the attributions
+func explain(c *Config, repoPath, revision string, source *changeSource) error {
+	info, err := analyzeChanges(c, repoPath, revision, source)
+	if err != nil {
+		return err
+	}
+	if len(info.Files) == 0 {
+		if source.kind != committedChanges {
+			return fmt.Errorf("No changes to explain")
+		}
+		return fmt.Errorf("No files changed since the first commit of the patch")
+	}
+	fmt.Println("Files:")
+	for _, f := range info.Files {
+		if old, found := info.Renames[f]; found {
+			fmt.Printf(" %s (renamed from %s)\n", f, old)
+		} else {
+			fmt.Printf(" %s\n", f)
+		}
+		attributions := info.fileAttributions(info.Attributions, f)
+		hidden := info.fileAttributions(info.Hidden, f)
+		if len(attributions) == 0 {
+			fmt.Println("  [No segments found]")
+		}
+		for _, a := range attributions {
+			fmt.Printf("  + %s: %s\n", a.Segment, explainReason(a, f))
+		}
+		visible := make(orderedSegmentList, 0, len(attributions))
+		for _, a := range attributions {
+			visible = append(visible, info.Segments[a.Segment])
+		}
+		for _, a := range hidden {
+			fmt.Printf("  - %s: %s hidden by %s\n", a.Segment, explainReason(a, f), hiddenBy(visible))
+		}
+	}
+
+	messageAttributions := make([]*Attribution, 0)
+	for _, a := range info.Attributions {
+		if a.Commit != nil {
+			messageAttributions = append(messageAttributions, a)
+		}
+	}
+	if len(messageAttributions) != 0 {
+		fmt.Println("\nCommit messages:")
+		for _, a := range messageAttributions {
+			fmt.Printf("  + %s: %s\n", a.Segment, a)
+		}
+	}
+
+	fmt.Println("\nSegments:")
+	if len(info.Segments) == 0 {
+		fmt.Println(" [No segments found]")
+	}
+	for _, s := range c.rankSegments(info) {
+		fmt.Printf(" %s (priority %d, score %g)\n", s.Name, s.Priority, info.Scores[s.Name])
+		fmt.Printf("    Chiefs: %s\n", strings.Join(s.Chiefs, ", "))
+		if len(s.Reviewers) != 0 {
+			fmt.Printf("    Reviewers: %s\n", strings.Join(s.Reviewers, ", "))
+		}
+		if s.Repository != "" {
+			fmt.Printf("    Repository: %s\n", s.Repository)
+		}
+	}
+	return nil
+}
+
+// explainReason describes the attribution of the changed file noting matches of the old path of renamed files
+func explainReason(a *Attribution, path string) string {
+	if a.Path != path {
+		return fmt.Sprintf("%s (old path)", a.reason())
+	}
+	return a.reason()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+)
+
+// Fetchable refs of a pull request in the repository of the forge
+type pullRequestRefs struct {
+	Number   int
+	CloneURL string
+	// Ref of the head commit, e.g. refs/pull/1/head
+	Head string
+	// Ref of the base branch
+	Base string
+}
+
+// fetchMu serializes the fetches of the concurrent updates of the webhook server into the repository
+var fetchMu sync.Mutex
+
+// pullRequestRefPrefix returns the prefix of the fetched refs of the pull request, the refs of the pull requests
+// of different repositories don't collide, e.g. refs/chiefr/github.com/owner/repo/pull/1/
+func pullRequestRefPrefix(refs *pullRequestRefs) string {
+	repository := refs.CloneURL
+	if i := strings.Index(repository, "://"); i != -1 {
+		repository = repository[i+3:]
+	}
+	// user info and ports aren't valid in ref names
+	if i := strings.LastIndex(repository, "@"); i != -1 {
+		repository = repository[i+1:]
+	}
+	repository = strings.Replace(strings.TrimSuffix(strings.Trim(repository, "/"), ".git"), ":", "/", -1)
+	return fmt.Sprintf("refs/chiefr/%s/pull/%d/", repository, refs.Number)
+}
+
+// fetchPullRequest fetches the head and the base branch of the pull request to refs/chiefr/HOST/OWNER/REPO/pull/N/
+// and returns the revision range of the changes of the pull request, the commits are resolved before other
+// updates can fetch the refs again
+func fetchPullRequest(repoPath string, refs *pullRequestRefs, APIKey string) (string, error) {
+	fetchMu.Lock()
+	defer fetchMu.Unlock()
+	prefix := pullRequestRefPrefix(refs)
+	head := prefix + "head"
+	base := prefix + "base"
+	specs := []config.RefSpec{
+		config.RefSpec(fmt.Sprintf("+%s:%s", refs.Head, head)),
+		config.RefSpec(fmt.Sprintf("+%s:%s", refs.Base, base)),
+	}
+	isHTTP := strings.HasPrefix(refs.CloneURL, "https://") || strings.HasPrefix(refs.CloneURL, "http://")
+	repo, err := openRepository(repoPath)
+	if err == nil {
+		var auth transport.AuthMethod
+		if APIKey != "" && isHTTP {
+			auth = &http.BasicAuth{Username: "x-access-token", Password: APIKey}
+		}
+		remote := git.NewRemote(repo.Storer, &config.RemoteConfig{Name: "chiefr", URLs: []string{refs.CloneURL}})
+		err = remote.Fetch(&git.FetchOptions{RefSpecs: specs, Auth: auth, Tags: git.NoTags})
+		if err == git.NoErrAlreadyUpToDate {
+			err = nil
+		}
+	}
+	g := &nativeGit{repoPath: repoPath}
+	if err != nil {
+		// go-git can't fetch into shallow clones
+		if APIKey != "" && isHTTP {
+			// the token is passed in the environment to keep it out of the process list
+			credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + APIKey))
+			g.env = []string{
+				"GIT_CONFIG_COUNT=1",
+				"GIT_CONFIG_KEY_0=http.extraHeader",
+				"GIT_CONFIG_VALUE_0=Authorization: Basic " + credentials,
+			}
+		}
+		args := []string{"fetch", "--quiet", "--no-tags", refs.CloneURL}
+		for _, s := range specs {
+			args = append(args, s.String())
+		}
+		if _, nativeErr := g.run(args...); nativeErr != nil {
+			return "", fmt.Errorf("Failed to fetch pull request: %s", nativeErr)
+		}
+	}
+	baseHash, err := resolveRef(repo, g, base)
+	if err != nil {
+		return "", err
+	}
+	headHash, err := resolveRef(repo, g, head)
+	if err != nil {
+		return "", err
+	}
+	return baseHash + "..." + headHash, nil
+}
+
+// resolveRef returns the commit hash of the ref, with the git executable if go-git can't open the repository
+func resolveRef(repo *git.Repository, g *nativeGit, name string) (string, error) {
+	if repo != nil {
+		if ref, err := repo.Reference(plumbing.ReferenceName(name), true); err == nil {
+			return ref.Hash().String(), nil
+		}
+	}
+	out, err := g.run("rev-parse", "--verify", name+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve %s: %s", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
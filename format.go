@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// Canonical key order of the segment sections
+var segmentKeyOrder = []string{
+	"Extends",
+	"Template",
+	"Shadow",
+	"ShadowUntil",
+	"Repository",
+	"IssueTracker",
+	"MailList",
+	"Chat",
+	"Forum",
+	"QATags",
+	"Contributing",
+	"Chiefs",
+	"AssignStrategy",
+	"MaxAssignees",
+	"RequiredApprovals",
+	"Reviewers",
+	"Topics",
+	"MaxLabels",
+	"Milestone",
+	"Project",
+	"ProjectStatus",
+	"FilePatterns",
+	"FileExcludePatterns",
+	"FileGlobs",
+	"ContentPatterns",
+	"ContentExcludePatterns",
+	"ContentChangesOnly",
+	"FileContentPatterns",
+	"SymbolPatterns",
+	"MessagePatterns",
+	"BinaryPatterns",
+	"MaxContentMatchBytes",
+	"CaseInsensitive",
+	"AnchorPatterns",
+	"Exclusive",
+	"Fallback",
+	"PatternWeights",
+	"Priority",
+}
+
+// Canonical key order of the settings section
+var settingsKeyOrder = []string{
+	"Version",
+	"Organization",
+	"BaseBranch",
+	"RecurseSubmodules",
+	"SummaryComment",
+	"Directives",
+	"BusyStatus",
+	"DraftPolicy",
+	"WrongRepositoryAction",
+	"SuggestRepositories",
+	"CommentTemplates",
+	"AssignStrategy",
+	"MaxAssignees",
+	"RequiredApprovals",
+	"MergeMethod",
+	"LabelStrategy",
+	"MaxLabels",
+	"LabelPrefix",
+	"MatchStrategy",
+	"RankStrategy",
+	"LabelGroups",
+	"SizeLabels",
+	"ShadowIssue",
+}
+
+// Keys holding comma separated lists
+var listKeys = map[string]bool{
+	"QATags":                 true,
+	"Chiefs":                 true,
+	"Reviewers":              true,
+	"Topics":                 true,
+	"FilePatterns":           true,
+	"FileExcludePatterns":    true,
+	"FileGlobs":              true,
+	"ContentPatterns":        true,
+	"ContentExcludePatterns": true,
+	"FileContentPatterns":    true,
+	"SymbolPatterns":         true,
+	"MessagePatterns":        true,
+	"BinaryPatterns":         true,
+	"PatternWeights":         true,
+	"LabelGroups":            true,
+	"SizeLabels":             true,
+}
+
+func writeComment(buf *bytes.Buffer, comment string) {
+	if comment != "" {
+		buf.WriteString(comment + "\n")
+	}
+}
+
+func writeKey(buf *bytes.Buffer, k *ini.Key, list bool) {
+	writeComment(buf, k.Comment)
+	name := k.Name()
+	if strings.ContainsAny(name, "=:") {
+		name = fmt.Sprintf("\"%s\"", name)
+	}
+	value := k.Value()
+	if list {
+		value = strings.Join(splitList(value), ", ")
+	}
+	buf.WriteString(fmt.Sprintf("%s = %s\n", name, quoteValue(value)))
+}
+
+// quoteValue quotes the multiline values and the values the parser would cut at an inline comment
+// starting with # or ;, the other values are written as they are
+func quoteValue(value string) string {
+	if !strings.ContainsAny(value, "\n#;") {
+		return value
+	}
+	if !strings.Contains(value, `"""`) {
+		return `"""` + value + `"""`
+	}
+	return "`" + value + "`"
+}
+
+// writeKeys writes the keys of the section in the given order followed by
+// the unknown keys in their original order
+func writeKeys(buf *bytes.Buffer, s *ini.Section, order []string) {
+	written := make(map[string]bool)
+	for _, name := range order {
+		if !hasOwnKey(s, name) {
+			continue
+		}
+		writeKey(buf, s.Key(name), listKeys[name])
+		written[name] = true
+	}
+	for _, k := range s.Keys() {
+		if !written[k.Name()] {
+			writeKey(buf, k, listKeys[k.Name()])
+		}
+	}
+}
+
+// hasOwnKey reports whether the key is defined in the section itself, not in a parent section
+func hasOwnKey(s *ini.Section, name string) bool {
+	for _, k := range s.KeyStrings() {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
+
+// formatMaintainersFile returns the maintainers file in canonical format:
+// settings first, then templates sorted by name and segments sorted by priority and name
+func formatMaintainersFile(c *Config, content []byte) (string, error) {
+	cfg, err := ini.Load(content)
+	if err != nil {
+		return "", fmt.Errorf("Failed to parse maintainers file: %s", err)
+	}
+	var buf bytes.Buffer
+	settings := make([]*ini.Section, 0)
+	templates := make([]*ini.Section, 0)
+	segments := make([]*ini.Section, 0)
+	for _, s := range cfg.Sections() {
+		switch {
+		case s.Name() == ini.DEFAULT_SECTION:
+			// the comment of the first key is the header of the file
+			if keys := s.Keys(); len(keys) != 0 && keys[0].Comment != "" {
+				writeComment(&buf, keys[0].Comment)
+				keys[0].Comment = ""
+			}
+			writeKeys(&buf, s, segmentKeyOrder)
+		case s.Name() == settingsSection || strings.HasPrefix(s.Name(), settingsSection+"."):
+			settings = append(settings, s)
+		case hasOwnKey(s, "Template") && s.Key("Template").MustBool(false):
+			templates = append(templates, s)
+		default:
+			segments = append(segments, s)
+		}
+	}
+	sort.SliceStable(settings, func(i, j int) bool {
+		return settings[i].Name() < settings[j].Name()
+	})
+	sort.SliceStable(templates, func(i, j int) bool {
+		return templates[i].Name() < templates[j].Name()
+	})
+	priority := func(s *ini.Section) int {
+		if ps, found := c.Segments[s.Name()]; found {
+			return ps.Priority
+		}
+		if ps, found := c.ShadowSegments[s.Name()]; found {
+			return ps.Priority
+		}
+		return 0
+	}
+	sort.SliceStable(segments, func(i, j int) bool {
+		pi, pj := priority(segments[i]), priority(segments[j])
+		if pi != pj {
+			return pi > pj
+		}
+		return segments[i].Name() < segments[j].Name()
+	})
+	for _, group := range [][]*ini.Section{settings, templates, segments} {
+		for _, s := range group {
+			if buf.Len() != 0 {
+				buf.WriteString("\n")
+			}
+			writeComment(&buf, s.Comment)
+			buf.WriteString(fmt.Sprintf("[%s]\n", s.Name()))
+			switch s.Name() {
+			case settingsSection:
+				writeKeys(&buf, s, settingsKeyOrder)
+			case repositoriesSection, teamsSection, labelsSection, commentsSection, unavailableSection:
+				writeKeys(&buf, s, sortedKeyNames(s))
+			default:
+				writeKeys(&buf, s, segmentKeyOrder)
+			}
+		}
+	}
+	return buf.String(), nil
+}
+
+func sortedKeyNames(s *ini.Section) []string {
+	names := s.KeyStrings()
+	sort.Strings(names)
+	return names
+}
+
+// formatMaintainers rewrites the maintainers file in canonical format,
+// in check mode it only reports if the file is not formatted
+func formatMaintainers(c *Config, maintainersFileName string, check bool) error {
+	if isRemoteFile(maintainersFileName) {
+		return errors.New("Remote maintainers files cannot be modified")
+	}
+	content, err := ioutil.ReadFile(maintainersFileName)
+	if err != nil {
+		return fmt.Errorf("Failed to read maintainers file: %s", err)
+	}
+	formatted, err := formatMaintainersFile(c, content)
+	if err != nil {
+		return err
+	}
+	if formatted == string(content) {
+		return nil
+	}
+	if check {
+		return fmt.Errorf("Maintainers file %s is not formatted, run `chiefr fmt`", maintainersFileName)
+	}
+	err = ioutil.WriteFile(maintainersFileName, []byte(formatted), 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to write maintainers file: %s", err)
+	}
+	fmt.Printf("Maintainers file %s formatted\n", maintainersFileName)
+	return nil
+}
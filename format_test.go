@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFormatMaintainersFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "formatted file is kept",
+			content: "[chiefr]\nVersion = 2\n\n[core]\nChiefs = x\nPriority = 1\n",
+			want:    "[chiefr]\nVersion = 2\n\n[core]\nChiefs = x\nPriority = 1\n",
+		},
+		{
+			name:    "keys are ordered",
+			content: "[core]\nPriority = 1\nFilePatterns = ^core/\nChiefs = x\n",
+			want:    "[core]\nChiefs = x\nFilePatterns = ^core/\nPriority = 1\n",
+		},
+		{
+			name:    "settings first, segments by priority and name",
+			content: "[b]\nChiefs = y\n\n[c]\nChiefs = z\nPriority = 2\n\n[a]\nChiefs = x\n\n[chiefr]\nLabelStrategy = segment\nVersion = 2\n",
+			want:    "[chiefr]\nVersion = 2\nLabelStrategy = segment\n\n[c]\nChiefs = z\nPriority = 2\n\n[a]\nChiefs = x\n\n[b]\nChiefs = y\n",
+		},
+		{
+			name:    "templates before segments",
+			content: "[core]\nExtends = base\nChiefs = x\n\n[base]\nTemplate = true\nRepository = https://github.com/asciimoo/chiefr\n",
+			want:    "[base]\nTemplate = true\nRepository = https://github.com/asciimoo/chiefr\n\n[core]\nExtends = base\nChiefs = x\n",
+		},
+		{
+			name:    "lists are normalized",
+			content: "[core]\nChiefs = x,y ,  z\n",
+			want:    "[core]\nChiefs = x, y, z\n",
+		},
+		{
+			name:    "comments are kept",
+			content: "; core code\n[core]\n; the owners\nChiefs = x\n",
+			want:    "; core code\n[core]\n; the owners\nChiefs = x\n",
+		},
+		{
+			name:    "comment characters are quoted",
+			content: "[core]\nChiefs = x\nChat = \"\"\"irc://libera/#chiefr\"\"\"\n",
+			want:    "[core]\nChat = \"\"\"irc://libera/#chiefr\"\"\"\nChiefs = x\n",
+		},
+		{
+			name:    "team sections are sorted",
+			content: "[chiefr.teams]\nweb = y\napi = x\n\n[core]\nChiefs = x\n",
+			want:    "[chiefr.teams]\napi = x\nweb = y\n\n[core]\nChiefs = x\n",
+		},
+	}
+	for _, tt := range tests {
+		c, err := parseMaintainers("test.ini", []byte(tt.content), true, nil)
+		if err != nil {
+			t.Errorf("%s: failed to parse maintainers file: %s", tt.name, err)
+			continue
+		}
+		got, err := formatMaintainersFile(c, []byte(tt.content))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		// formatting is idempotent
+		again, err := formatMaintainersFile(c, []byte(got))
+		if err != nil || again != got {
+			t.Errorf("%s: formatting the formatted file changed it to %q (%v)", tt.name, again, err)
+		}
+	}
+}
+
+func TestQuoteValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"irc://libera/#chiefr", `"""irc://libera/#chiefr"""`},
+		{"a;b", `"""a;b"""`},
+		{"line\nline", "\"\"\"line\nline\"\"\""},
+		{`has """ and #`, "`has \"\"\" and #`"},
+	}
+	for _, tt := range tests {
+		if got := quoteValue(tt.value); got != tt.want {
+			t.Errorf("quoteValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,938 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitLabManager handles the merge requests and issues of gitlab.com and self-hosted GitLab instances
+// through the REST API v4
+type GitLabManager struct {
+	APIKey     string
+	DryRun     bool
+	Sync       bool
+	LockReason string
+	// IDs of the users indexed by lowercase username
+	userIDs map[string]int
+	// Users not assigned or requested to review
+	excludedUsers []string
+	// Event triggering the changes, see audit
+	event string
+	// ID of the authenticated user, see botUserID
+	botID int
+}
+
+type gitlabUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+type gitlabMergeRequest struct {
+	IID          int          `json:"iid"`
+	Description  string       `json:"description"`
+	Draft        bool         `json:"draft"`
+	SHA          string       `json:"sha"`
+	SourceBranch string       `json:"source_branch"`
+	TargetBranch string       `json:"target_branch"`
+	WebURL       string       `json:"web_url"`
+	Author       gitlabUser   `json:"author"`
+	Labels       []string     `json:"labels"`
+	Assignees    []gitlabUser `json:"assignees"`
+	Reviewers    []gitlabUser `json:"reviewers"`
+}
+
+// isGitLabURL reports whether the URL belongs to GitLab, self-hosted instances are recognized by
+// the /-/ path separator of merge requests and issues or by a gitlab host name
+func isGitLabURL(URL *url.URL) bool {
+	return strings.Contains(URL.Path, "/-/merge_requests/") || strings.Contains(URL.Path, "/-/issues/") || strings.Contains(URL.Host, "gitlab")
+}
+
+// parseGitLabURL returns the API URL, the project path and the number of a merge request or issue URL,
+// kind is the path segment before the number: "merge_requests" or "issues"
+func parseGitLabURL(u, kind string) (string, string, int, error) {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return "", "", 0, err
+	}
+	sep := "/-/" + kind + "/"
+	i := strings.Index(URL.Path, sep)
+	if i < 1 {
+		return "", "", 0, errors.New("Invalid URL")
+	}
+	num, err := strconv.Atoi(strings.Trim(URL.Path[i+len(sep):], "/"))
+	if err != nil {
+		return "", "", 0, errors.New("Invalid URL")
+	}
+	return gitlabAPIURL(URL), strings.Trim(URL.Path[:i], "/"), num, nil
+}
+
+// parseGitLabRepositoryURL returns the API URL and the project path of a repository URL
+func parseGitLabRepositoryURL(u string) (string, string, error) {
+	URL, err := url.Parse(strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git"))
+	if err != nil || URL.Host == "" || strings.Trim(URL.Path, "/") == "" {
+		return "", "", errors.New("Invalid GitLab repository URL")
+	}
+	return gitlabAPIURL(URL), strings.Trim(URL.Path, "/"), nil
+}
+
+func gitlabAPIURL(URL *url.URL) string {
+	return fmt.Sprintf("%s://%s/api/v4", URL.Scheme, URL.Host)
+}
+
+func gitlabProject(project string) string {
+	return "/projects/" + url.PathEscape(project)
+}
+
+// gitlabTokenTransport authenticates the requests with the private token header of GitLab
+type gitlabTokenTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (t *gitlabTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Header.Set("PRIVATE-TOKEN", t.token)
+	return t.base.RoundTrip(r)
+}
+
+func (g *GitLabManager) httpClient() *http.Client {
+	return &http.Client{Transport: &retryTransport{
+		base:       &etagTransport{base: &gitlabTokenTransport{base: http.DefaultTransport, token: g.APIKey}, dir: apiCacheDir, token: g.APIKey},
+		maxRetries: apiMaxRetries,
+	}}
+}
+
+// api sends the request with the JSON body and decodes the JSON response to the result,
+// the number of the next page of list responses is returned, 0 on the last page
+func (g *GitLabManager) api(method, apiURL, path string, body, result interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequest(method, apiURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := g.httpClient().Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("%s %s: %s", method, path, strings.TrimSpace(resp.Status+" "+string(message)))
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return 0, fmt.Errorf("Invalid GitLab API response: %s", err)
+		}
+	}
+	next, _ := strconv.Atoi(resp.Header.Get("X-Next-Page"))
+	return next, nil
+}
+
+func (g *GitLabManager) SetAPIKey(key string) {
+	g.APIKey = key
+}
+
+func (g *GitLabManager) SetDryRun(dryRun bool) {
+	g.DryRun = dryRun
+}
+
+func (g *GitLabManager) SetSync(sync bool) {
+	g.Sync = sync
+}
+
+func (g *GitLabManager) SetLockReason(reason string) {
+	g.LockReason = reason
+}
+
+func (g *GitLabManager) SetExcludedUsers(users []string) {
+	g.excludedUsers = users
+}
+
+func (g *GitLabManager) SetEvent(event string) {
+	g.event = event
+}
+
+func (g *GitLabManager) mergeRequest(apiURL, project string, iid int) (*gitlabMergeRequest, error) {
+	mr := &gitlabMergeRequest{}
+	_, err := g.api("GET", apiURL, fmt.Sprintf("%s/merge_requests/%d", gitlabProject(project), iid), nil, mr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get merge request: %s", err)
+	}
+	return mr, nil
+}
+
+// userID returns the ID of the user, 0 if the user doesn't exist
+func (g *GitLabManager) userID(apiURL, username string) (int, error) {
+	if g.userIDs == nil {
+		g.userIDs = make(map[string]int)
+	}
+	if id, found := g.userIDs[strings.ToLower(username)]; found {
+		return id, nil
+	}
+	users := make([]gitlabUser, 0)
+	_, err := g.api("GET", apiURL, "/users?username="+url.QueryEscape(username), nil, &users)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to look up user '%s': %s", username, err)
+	}
+	id := 0
+	if len(users) != 0 {
+		id = users[0].ID
+	}
+	g.userIDs[strings.ToLower(username)] = id
+	return id, nil
+}
+
+// userIDs returns the IDs of the existing users after the IDs of the current users
+func (g *GitLabManager) appendUserIDs(apiURL string, current []gitlabUser, usernames []string) ([]int, error) {
+	ids := make([]int, 0, len(current)+len(usernames))
+	seen := make(map[int]bool)
+	for _, u := range current {
+		ids = append(ids, u.ID)
+		seen[u.ID] = true
+	}
+	for _, username := range usernames {
+		id, err := g.userID(apiURL, username)
+		if err != nil {
+			return nil, err
+		}
+		if id == 0 {
+			fmt.Fprintf(os.Stderr, "Warning! GitLab user '%s' not found\n", username)
+			continue
+		}
+		if !seen[id] {
+			ids = append(ids, id)
+			seen[id] = true
+		}
+	}
+	return ids, nil
+}
+
+// gitlabNote is a comment of a merge request or issue
+type gitlabNote struct {
+	ID     int        `json:"id"`
+	Body   string     `json:"body"`
+	Author gitlabUser `json:"author"`
+}
+
+// botUserID returns the ID of the authenticated user writing the comments of chiefr
+func (g *GitLabManager) botUserID(apiURL string) (int, error) {
+	if g.botID != 0 {
+		return g.botID, nil
+	}
+	var user gitlabUser
+	if _, err := g.api("GET", apiURL, "/user", nil, &user); err != nil {
+		return 0, fmt.Errorf("Failed to get authenticated user: %s", err)
+	}
+	g.botID = user.ID
+	return g.botID, nil
+}
+
+// findNote returns the oldest comment of the merge request or issue with the marker written by chiefr,
+// nil if there isn't any, anyone can post the marker, so the comments of other users are ignored
+func (g *GitLabManager) findNote(apiURL, project, kind string, iid int, marker string) (*gitlabNote, error) {
+	author, err := g.botUserID(apiURL)
+	if err != nil {
+		return nil, err
+	}
+	notesPath := fmt.Sprintf("%s/%s/%d/notes", gitlabProject(project), kind, iid)
+	for page := 1; page != 0; {
+		var notes []gitlabNote
+		// the notes are listed newest first by default
+		next, err := g.api("GET", apiURL, fmt.Sprintf("%s?sort=asc&order_by=created_at&per_page=100&page=%d", notesPath, page), nil, &notes)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list comments: %s", err)
+		}
+		for i := range notes {
+			if strings.Contains(notes[i].Body, marker) && notes[i].Author.ID == author {
+				return &notes[i], nil
+			}
+		}
+		page = next
+	}
+	return nil, nil
+}
+
+// upsertNote comments on the merge request or issue, the existing comment of chiefr with the marker
+// is updated instead, the comments of other users quoting the marker are left alone
+func (g *GitLabManager) upsertNote(apiURL, project, kind string, iid int, marker, comment string) error {
+	body := comment + "\n" + marker
+	notesPath := fmt.Sprintf("%s/%s/%d/notes", gitlabProject(project), kind, iid)
+	note, err := g.findNote(apiURL, project, kind, iid, marker)
+	if err != nil {
+		return err
+	}
+	if note != nil {
+		if note.Body == body {
+			return nil
+		}
+		_, err = g.api("PUT", apiURL, fmt.Sprintf("%s/%d", notesPath, note.ID), map[string]string{"body": body}, nil)
+		if err != nil {
+			return fmt.Errorf("Failed to update comment: %s", err)
+		}
+		audit(g.event, "update-comment", gitlabTarget(project, kind, iid), marker)
+		return nil
+	}
+	if _, err := g.api("POST", apiURL, notesPath, map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("Failed to create comment: %s", err)
+	}
+	audit(g.event, "comment", gitlabTarget(project, kind, iid), marker)
+	return nil
+}
+
+func (g *GitLabManager) PullRequestState(u string) (*pullRequestState, error) {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return nil, errors.New("Invalid merge request URL")
+	}
+	return g.mergeRequestState(apiURL, project, iid)
+}
+
+func (g *GitLabManager) SavePullRequestState(u string, state *pullRequestState) error {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return errors.New("Invalid merge request URL")
+	}
+	if g.DryRun {
+		fmt.Printf("Would record the state of %s\n", u)
+		return nil
+	}
+	return g.saveState(apiURL, project, iid, state)
+}
+
+// mergeRequestState returns what chiefr recorded as applied to the merge request
+func (g *GitLabManager) mergeRequestState(apiURL, project string, iid int) (*pullRequestState, error) {
+	note, err := g.findNote(apiURL, project, "merge_requests", iid, stateCommentMarker)
+	if err != nil {
+		return nil, err
+	}
+	if note == nil {
+		return &pullRequestState{}, nil
+	}
+	return parsePullRequestState(note.Body)
+}
+
+// saveState records what chiefr applied to the merge request, nothing is commented while the state is empty
+func (g *GitLabManager) saveState(apiURL, project string, iid int, state *pullRequestState) error {
+	if state.empty() {
+		note, err := g.findNote(apiURL, project, "merge_requests", iid, stateCommentMarker)
+		if err != nil || note == nil {
+			return err
+		}
+	}
+	comment, err := state.comment()
+	if err != nil {
+		return err
+	}
+	return g.upsertNote(apiURL, project, "merge_requests", iid, stateCommentMarker, comment)
+}
+
+func (g *GitLabManager) HandlePullRequest(u string, c *Config, os orderedSegmentList, extraLabels []string, close bool) error {
+	if len(os) == 0 {
+		return fmt.Errorf("No matching segments found for this patch. Please edit your maintainers file")
+	}
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return errors.New("Invalid merge request URL")
+	}
+	mrPath := fmt.Sprintf("%s/merge_requests/%d", gitlabProject(project), iid)
+	labels := c.Settings.getLabels(os)
+	for _, l := range extraLabels {
+		appendNew(&labels, l)
+	}
+	chiefs := make([]string, 0)
+	reviewers := make([]string, 0)
+	repoURL := ""
+	for _, s := range os {
+		if repoURL == "" && strings.HasPrefix(u, s.Repository) {
+			repoURL = s.Repository
+		}
+		for _, chief := range s.Chiefs {
+			appendNew(&chiefs, chief)
+		}
+		for _, reviewer := range s.Reviewers {
+			appendNew(&reviewers, reviewer)
+		}
+	}
+	if len(chiefs) == 0 {
+		return errors.New("Chiefs not found for this merge request")
+	}
+	if repoURL == "" {
+		if !close {
+			return errors.New("No repository found for this merge request")
+		}
+		repositories := c.suggestedRepositories(os)
+		comment, err := c.renderComment(closeCommentTemplate, &commentData{
+			PullRequest:  u,
+			Segments:     os,
+			Repository:   os[0].Repository,
+			Repositories: repositories,
+			Transfers:    make([]*transferInstructions, 0),
+		})
+		if err != nil {
+			return err
+		}
+		commentOnly := c.Settings.WrongRepositoryAction == wrongRepositoryComment
+		if g.DryRun {
+			fmt.Printf("Would comment on %s:\n%s\n", u, comment)
+			if !commentOnly {
+				fmt.Printf("Would close %s\n", u)
+				if g.LockReason != "" {
+					fmt.Printf("Would lock %s\n", u)
+				}
+			}
+			return nil
+		}
+		err = g.upsertNote(apiURL, project, "merge_requests", iid, closeCommentMarker, comment)
+		if err != nil || commentOnly {
+			return err
+		}
+		update := map[string]interface{}{"state_event": "close"}
+		// GitLab locks discussions without reason
+		if g.LockReason != "" {
+			update["discussion_locked"] = true
+		}
+		if _, err := g.api("PUT", apiURL, mrPath, update, nil); err != nil {
+			return fmt.Errorf("Failed to close merge request: %s", err)
+		}
+		audit(g.event, "close", gitlabTarget(project, "merge_requests", iid))
+		if g.LockReason != "" {
+			audit(g.event, "lock", gitlabTarget(project, "merge_requests", iid))
+		}
+		return nil
+	}
+
+	mr := &gitlabMergeRequest{}
+	if !g.DryRun {
+		mr, err = g.mergeRequest(apiURL, project, iid)
+		if err != nil {
+			return err
+		}
+		if mr.Draft && c.Settings.DraftPolicy == draftPolicySkip {
+			fmt.Printf("Skipping draft merge request %s\n", u)
+			return nil
+		}
+	}
+	deferAssignment := mr.Draft && c.Settings.DraftPolicy == draftPolicyLabel
+	rotation := make(rotationState)
+	roundRobin := c.usesAssignStrategy(os, assignStrategyRoundRobin)
+	if roundRobin {
+		unlock, err := lockRotationState(c.rotationState)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		rotation, err = loadRotationState(c.rotationState)
+		if err != nil {
+			return err
+		}
+	}
+	history, err := c.assignmentHistory(os)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	// GitHub team references can't be assigned on GitLab
+	skip := func(login string) bool {
+		return strings.EqualFold(login, mr.Author.Username) || strings.HasPrefix(login, "@") || c.unavailable(login, now) || containsUser(g.excludedUsers, login)
+	}
+	// the load of the chiefs isn't counted on GitLab, the recent assignments of the history decide
+	assigned := make([]string, 0, len(mr.Assignees))
+	for _, a := range mr.Assignees {
+		assigned = append(assigned, a.Username)
+	}
+	chiefs, err = c.selectChiefs(repoURL, os, skip, rotation, history, assigned, func(string) (int, error) { return 0, nil })
+	if err != nil {
+		return err
+	}
+	reviewers = removeUsers(reviewers, skip)
+	if len(chiefs) > c.Settings.MaxAssignees {
+		chiefs = chiefs[:c.Settings.MaxAssignees]
+	}
+	if g.DryRun {
+		fmt.Printf("Would add labels to %s: %s\n", u, strings.Join(labels, ", "))
+		if len(chiefs) != 0 {
+			fmt.Printf("Would add assignees to %s: %s\n", u, strings.Join(chiefs, ", "))
+		}
+		if len(reviewers) != 0 {
+			fmt.Printf("Would request reviews on %s from: %s\n", u, strings.Join(reviewers, ", "))
+		}
+		if c.Settings.SummaryComment {
+			summary, err := c.renderComment(summaryCommentTemplate, &commentData{PullRequest: u, Segments: os})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Would comment on %s:\n%s\n", u, summary)
+		}
+		if len(c.Settings.sizeLabels) != 0 {
+			fmt.Printf("Would remove the outdated size labels of %s\n", u)
+		}
+		if g.Sync {
+			fmt.Printf("Would remove the labels applied by chiefr which don't match %s anymore\n", u)
+		}
+		return nil
+	}
+	if deferAssignment {
+		fmt.Printf("Deferring the assignment of draft merge request %s\n", u)
+		chiefs, reviewers = nil, nil
+		roundRobin = false
+	}
+	// labels, assignees and reviewers are updated in one request
+	update := make(map[string]interface{})
+	present := make(map[string]bool)
+	for _, l := range mr.Labels {
+		present[strings.ToLower(l)] = true
+	}
+	missing := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if !present[strings.ToLower(l)] {
+			missing = append(missing, l)
+		}
+	}
+	if len(missing) != 0 {
+		update["add_labels"] = strings.Join(missing, ",")
+	}
+	// the outdated size labels are always removed, the other labels only if they were applied by earlier runs
+	stale := c.Settings.staleSizeLabels(mr.Labels, labels)
+	record := &pullRequestState{}
+	if g.Sync {
+		recorded, err := g.mergeRequestState(apiURL, project, iid)
+		if err != nil {
+			return err
+		}
+		*record = *recorded
+		var syncStale []string
+		syncStale, record.Labels = syncApplied(recorded.Labels, removeLabels(mr.Labels, stale), labels, missing)
+		stale = append(stale, syncStale...)
+	}
+	if len(stale) != 0 {
+		update["remove_labels"] = strings.Join(stale, ",")
+	}
+	if len(chiefs) != 0 {
+		ids, err := g.appendUserIDs(apiURL, mr.Assignees, chiefs)
+		if err != nil {
+			return err
+		}
+		update["assignee_ids"] = ids
+	}
+	if len(reviewers) != 0 {
+		ids, err := g.appendUserIDs(apiURL, mr.Reviewers, reviewers)
+		if err != nil {
+			return err
+		}
+		update["reviewer_ids"] = ids
+	}
+	if len(update) != 0 {
+		if _, err := g.api("PUT", apiURL, mrPath, update, nil); err != nil {
+			return fmt.Errorf("Failed to update merge request: %s", err)
+		}
+	}
+	target := gitlabTarget(project, "merge_requests", iid)
+	if len(missing) != 0 {
+		audit(g.event, "add-labels", target, missing...)
+	}
+	if len(stale) != 0 {
+		audit(g.event, "remove-labels", target, stale...)
+	}
+	if g.Sync {
+		if err := g.saveState(apiURL, project, iid, record); err != nil {
+			return err
+		}
+	}
+	if len(chiefs) != 0 {
+		audit(g.event, "add-assignees", target, chiefs...)
+	}
+	if len(reviewers) != 0 {
+		audit(g.event, "request-reviews", target, reviewers...)
+	}
+	if err := c.recordAssignments(repoURL, u, chiefs); err != nil {
+		return err
+	}
+	if roundRobin {
+		if err := rotation.save(c.rotationState); err != nil {
+			return err
+		}
+	}
+	if c.Settings.SummaryComment {
+		summary, err := c.renderComment(summaryCommentTemplate, &commentData{PullRequest: u, Segments: os})
+		if err != nil {
+			return err
+		}
+		return g.upsertNote(apiURL, project, "merge_requests", iid, summaryCommentMarker, summary)
+	}
+	return nil
+}
+
+func (g *GitLabManager) CommentIssue(u, marker, comment string) error {
+	apiURL, project, iid, err := parseGitLabURL(u, "issues")
+	if err != nil {
+		return errors.New("Invalid issue URL")
+	}
+	if g.DryRun {
+		fmt.Printf("Would comment on %s:\n%s\n", u, comment)
+		return nil
+	}
+	return g.upsertNote(apiURL, project, "issues", iid, marker, comment)
+}
+
+func (g *GitLabManager) PullRequestRefs(u string) (*pullRequestRefs, error) {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return nil, errors.New("Invalid merge request URL")
+	}
+	mr, err := g.mergeRequest(apiURL, project, iid)
+	if err != nil {
+		return nil, err
+	}
+	var p struct {
+		HTTPURLToRepo string `json:"http_url_to_repo"`
+	}
+	if _, err := g.api("GET", apiURL, gitlabProject(project), nil, &p); err != nil {
+		return nil, fmt.Errorf("Failed to get project: %s", err)
+	}
+	return &pullRequestRefs{
+		Number:   iid,
+		CloneURL: p.HTTPURLToRepo,
+		Head:     fmt.Sprintf("refs/merge-requests/%d/head", iid),
+		Base:     "refs/heads/" + mr.TargetBranch,
+	}, nil
+}
+
+func (g *GitLabManager) PublishCheckRun(u string, report *ownershipReport) error {
+	return errors.New("Check runs are not supported on GitLab, use --commit-status instead")
+}
+
+func (g *GitLabManager) PullRequestAuthor(u string) (string, error) {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return "", errors.New("Invalid merge request URL")
+	}
+	mr, err := g.mergeRequest(apiURL, project, iid)
+	if err != nil {
+		return "", err
+	}
+	return mr.Author.Username, nil
+}
+
+func (g *GitLabManager) PullRequestApprovals(u string) ([]string, error) {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return nil, errors.New("Invalid merge request URL")
+	}
+	var approvals struct {
+		ApprovedBy []struct {
+			User gitlabUser `json:"user"`
+		} `json:"approved_by"`
+	}
+	_, err = g.api("GET", apiURL, fmt.Sprintf("%s/merge_requests/%d/approvals", gitlabProject(project), iid), nil, &approvals)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get approvals of merge request: %s", err)
+	}
+	approved := make([]string, 0, len(approvals.ApprovedBy))
+	for _, a := range approvals.ApprovedBy {
+		approved = append(approved, a.User.Username)
+	}
+	return approved, nil
+}
+
+func (g *GitLabManager) ExpandTeams(users []string) ([]string, error) {
+	for _, u := range users {
+		if strings.HasPrefix(u, "@") {
+			return nil, fmt.Errorf("GitHub team '%s' can't be resolved on GitLab", u)
+		}
+	}
+	return users, nil
+}
+
+func (g *GitLabManager) MergePullRequest(u, method string, auto bool) error {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return errors.New("Invalid merge request URL")
+	}
+	if g.DryRun {
+		if auto {
+			fmt.Printf("Would merge %s when its pipeline succeeds\n", u)
+		} else {
+			fmt.Printf("Would merge %s\n", u)
+		}
+		return nil
+	}
+	mr, err := g.mergeRequest(apiURL, project, iid)
+	if err != nil {
+		return err
+	}
+	// the merge method is a project setting on GitLab, squashing can be requested per merge request
+	merge := map[string]interface{}{"sha": mr.SHA, "squash": method == "squash"}
+	if auto {
+		merge["merge_when_pipeline_succeeds"] = true
+	}
+	_, err = g.api("PUT", apiURL, fmt.Sprintf("%s/merge_requests/%d/merge", gitlabProject(project), iid), merge, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to merge merge request: %s", err)
+	}
+	if auto {
+		audit(g.event, "enable-auto-merge", gitlabTarget(project, "merge_requests", iid), method)
+		fmt.Printf("Enabled merging %s when its pipeline succeeds\n", u)
+	} else {
+		audit(g.event, "merge", gitlabTarget(project, "merge_requests", iid), method)
+		fmt.Printf("Merged %s\n", u)
+	}
+	return nil
+}
+
+func (g *GitLabManager) PublishCommitStatus(u string, report *ownershipReport) error {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return errors.New("Invalid merge request URL")
+	}
+	state := report.conclusion()
+	description := report.title()
+	if g.DryRun {
+		fmt.Printf("Would set commit status '%s' of %s to %s: %s\n", ownershipCheckName, u, state, description)
+		return nil
+	}
+	mr, err := g.mergeRequest(apiURL, project, iid)
+	if err != nil {
+		return err
+	}
+	if state == "failure" {
+		state = "failed"
+	}
+	_, err = g.api("POST", apiURL, fmt.Sprintf("%s/statuses/%s", gitlabProject(project), mr.SHA), map[string]string{
+		"state":       state,
+		"name":        ownershipCheckName,
+		"description": description,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to set commit status: %s", err)
+	}
+	audit(g.event, "commit-status", gitlabTarget(project, "merge_requests", iid), state)
+	return nil
+}
+
+func (g *GitLabManager) PullRequestDescription(u string) (string, error) {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return "", errors.New("Invalid merge request URL")
+	}
+	mr, err := g.mergeRequest(apiURL, project, iid)
+	if err != nil {
+		return "", err
+	}
+	return mr.Description, nil
+}
+
+func (g *GitLabManager) OpenPullRequests(repoURL string) ([]string, error) {
+	apiURL, project, err := parseGitLabRepositoryURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, 0)
+	for page := 1; page != 0; {
+		var mrs []gitlabMergeRequest
+		next, err := g.api("GET", apiURL, fmt.Sprintf("%s/merge_requests?state=opened&per_page=100&page=%d", gitlabProject(project), page), nil, &mrs)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list open merge requests: %s", err)
+		}
+		for _, mr := range mrs {
+			urls = append(urls, mr.WebURL)
+		}
+		page = next
+	}
+	return urls, nil
+}
+
+func (g *GitLabManager) Issue(u string) (*issueContent, error) {
+	apiURL, project, iid, err := parseGitLabURL(u, "issues")
+	if err != nil {
+		return nil, errors.New("Invalid issue URL")
+	}
+	var issue struct {
+		Title       string       `json:"title"`
+		Description string       `json:"description"`
+		Author      gitlabUser   `json:"author"`
+		Assignees   []gitlabUser `json:"assignees"`
+	}
+	_, err = g.api("GET", apiURL, fmt.Sprintf("%s/issues/%d", gitlabProject(project), iid), nil, &issue)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get issue: %s", err)
+	}
+	content := &issueContent{Title: issue.Title, Body: issue.Description, Author: issue.Author.Username}
+	for _, a := range issue.Assignees {
+		content.Assignees = append(content.Assignees, a.Username)
+	}
+	return content, nil
+}
+
+func (g *GitLabManager) HandleIssue(u string, c *Config, os orderedSegmentList, issue *issueContent) error {
+	if len(os) == 0 {
+		return errors.New("No matching segments found for this issue")
+	}
+	apiURL, project, iid, err := parseGitLabURL(u, "issues")
+	if err != nil {
+		return errors.New("Invalid issue URL")
+	}
+	labels := c.Settings.getLabels(os)
+	rotation := make(rotationState)
+	roundRobin := c.usesAssignStrategy(os, assignStrategyRoundRobin)
+	if roundRobin {
+		unlock, err := lockRotationState(c.rotationState)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		rotation, err = loadRotationState(c.rotationState)
+		if err != nil {
+			return err
+		}
+	}
+	history, err := c.assignmentHistory(os)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	skip := func(login string) bool {
+		return strings.EqualFold(login, issue.Author) || strings.HasPrefix(login, "@") || c.unavailable(login, now) || containsUser(g.excludedUsers, login)
+	}
+	repoURL := strings.TrimSuffix(strings.SplitN(u, "/-/", 2)[0], "/")
+	chiefs, err := c.selectChiefs(repoURL, os, skip, rotation, history, issue.Assignees, func(string) (int, error) { return 0, nil })
+	if err != nil {
+		return err
+	}
+	if len(chiefs) > c.Settings.MaxAssignees {
+		chiefs = chiefs[:c.Settings.MaxAssignees]
+	}
+	if g.DryRun {
+		fmt.Printf("Would add labels to %s: %s\n", u, strings.Join(labels, ", "))
+		if len(chiefs) != 0 {
+			fmt.Printf("Would add assignees to %s: %s\n", u, strings.Join(chiefs, ", "))
+		}
+		return nil
+	}
+	update := map[string]interface{}{"add_labels": strings.Join(labels, ",")}
+	if len(chiefs) != 0 {
+		ids, err := g.appendUserIDs(apiURL, nil, chiefs)
+		if err != nil {
+			return err
+		}
+		update["assignee_ids"] = ids
+	}
+	if _, err := g.api("PUT", apiURL, fmt.Sprintf("%s/issues/%d", gitlabProject(project), iid), update, nil); err != nil {
+		return fmt.Errorf("Failed to update issue: %s", err)
+	}
+	audit(g.event, "add-labels", gitlabTarget(project, "issues", iid), labels...)
+	if len(chiefs) != 0 {
+		audit(g.event, "add-assignees", gitlabTarget(project, "issues", iid), chiefs...)
+	}
+	if err := c.recordAssignments(repoURL, u, chiefs); err != nil {
+		return err
+	}
+	if roundRobin {
+		return rotation.save(c.rotationState)
+	}
+	return nil
+}
+
+func (g *GitLabManager) PullRequestAssignees(u string) ([]string, error) {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return nil, errors.New("Invalid merge request URL")
+	}
+	mr, err := g.mergeRequest(apiURL, project, iid)
+	if err != nil {
+		return nil, err
+	}
+	assignees := make([]string, 0, len(mr.Assignees))
+	for _, a := range mr.Assignees {
+		assignees = append(assignees, a.Username)
+	}
+	return assignees, nil
+}
+
+func (g *GitLabManager) RemoveAssignees(u string, users []string) error {
+	apiURL, project, iid, err := parseGitLabURL(u, "merge_requests")
+	if err != nil {
+		return errors.New("Invalid merge request URL")
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	if g.DryRun {
+		fmt.Printf("Would remove assignees and reviewers from %s: %s\n", u, strings.Join(users, ", "))
+		return nil
+	}
+	mr, err := g.mergeRequest(apiURL, project, iid)
+	if err != nil {
+		return err
+	}
+	// the remaining users are set, an empty list unassigns everyone
+	remaining := func(current []gitlabUser) ([]int, bool) {
+		ids := make([]int, 0, len(current))
+		for _, c := range current {
+			if !containsUser(users, c.Username) {
+				ids = append(ids, c.ID)
+			}
+		}
+		return ids, len(ids) != len(current)
+	}
+	update := make(map[string]interface{})
+	if ids, changed := remaining(mr.Assignees); changed {
+		update["assignee_ids"] = ids
+	}
+	if ids, changed := remaining(mr.Reviewers); changed {
+		update["reviewer_ids"] = ids
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	if _, err := g.api("PUT", apiURL, fmt.Sprintf("%s/merge_requests/%d", gitlabProject(project), iid), update, nil); err != nil {
+		return fmt.Errorf("Failed to remove assignees: %s", err)
+	}
+	audit(g.event, "remove-assignees", gitlabTarget(project, "merge_requests", iid), users...)
+	fmt.Printf("Removed assignees and reviewers: %s\n", strings.Join(users, ", "))
+	return nil
+}
+
+func (g *GitLabManager) RepositoryFile(repoURL, path string) ([]byte, error) {
+	apiURL, project, err := parseGitLabRepositoryURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	// the raw file endpoint returns the content instead of JSON
+	u := fmt.Sprintf("%s%s/repository/files/%s/raw?ref=HEAD", apiURL, gitlabProject(project), url.PathEscape(path))
+	resp, err := g.httpClient().Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file '%s': %s", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("Failed to get file '%s': %s", path, resp.Status)
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file '%s': %s", path, err)
+	}
+	return content, nil
+}
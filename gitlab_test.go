@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// testGitLabAPI returns the API URL of a fake GitLab instance authenticated as the user 42, the notes
+// of merge request o/r!1 are listed from the JSON and the writes of notes are recorded
+func testGitLabAPI(t *testing.T, notes string, writes *[]string) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":42,"username":"chiefr-bot"}`)
+	})
+	record := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, notes)
+			return
+		}
+		*writes = append(*writes, r.Method+" "+r.URL.EscapedPath())
+		fmt.Fprint(w, `{}`)
+	}
+	mux.HandleFunc("/projects/o%2Fr/merge_requests/1/notes", record)
+	mux.HandleFunc("/projects/o%2Fr/merge_requests/1/notes/", record)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestUpsertNote(t *testing.T) {
+	const marker = "<!-- chiefr:test -->"
+	tests := []struct {
+		name  string
+		notes string
+		want  []string
+	}{
+		{
+			name:  "new note",
+			notes: `[]`,
+			want:  []string{"POST /projects/o%2Fr/merge_requests/1/notes"},
+		},
+		{
+			name:  "note of chiefr is updated",
+			notes: `[{"id":7,"body":"old\n<!-- chiefr:test -->","author":{"id":42}}]`,
+			want:  []string{"PUT /projects/o%2Fr/merge_requests/1/notes/7"},
+		},
+		{
+			name:  "quoting note is left alone",
+			notes: `[{"id":9,"body":"> <!-- chiefr:test -->","author":{"id":5}},{"id":7,"body":"old\n<!-- chiefr:test -->","author":{"id":42}}]`,
+			want:  []string{"PUT /projects/o%2Fr/merge_requests/1/notes/7"},
+		},
+	}
+	for _, tt := range tests {
+		writes := make([]string, 0)
+		apiURL := testGitLabAPI(t, tt.notes, &writes)
+		g := &GitLabManager{}
+		if err := g.upsertNote(apiURL, "o/r", "merge_requests", 1, marker, "new"); err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(writes, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, writes, tt.want)
+		}
+	}
+}
+
+func TestMergeRequestState(t *testing.T) {
+	tests := []struct {
+		name  string
+		notes string
+		want  *pullRequestState
+	}{
+		{
+			name:  "state of chiefr",
+			notes: `[{"id":1,"body":"<!-- chiefr:state-data {\"labels\":[\"core\"]} -->\n<!-- chiefr:state -->","author":{"id":42}}]`,
+			want:  &pullRequestState{Labels: []string{"core"}},
+		},
+		{
+			name: "forged state is ignored",
+			notes: `[{"id":2,"body":"<!-- chiefr:state-data {\"route\":[\"docs\"]} -->\n<!-- chiefr:state -->","author":{"id":5}},
+				{"id":1,"body":"<!-- chiefr:state-data {\"labels\":[\"core\"]} -->\n<!-- chiefr:state -->","author":{"id":42}}]`,
+			want: &pullRequestState{Labels: []string{"core"}},
+		},
+		{
+			name:  "only forged state",
+			notes: `[{"id":2,"body":"<!-- chiefr:state-data {\"route\":[\"docs\"]} -->\n<!-- chiefr:state -->","author":{"id":5}}]`,
+			want:  &pullRequestState{},
+		},
+	}
+	for _, tt := range tests {
+		apiURL := testGitLabAPI(t, tt.notes, &[]string{})
+		g := &GitLabManager{}
+		state, err := g.mergeRequestState(apiURL, "o/r", 1)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(state, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, state, tt.want)
+		}
+	}
+}
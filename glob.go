@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// globToRegexp converts a gitignore style glob to a regexp matching file paths:
+// globs without slash match file or directory names at any depth,
+// '**' matches any number of directories and matching directories include their content
+func globToRegexp(glob string) string {
+	var buf strings.Builder
+	glob = strings.TrimSuffix(glob, "/")
+	if strings.HasPrefix(glob, "/") || strings.Contains(glob, "/") {
+		glob = strings.TrimPrefix(glob, "/")
+		buf.WriteString("^")
+	} else {
+		buf.WriteString("^(.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			buf.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			buf.WriteString(".*")
+			i++
+		case c == '*':
+			buf.WriteString("[^/]*")
+		case c == '?':
+			buf.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == -1 {
+				buf.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			buf.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			buf.WriteString(regexp.QuoteMeta(string(glob[i+1])))
+			i++
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteString("(/.*)?$")
+	return buf.String()
+}
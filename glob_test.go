@@ -0,0 +1,46 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/chiefr/main.go", true},
+		{"*.go", "main.goo", false},
+		{"/docs", "docs/index.md", true},
+		{"/docs", "site/docs/index.md", false},
+		{"docs/", "docs/index.md", true},
+		{"docs/", "site/docs/index.md", true},
+		{"docs", "docs", true},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "lib/src/main.go", false},
+		{"src/**", "src/a/b", true},
+		{"a?c", "abc", true},
+		{"a?c", "a/c", false},
+		{"[!a]b", "cb", true},
+		{"[!a]b", "ab", false},
+		{"[ab]c", "bc", true},
+		{"[ab", "[ab", true},
+		{`\*.md`, "*.md", true},
+		{`\*.md`, "README.md", false},
+		{"file.txt", "filextxt", false},
+	}
+	for _, tt := range tests {
+		re, err := regexp.Compile(globToRegexp(tt.glob))
+		if err != nil {
+			t.Errorf("globToRegexp(%q) = %q: %s", tt.glob, globToRegexp(tt.glob), err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.match {
+			t.Errorf("glob %q matching %q = %v, want %v", tt.glob, tt.path, got, tt.match)
+		}
+	}
+}
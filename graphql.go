@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// GitHub APIs of updating pull requests
+const (
+	githubAPIREST    string = "rest"
+	githubAPIGraphQL string = "graphql"
+)
+
+// GitHub API of updating pull requests, set by --github-api
+var githubAPI string = githubAPIREST
+
+// Pull request fetched with the labels of its repository through the GraphQL API
+type graphqlPullRequest struct {
+	*githubPullRequest
+	// Node IDs of the labels of the repository indexed by lowercase name
+	labelIDs map[string]string
+}
+
+// pullRequestGraphQL fetches the pull request and the labels of its repository in one request per 100 labels
+func (g *GitHubManager) pullRequestGraphQL(ctx context.Context, owner, repo string, num int) (*graphqlPullRequest, error) {
+	query := `query($owner: String!, $repo: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      id
+      isDraft
+      author { login }
+      headRefName
+      baseRefName
+      milestone { number title }
+      labels(first: 100) { nodes { name } }
+      assignees(first: 100) { nodes { login } }
+      reviewRequests(first: 100) { nodes { requestedReviewer { ... on User { login } ... on Team { slug } } } }
+    }
+    labels(first: 100, after: $after) {
+      nodes { id name }
+      pageInfo { hasNextPage endCursor }
+    }
+  }
+}`
+	type label struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	var result struct {
+		Repository struct {
+			PullRequest *struct {
+				ID      string `json:"id"`
+				IsDraft bool   `json:"isDraft"`
+				Author  struct {
+					Login string `json:"login"`
+				} `json:"author"`
+				HeadRefName string `json:"headRefName"`
+				BaseRefName string `json:"baseRefName"`
+				Milestone   *struct {
+					Number int    `json:"number"`
+					Title  string `json:"title"`
+				} `json:"milestone"`
+				Labels struct {
+					Nodes []label `json:"nodes"`
+				} `json:"labels"`
+				Assignees struct {
+					Nodes []struct {
+						Login string `json:"login"`
+					} `json:"nodes"`
+				} `json:"assignees"`
+				ReviewRequests struct {
+					Nodes []struct {
+						RequestedReviewer struct {
+							Login string `json:"login"`
+							Slug  string `json:"slug"`
+						} `json:"requestedReviewer"`
+					} `json:"nodes"`
+				} `json:"reviewRequests"`
+			} `json:"pullRequest"`
+			Labels struct {
+				Nodes    []label `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"labels"`
+		} `json:"repository"`
+	}
+	client := g.httpClient(ctx)
+	labelIDs := make(map[string]string)
+	variables := map[string]interface{}{"owner": owner, "repo": repo, "number": num, "after": nil}
+	for {
+		if err := githubGraphQL(client, query, variables, &result); err != nil {
+			return nil, fmt.Errorf("Failed to get pull request: %s", err)
+		}
+		if result.Repository.PullRequest == nil {
+			return nil, fmt.Errorf("Failed to get pull request: pull request %d not found", num)
+		}
+		for _, l := range result.Repository.Labels.Nodes {
+			labelIDs[strings.ToLower(l.Name)] = l.ID
+		}
+		if !result.Repository.Labels.PageInfo.HasNextPage {
+			break
+		}
+		variables["after"] = result.Repository.Labels.PageInfo.EndCursor
+	}
+	data := result.Repository.PullRequest
+	pr := &githubPullRequest{Draft: data.IsDraft}
+	pr.NodeID = github.String(data.ID)
+	pr.Number = github.Int(num)
+	pr.User = &github.User{Login: github.String(data.Author.Login)}
+	pr.Head = &github.PullRequestBranch{Ref: github.String(data.HeadRefName)}
+	pr.Base = &github.PullRequestBranch{Ref: github.String(data.BaseRefName)}
+	if data.Milestone != nil {
+		pr.Milestone = &github.Milestone{Number: github.Int(data.Milestone.Number), Title: github.String(data.Milestone.Title)}
+	}
+	for _, l := range data.Labels.Nodes {
+		pr.Labels = append(pr.Labels, &github.Label{Name: github.String(l.Name)})
+	}
+	for _, a := range data.Assignees.Nodes {
+		pr.Assignees = append(pr.Assignees, &github.User{Login: github.String(a.Login)})
+	}
+	for _, r := range data.ReviewRequests.Nodes {
+		if r.RequestedReviewer.Slug != "" {
+			pr.RequestedTeams = append(pr.RequestedTeams, &github.Team{Slug: github.String(r.RequestedReviewer.Slug)})
+		} else if r.RequestedReviewer.Login != "" {
+			pr.RequestedReviewers = append(pr.RequestedReviewers, &github.User{Login: github.String(r.RequestedReviewer.Login)})
+		}
+	}
+	return &graphqlPullRequest{githubPullRequest: pr, labelIDs: labelIDs}, nil
+}
+
+// nodeIDs returns the node IDs of the users and of the teams of the organization in one request
+func (g *GitHubManager) nodeIDs(ctx context.Context, org string, users, teams []string) ([]string, []string, error) {
+	if len(users) == 0 && len(teams) == 0 {
+		return nil, nil, nil
+	}
+	declarations := make([]string, 0, len(users)+len(teams)+1)
+	fields := make([]string, 0, len(users)+len(teams))
+	variables := make(map[string]interface{})
+	// GraphQL rejects declared but unused variables
+	if len(teams) != 0 {
+		declarations = append(declarations, "$org: String!")
+		variables["org"] = org
+	}
+	for i, u := range users {
+		declarations = append(declarations, fmt.Sprintf("$u%d: String!", i))
+		fields = append(fields, fmt.Sprintf("u%d: user(login: $u%d) { id }", i, i))
+		variables[fmt.Sprintf("u%d", i)] = u
+	}
+	for i, t := range teams {
+		declarations = append(declarations, fmt.Sprintf("$t%d: String!", i))
+		fields = append(fields, fmt.Sprintf("t%d: organization(login: $org) { team(slug: $t%d) { id } }", i, i))
+		variables[fmt.Sprintf("t%d", i)] = t
+	}
+	query := fmt.Sprintf("query(%s) {\n  %s\n}", strings.Join(declarations, ", "), strings.Join(fields, "\n  "))
+	var result map[string]*struct {
+		ID   string `json:"id"`
+		Team *struct {
+			ID string `json:"id"`
+		} `json:"team"`
+	}
+	if err := githubGraphQL(g.httpClient(ctx), query, variables, &result); err != nil {
+		return nil, nil, fmt.Errorf("Failed to look up users and teams: %s", err)
+	}
+	userIDs := make([]string, 0, len(users))
+	for i, u := range users {
+		if n := result[fmt.Sprintf("u%d", i)]; n != nil && n.ID != "" {
+			userIDs = append(userIDs, n.ID)
+			continue
+		}
+		return nil, nil, fmt.Errorf("Failed to look up users and teams: user '%s' not found", u)
+	}
+	teamIDs := make([]string, 0, len(teams))
+	for i, t := range teams {
+		if n := result[fmt.Sprintf("t%d", i)]; n != nil && n.Team != nil {
+			teamIDs = append(teamIDs, n.Team.ID)
+			continue
+		}
+		return nil, nil, fmt.Errorf("Failed to look up users and teams: team '@%s/%s' not found", org, t)
+	}
+	return userIDs, teamIDs, nil
+}
+
+// updatePullRequestGraphQL adds the missing labels, the assignees and the review requests of the pull request
+// in one mutation, the labels missing from the repository are created first
+func (g *GitHubManager) updatePullRequestGraphQL(ctx context.Context, client *github.Client, owner, repo string, pr *graphqlPullRequest, c *Config, labels, assignees, reviewers, teams []string) error {
+	present := make(map[string]bool)
+	for _, l := range pr.Labels {
+		present[strings.ToLower(l.GetName())] = true
+	}
+	labelIDs := make([]string, 0, len(labels))
+	added := make([]string, 0, len(labels))
+	for _, name := range labels {
+		if present[strings.ToLower(name)] {
+			continue
+		}
+		added = append(added, name)
+		id, found := pr.labelIDs[strings.ToLower(name)]
+		if !found {
+			label, err := g.createLabel(ctx, client, owner, repo, c, name)
+			if err != nil {
+				return err
+			}
+			id = label.GetNodeID()
+		}
+		labelIDs = append(labelIDs, id)
+	}
+	// assignees and reviewers are looked up together
+	userIDs, teamIDs, err := g.nodeIDs(ctx, owner, append(append([]string{}, assignees...), reviewers...), teams)
+	if err != nil {
+		return err
+	}
+	assigneeIDs, reviewerIDs := userIDs[:len(assignees)], userIDs[len(assignees):]
+	declarations := []string{"$pr: ID!"}
+	fields := make([]string, 0, 3)
+	variables := map[string]interface{}{"pr": pr.GetNodeID()}
+	if len(labelIDs) != 0 {
+		declarations = append(declarations, "$labels: [ID!]!")
+		fields = append(fields, "labels: addLabelsToLabelable(input: {labelableId: $pr, labelIds: $labels}) { clientMutationId }")
+		variables["labels"] = labelIDs
+	}
+	if len(assigneeIDs) != 0 {
+		declarations = append(declarations, "$assignees: [ID!]!")
+		fields = append(fields, "assignees: addAssigneesToAssignable(input: {assignableId: $pr, assigneeIds: $assignees}) { clientMutationId }")
+		variables["assignees"] = assigneeIDs
+	}
+	if len(reviewerIDs) != 0 || len(teamIDs) != 0 {
+		declarations = append(declarations, "$users: [ID!]!", "$teams: [ID!]!")
+		fields = append(fields, "reviews: requestReviews(input: {pullRequestId: $pr, userIds: $users, teamIds: $teams, union: true}) { clientMutationId }")
+		variables["users"] = reviewerIDs
+		variables["teams"] = teamIDs
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	mutation := fmt.Sprintf("mutation(%s) {\n  %s\n}", strings.Join(declarations, ", "), strings.Join(fields, "\n  "))
+	var result map[string]interface{}
+	if err := githubGraphQL(g.httpClient(ctx), mutation, variables, &result); err != nil {
+		return fmt.Errorf("Failed to update pull request: %s", err)
+	}
+	target := githubTarget(owner, repo, pr.GetNumber())
+	if len(added) != 0 {
+		audit(g.event, "add-labels", target, added...)
+	}
+	if len(assignees) != 0 {
+		audit(g.event, "add-assignees", target, assignees...)
+	}
+	if len(reviewers) != 0 || len(teams) != 0 {
+		audit(g.event, "request-reviews", target, append(append([]string{}, reviewers...), teams...)...)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Assignments older than historyRetention are dropped from the history
+const historyRetention time.Duration = 90 * 24 * time.Hour
+
+// Assignments of the last historyLoadWindow break the ties of the least-loaded strategy
+const historyLoadWindow time.Duration = 30 * 24 * time.Hour
+
+// assignmentRecord is the assignment of a chief to a pull request or issue
+type assignmentRecord struct {
+	Repository string    `json:"repository"`
+	URL        string    `json:"url"`
+	Chief      string    `json:"chief"`
+	Time       time.Time `json:"time"`
+}
+
+// assignmentHistory is the persistent record of the assignments made by chiefr,
+// the rotations and the loads of the chiefs are derived from it across restarts
+type assignmentHistory struct {
+	Assignments []*assignmentRecord `json:"assignments"`
+}
+
+// historyMu serializes the updates of the assignment history file in this process,
+// the file is locked against the other processes too
+var historyMu sync.Mutex
+
+// assignmentHistoryPath returns the path of the assignment history file next to the rotation state file
+func assignmentHistoryPath(rotationState string) string {
+	return filepath.Join(filepath.Dir(rotationState), "assignments.json")
+}
+
+// loadAssignmentHistory reads the assignment history file, a missing file is an empty history
+func loadAssignmentHistory(path string) (*assignmentHistory, error) {
+	h := &assignmentHistory{}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read assignment history: %s", err)
+	}
+	if err := json.Unmarshal(content, h); err != nil {
+		return nil, fmt.Errorf("Failed to parse assignment history '%s': %s", path, err)
+	}
+	return h, nil
+}
+
+// save writes the history atomically, see writeFileAtomic
+func (h *assignmentHistory) save(path string) error {
+	content, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to save assignment history: %s", err)
+	}
+	if err := writeFileAtomic(path, content); err != nil {
+		return fmt.Errorf("Failed to save assignment history: %s", err)
+	}
+	return nil
+}
+
+// record adds the assignments of the chiefs to the pull request or issue, repeated assignments
+// of the same chief to the same URL are recorded once and the expired assignments are dropped
+func (h *assignmentHistory) record(repoURL, u string, chiefs []string, now time.Time) {
+	kept := make([]*assignmentRecord, 0, len(h.Assignments)+len(chiefs))
+	for _, a := range h.Assignments {
+		if now.Sub(a.Time) < historyRetention {
+			kept = append(kept, a)
+		}
+	}
+	for _, chief := range chiefs {
+		recorded := false
+		for _, a := range kept {
+			if a.URL == u && strings.EqualFold(a.Chief, chief) {
+				recorded = true
+				break
+			}
+		}
+		if !recorded {
+			kept = append(kept, &assignmentRecord{Repository: repoURL, URL: u, Chief: chief, Time: now})
+		}
+	}
+	h.Assignments = kept
+}
+
+// counts returns the number of assignments of the chiefs in the repository since the time,
+// indexed by lowercase login
+func (h *assignmentHistory) counts(repoURL string, since time.Time) map[string]int {
+	counts := make(map[string]int)
+	if h == nil {
+		return counts
+	}
+	for _, a := range h.Assignments {
+		if normalizeRepositoryURL(a.Repository) == normalizeRepositoryURL(repoURL) && a.Time.After(since) {
+			counts[strings.ToLower(a.Chief)]++
+		}
+	}
+	return counts
+}
+
+// lastAssigned returns the time of the latest assignment of the chiefs in the repository,
+// indexed by lowercase login
+func (h *assignmentHistory) lastAssigned(repoURL string) map[string]time.Time {
+	last := make(map[string]time.Time)
+	if h == nil {
+		return last
+	}
+	for _, a := range h.Assignments {
+		chief := strings.ToLower(a.Chief)
+		if normalizeRepositoryURL(a.Repository) == normalizeRepositoryURL(repoURL) && a.Time.After(last[chief]) {
+			last[chief] = a.Time
+		}
+	}
+	return last
+}
+
+// assignmentHistory loads the assignment history if any of the segments uses a strategy depending on it,
+// nil is returned otherwise
+func (c *Config) assignmentHistory(segments orderedSegmentList) (*assignmentHistory, error) {
+	if c.rotationState == "" || !c.usesAssignStrategy(segments, assignStrategyRoundRobin) && !c.usesAssignStrategy(segments, assignStrategyLeastLoad) {
+		return nil, nil
+	}
+	return loadAssignmentHistory(assignmentHistoryPath(c.rotationState))
+}
+
+// recordAssignments adds the assignments of the chiefs to the assignment history file
+func (c *Config) recordAssignments(repoURL, u string, chiefs []string) error {
+	if c.rotationState == "" || len(chiefs) == 0 {
+		return nil
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	path := assignmentHistoryPath(c.rotationState)
+	lock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+	h, err := loadAssignmentHistory(path)
+	if err != nil {
+		return err
+	}
+	h.record(repoURL, u, chiefs, time.Now())
+	return h.save(path)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Package metadata parser, returns the name of the package and the "Name <email>" identities of its maintainers
+type metadataParser func(content string) (string, []string, error)
+
+var metadataParsers = map[string]metadataParser{
+	"package.json":  parsePackageJSON,
+	"Cargo.toml":    parseCargoTOML,
+	"codemeta.json": parseCodemeta,
+}
+
+// Segment candidate derived from a package metadata file
+type importedSegment struct {
+	Name     string
+	Source   string
+	Dir      string
+	Chiefs   []string
+	Priority int
+}
+
+func (i *importedSegment) String() string {
+	pattern := ".+"
+	if i.Dir != "" {
+		pattern = "^" + regexp.QuoteMeta(i.Dir+"/")
+	}
+	return fmt.Sprintf("; generated from %s\n[%s]\nChiefs = %s\nFilePatterns = %s\nPriority = %d\n",
+		i.Source,
+		i.Name,
+		strings.Join(i.Chiefs, ", "),
+		pattern,
+		i.Priority,
+	)
+}
+
+func importSegments(c *Config, repoPath string) error {
+	tree, err := getHeadTree(repoPath)
+	if err != nil {
+		return err
+	}
+	// maintainers listed with different names or emails are merged by the mailmap
+	mm := treeMailmap(tree)
+	// unnamed packages at the root of the repository are named after the repository directory
+	rootName := ""
+	if abs, err := filepath.Abs(repoPath); err == nil {
+		rootName = filepath.Base(abs)
+	}
+	segments := make([]*importedSegment, 0)
+	err = tree.Files().ForEach(func(f *object.File) error {
+		parser, found := metadataParsers[path.Base(f.Name)]
+		if !found {
+			return nil
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return fmt.Errorf("Failed to read '%s': %s", f.Name, err)
+		}
+		name, maintainers, err := parser(content)
+		if err != nil {
+			fmt.Printf("; skipping '%s': %s\n", f.Name, err)
+			return nil
+		}
+		chiefs := make([]string, 0, len(maintainers))
+		for _, m := range maintainers {
+			if n := mm.displayName(m); n != "" {
+				appendNew(&chiefs, n)
+			}
+		}
+		if len(chiefs) == 0 {
+			return nil
+		}
+		dir := path.Dir(f.Name)
+		if dir == "." {
+			dir = ""
+		}
+		if name == "" && dir != "" {
+			name = path.Base(dir)
+		}
+		if name == "" {
+			name = rootName
+		}
+		if name == "" || name == "." || name == string(filepath.Separator) || strings.ContainsAny(name, "[]\n") {
+			fmt.Printf("; skipping '%s': no valid package name\n", f.Name)
+			return nil
+		}
+		if _, found := c.Segments[name]; found {
+			return nil
+		}
+		segments = append(segments, &importedSegment{
+			Name:   name,
+			Source: f.Name,
+			Dir:    dir,
+			Chiefs: chiefs,
+			// deeper packages are more specific
+			Priority: strings.Count(dir, "/") + 1,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return errors.New("No new segments found in package metadata files")
+	}
+	for _, s := range segments {
+		fmt.Println(s.String())
+	}
+	return nil
+}
+
+// person can be a "Name <email> (url)" string or an object with name and email fields,
+// the result is a "Name <email>" identity
+func parsePerson(p interface{}) string {
+	switch v := p.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		name, _ := v["name"].(string)
+		if name == "" {
+			given, _ := v["givenName"].(string)
+			family, _ := v["familyName"].(string)
+			name = strings.TrimSpace(given + " " + family)
+		}
+		email, _ := v["email"].(string)
+		if email == "" {
+			return name
+		}
+		return strings.TrimSpace(fmt.Sprintf("%s <%s>", name, email))
+	}
+	return ""
+}
+
+func personName(p string) string {
+	if i := strings.IndexAny(p, "<("); i > 0 {
+		p = p[:i]
+	}
+	return strings.TrimSpace(p)
+}
+
+func parsePeople(people interface{}) []string {
+	names := make([]string, 0)
+	switch v := people.(type) {
+	case []interface{}:
+		for _, p := range v {
+			if n := parsePerson(p); n != "" {
+				appendNew(&names, n)
+			}
+		}
+	case nil:
+	default:
+		if n := parsePerson(v); n != "" {
+			appendNew(&names, n)
+		}
+	}
+	return names
+}
+
+func parsePackageJSON(content string) (string, []string, error) {
+	var pkg struct {
+		Name        string
+		Maintainers interface{}
+	}
+	if err := json.Unmarshal([]byte(content), &pkg); err != nil {
+		return "", nil, err
+	}
+	return pkg.Name, parsePeople(pkg.Maintainers), nil
+}
+
+func parseCodemeta(content string) (string, []string, error) {
+	var meta struct {
+		Name       string
+		Maintainer interface{}
+		Author     interface{}
+	}
+	if err := json.Unmarshal([]byte(content), &meta); err != nil {
+		return "", nil, err
+	}
+	maintainers := parsePeople(meta.Maintainer)
+	if len(maintainers) == 0 {
+		maintainers = parsePeople(meta.Author)
+	}
+	return meta.Name, maintainers, nil
+}
+
+var tomlStringRe = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+
+// parseCargoTOML reads the name and authors keys of the [package] table,
+// it understands only the subset of TOML used by these keys
+func parseCargoTOML(content string) (string, []string, error) {
+	name := ""
+	authors := make([]string, 0)
+	inPackage := false
+	inAuthors := false
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inAuthors {
+			for _, m := range tomlStringRe.FindAllStringSubmatch(line, -1) {
+				appendNew(&authors, m[1])
+			}
+			if strings.Contains(line, "]") {
+				inAuthors = false
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inPackage = line == "[package]"
+			continue
+		}
+		if !inPackage {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		switch key {
+		case "name":
+			if m := tomlStringRe.FindStringSubmatch(value); m != nil {
+				name = m[1]
+			}
+		case "authors":
+			for _, m := range tomlStringRe.FindAllStringSubmatch(value, -1) {
+				appendNew(&authors, m[1])
+			}
+			inAuthors = strings.HasPrefix(value, "[") && !strings.Contains(value, "]")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+	return name, authors, nil
+}
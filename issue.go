@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Title, body and author of an issue
+type issueContent struct {
+	Title  string
+	Body   string
+	Author string
+	// Logins of the current assignees
+	Assignees []string
+	// Title of the current milestone
+	Milestone string
+}
+
+// Characters around the file paths mentioned in issues, e.g. quotes, brackets and markdown code spans
+const issuePathDelimiters string = "`'\"()[]{}<>,;"
+
+// Line and column suffix of file paths in stack traces and compiler messages, e.g. main.go:12:3
+var issuePathLineRe = regexp.MustCompile(`(:\d+)+$`)
+
+// Extension of file names containing a letter
+var issuePathExtRe = regexp.MustCompile(`.\.[0-9]*[A-Za-z][A-Za-z0-9]*$`)
+
+// issuePaths returns the words of the text which look like file paths
+func issuePaths(text string) []string {
+	paths := make([]string, 0)
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || strings.ContainsRune(issuePathDelimiters, r)
+	}) {
+		if strings.Contains(word, "://") {
+			continue
+		}
+		word = strings.TrimRight(issuePathLineRe.ReplaceAllString(strings.TrimRight(word, ".:!?"), ""), ".")
+		word = strings.TrimPrefix(strings.TrimPrefix(word, "./"), "/")
+		// a path has a directory, an extension or a leading dot, version numbers like 1.2 aren't paths
+		if len(word) < 2 || (!strings.Contains(word, "/") && !strings.HasPrefix(word, ".") && !issuePathExtRe.MatchString(word)) {
+			continue
+		}
+		appendNew(&paths, word)
+	}
+	return paths
+}
+
+// mentionsTopic reports whether the text mentions the topic as a whole word, ignoring the case
+func mentionsTopic(text, topic string) bool {
+	re, err := regexp.Compile(`(?i)(^|\W)` + regexp.QuoteMeta(topic) + `($|\W)`)
+	return err == nil && re.MatchString(text)
+}
+
+// issueSegments returns the segments whose files are mentioned in the issue or whose topics are
+// mentioned in its title or body, ordered by priority
+func (c *Config) issueSegments(issue *issueContent) orderedSegmentList {
+	text := issue.Title + "\n" + issue.Body
+	paths := issuePaths(text)
+	segments := make(orderedSegmentList, 0)
+	for _, s := range sortedSegments(c.Segments) {
+		matched := false
+		for _, p := range paths {
+			if s.IsFileNameMatch(p) {
+				matched = true
+				break
+			}
+		}
+		for _, t := range s.Topics {
+			if matched {
+				break
+			}
+			matched = mentionsTopic(text, t)
+		}
+		if matched {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+func (g *GitHubManager) Issue(u string) (*issueContent, error) {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse issue URL: %s", err)
+	}
+	user, repo, num, err := parseGitHubIssueURL(URL, "issues")
+	if err != nil {
+		return nil, errors.New("Invalid issue URL")
+	}
+	ctx := context.Background()
+	issue, _, err := g.client(ctx).Issues.Get(ctx, user, repo, num)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get issue: %s", err)
+	}
+	content := &issueContent{
+		Title:  issue.GetTitle(),
+		Body:   issue.GetBody(),
+		Author: issue.GetUser().GetLogin(),
+	}
+	if issue.Milestone != nil {
+		content.Milestone = issue.Milestone.GetTitle()
+	}
+	for _, a := range issue.Assignees {
+		content.Assignees = append(content.Assignees, a.GetLogin())
+	}
+	return content, nil
+}
+
+func (g *GitHubManager) HandleIssue(u string, c *Config, os orderedSegmentList, issue *issueContent) error {
+	if len(os) == 0 {
+		return errors.New("No matching segments found for this issue")
+	}
+	URL, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Failed to parse issue URL: %s", err)
+	}
+	user, repo, num, err := parseGitHubIssueURL(URL, "issues")
+	if err != nil {
+		return errors.New("Invalid issue URL")
+	}
+	ctx := context.Background()
+	client := g.client(ctx)
+	labels := c.Settings.getLabels(os)
+	rotation := make(rotationState)
+	roundRobin := c.usesAssignStrategy(os, assignStrategyRoundRobin)
+	if roundRobin {
+		unlock, err := lockRotationState(c.rotationState)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		rotation, err = loadRotationState(c.rotationState)
+		if err != nil {
+			return err
+		}
+	}
+	// the rotation of the chiefs is shared by the issues and the pull requests of the repository
+	repoURL := fmt.Sprintf("https://%s/%s/%s", URL.Host, user, repo)
+	history, err := c.assignmentHistory(os)
+	if err != nil {
+		return err
+	}
+	skip := g.skipUser(c, issue.Author)
+	chiefs, err := c.selectChiefs(repoURL, os, skip, rotation, history, issue.Assignees, func(login string) (int, error) {
+		if g.DryRun || strings.HasPrefix(login, "@") {
+			return 0, nil
+		}
+		return g.openPullRequests(ctx, client, user, repo, login)
+	})
+	if err != nil {
+		return err
+	}
+	if g.DryRun {
+		fmt.Printf("Would add labels to %s: %s\n", u, strings.Join(labels, ", "))
+		if len(chiefs) != 0 {
+			fmt.Printf("Would add assignees to %s: %s\n", u, strings.Join(chiefs, ", "))
+		}
+		if milestone := segmentMilestone(os); milestone != "" {
+			fmt.Printf("Would set the milestone of %s unless it has one: %s\n", u, milestone)
+		}
+		return nil
+	}
+	// the milestone of the users is kept, a missing milestone is reported before changing the issue
+	milestoneTitle, milestone := "", 0
+	if issue.Milestone == "" {
+		milestoneTitle = segmentMilestone(os)
+	}
+	if milestoneTitle != "" {
+		milestone, err = g.findMilestone(ctx, client, user, repo, milestoneTitle)
+		if err != nil {
+			return err
+		}
+	}
+	err = g.addLabels(ctx, client, user, repo, num, c, labels)
+	if err != nil {
+		return err
+	}
+	// assignees can only be users, so the teams are resolved to their members
+	chiefs, err = g.resolveTeams(ctx, client, chiefs)
+	if err != nil {
+		return err
+	}
+	// chiefs without access to the repository are mentioned instead
+	chiefs, mentions, err := g.splitAssignable(ctx, client, user, repo, removeUsers(chiefs, skip))
+	if err != nil {
+		return err
+	}
+	if len(mentions) != 0 {
+		if err := g.mentionUsers(ctx, client, user, repo, num, u, c, os, mentions); err != nil {
+			return err
+		}
+	}
+	if len(chiefs) > c.Settings.MaxAssignees {
+		chiefs = chiefs[:c.Settings.MaxAssignees]
+	}
+	if len(chiefs) != 0 {
+		_, _, err = client.Issues.AddAssignees(ctx, user, repo, num, chiefs)
+		if err != nil {
+			return fmt.Errorf("Failed to add assignees to issue: %s", err)
+		}
+		audit(g.event, "add-assignees", githubTarget(user, repo, num), chiefs...)
+	}
+	if err := c.recordAssignments(repoURL, u, chiefs); err != nil {
+		return err
+	}
+	if roundRobin {
+		if err := rotation.save(c.rotationState); err != nil {
+			return err
+		}
+	}
+	if milestone != 0 {
+		return g.setMilestone(ctx, client, user, repo, num, milestone, milestoneTitle)
+	}
+	return nil
+}
+
+// updateIssue labels and assigns the issue according to the segments mentioned in it,
+// the event triggering the update is recorded in the audit log
+func updateIssue(c *Config, issueURL, APIKey string, dryRun bool, event string) error {
+	pm, err := getProjectManagerFromURL(issueURL)
+	if err != nil {
+		return err
+	}
+	pm.SetAPIKey(APIKey)
+	pm.SetDryRun(dryRun)
+	pm.SetEvent(event)
+	issue, err := pm.Issue(issueURL)
+	if err != nil {
+		return err
+	}
+	return pm.HandleIssue(issueURL, c, c.issueSegments(issue), issue)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIssuePaths(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"The parser crashes", []string{}},
+		{"panic in src/main.go:12:3", []string{"src/main.go"}},
+		{"edit `.gitignore` and (README.md).", []string{".gitignore", "README.md"}},
+		{"see ./docs/index.md and /etc/chiefr.ini", []string{"docs/index.md", "etc/chiefr.ini"}},
+		{"broken since version 1.2 and v0.1.0", []string{}},
+		{"https://github.com/asciimoo/chiefr/blob/master/chiefr.go", []string{}},
+		{"main.go, main.go; main.go", []string{"main.go"}},
+		{"Is chiefr.go broken?", []string{"chiefr.go"}},
+	}
+	for _, tt := range tests {
+		if got := issuePaths(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("issuePaths(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
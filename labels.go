@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Color of the created labels without a [chiefr.labels] entry
+const defaultLabelColor string = "ededed"
+
+var labelColorRe = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+
+// Color and description of a label created by chiefr
+type labelStyle struct {
+	Color       string
+	Description string
+}
+
+// parseLabelStyle parses the "COLOR [DESCRIPTION]" value of a [chiefr.labels] entry,
+// e.g. "1d76db Changes of the documentation"
+func parseLabelStyle(value string) (*labelStyle, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), " ", 2)
+	if !labelColorRe.MatchString(parts[0]) {
+		return nil, fmt.Errorf("invalid color '%s', expected a hex RGB color without '#' like ededed", parts[0])
+	}
+	style := &labelStyle{Color: strings.ToLower(parts[0])}
+	if len(parts) == 2 {
+		style.Description = strings.TrimSpace(parts[1])
+	}
+	return style, nil
+}
+
+// labelStyle returns the style of the pull request label, labels are configured without the LabelPrefix
+func (c *Config) labelStyle(label string) *labelStyle {
+	if style, found := c.Labels[strings.TrimPrefix(label, c.Settings.LabelPrefix)]; found {
+		return style
+	}
+	if style, found := c.Labels[label]; found {
+		return style
+	}
+	return &labelStyle{Color: defaultLabelColor}
+}
+
+// Size label of patches changing at most MaxLines lines, 0 means no limit
+type sizeLabel struct {
+	Name     string
+	MaxLines int
+}
+
+// parseSizeLabels parses the "LABEL=MAX_LINES" items of the SizeLabels setting in increasing order,
+// the last item can omit the limit
+func parseSizeLabels(items []string) ([]sizeLabel, error) {
+	labels := make([]sizeLabel, 0, len(items))
+	for i, item := range items {
+		parts := strings.SplitN(item, "=", 2)
+		l := sizeLabel{Name: strings.TrimSpace(parts[0])}
+		if len(parts) == 1 {
+			if i != len(items)-1 {
+				return nil, fmt.Errorf("missing line limit of size label '%s'", l.Name)
+			}
+			labels = append(labels, l)
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid line limit of size label '%s'", l.Name)
+		}
+		if i > 0 && n <= labels[i-1].MaxLines {
+			return nil, fmt.Errorf("line limits of size labels must be increasing")
+		}
+		l.MaxLines = n
+		labels = append(labels, l)
+	}
+	return labels, nil
+}
+
+// sizeLabel returns the size label of the patch changing the number of lines, empty string if no size label matches
+func (s *Settings) sizeLabel(lines int) string {
+	for _, l := range s.sizeLabels {
+		if l.MaxLines == 0 || lines <= l.MaxLines {
+			return l.Name
+		}
+	}
+	return ""
+}
+
+// removeLabels returns the labels except the removed ones, labels are compared ignoring case
+func removeLabels(labels, removed []string) []string {
+	kept := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if len(newValues(removed, []string{l})) != 0 {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// staleSizeLabels returns the size labels of the present labels which aren't wanted,
+// size labels are exclusive, so the outdated ones are removed even without --sync
+func (s *Settings) staleSizeLabels(present, wanted []string) []string {
+	sizes := make(map[string]bool)
+	for _, l := range s.sizeLabels {
+		sizes[strings.ToLower(l.Name)] = true
+	}
+	current := make(map[string]bool)
+	for _, l := range wanted {
+		current[strings.ToLower(l)] = true
+	}
+	stale := make([]string, 0)
+	for _, l := range present {
+		if sizes[strings.ToLower(l)] && !current[strings.ToLower(l)] {
+			stale = append(stale, l)
+		}
+	}
+	return stale
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSizeLabels(t *testing.T) {
+	tests := []struct {
+		items   []string
+		want    []sizeLabel
+		wantErr bool
+	}{
+		{items: []string{}, want: []sizeLabel{}},
+		{
+			items: []string{"size/S=10", "size/M = 100", "size/L"},
+			want:  []sizeLabel{{"size/S", 10}, {"size/M", 100}, {"size/L", 0}},
+		},
+		{items: []string{"size/S=10", "size/M=100"}, want: []sizeLabel{{"size/S", 10}, {"size/M", 100}}},
+		{items: []string{"any"}, want: []sizeLabel{{"any", 0}}},
+		{items: []string{"size/S", "size/L=100"}, wantErr: true},
+		{items: []string{"size/S=0"}, wantErr: true},
+		{items: []string{"size/S=-5"}, wantErr: true},
+		{items: []string{"size/S=ten"}, wantErr: true},
+		{items: []string{"size/S=100", "size/M=10"}, wantErr: true},
+		{items: []string{"size/S=10", "size/M=10"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSizeLabels(tt.items)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSizeLabels(%q): expected error", tt.items)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSizeLabels(%q): unexpected error: %s", tt.items, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSizeLabels(%q) = %v, want %v", tt.items, got, tt.want)
+		}
+	}
+}
+
+func TestSizeLabel(t *testing.T) {
+	labels, err := parseSizeLabels([]string{"size/S=10", "size/M=100", "size/L"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Settings{sizeLabels: labels}
+	tests := []struct {
+		lines int
+		want  string
+	}{
+		{1, "size/S"},
+		{10, "size/S"},
+		{11, "size/M"},
+		{100, "size/M"},
+		{5000, "size/L"},
+	}
+	for _, tt := range tests {
+		if got := s.sizeLabel(tt.lines); got != tt.want {
+			t.Errorf("sizeLabel(%d) = %q, want %q", tt.lines, got, tt.want)
+		}
+	}
+}
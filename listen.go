@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// acmeCacheDir returns the default directory of the certificates obtained through ACME
+func acmeCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "chiefr", "acme"), nil
+}
+
+// normalizeBasePath returns the base path with a leading slash and without trailing slash, "" for the root
+func normalizeBasePath(p string) string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return ""
+	}
+	return "/" + p
+}
+
+// forwardedHeaders replaces the client address of the requests with the address the reverse proxy
+// appended to the X-Forwarded-For header, the header must only be trusted if the server isn't reachable directly
+func forwardedHeaders(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the clients can send any X-Forwarded-For header, only the last address is added by the proxy
+		if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) != 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+			client := strings.TrimSpace(addresses[len(addresses)-1])
+			if net.ParseIP(client) != nil {
+				r.RemoteAddr = client
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// listen serves HTTPS with the certificate and key files or the certificates obtained through ACME
+// for the domains, plain HTTP otherwise
+func listen(srv *http.Server, opts *serverOptions) error {
+	if len(opts.acmeDomains) != 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(opts.acmeDomains...),
+			Cache:      autocert.DirCache(opts.acmeCache),
+		}
+		// the TLS-ALPN-01 challenges are answered on the HTTPS port
+		srv.TLSConfig = m.TLSConfig()
+		return srv.ListenAndServeTLS("", "")
+	}
+	if opts.tlsCert != "" {
+		return srv.ListenAndServeTLS(opts.tlsCert, opts.tlsKey)
+	}
+	return srv.ListenAndServe()
+}
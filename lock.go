@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// fileLock is an exclusive lock of a state file shared by chiefr processes, e.g. a webhook server
+// and a scheduled sweep, held on the FILE.lock file next to it
+type fileLock struct {
+	f *os.File
+}
+
+// lockFile waits for the exclusive lock of the file
+func lockFile(path string) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("Failed to lock '%s': %s", path, err)
+	}
+	l, err := acquireFileLock(path + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lock '%s': %s", path, err)
+	}
+	return l, nil
+}
+
+// writeFileAtomic writes the content to a unique temporary file renamed over the file,
+// so readers never see a partially written file and concurrent writers don't share the temporary file
+func writeFileAtomic(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// Lock files older than staleLockAge are left by crashed processes and taken over
+const staleLockAge time.Duration = 10 * time.Minute
+
+// acquireFileLock creates the lock file exclusively, the standard library has no file locking on Windows
+func acquireFileLock(path string) (*fileLock, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+		if err == nil {
+			return &fileLock{f: f}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// unlock releases the lock by removing the lock file
+func (l *fileLock) unlock() {
+	l.f.Close()
+	os.Remove(l.f.Name())
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpOptions configure the server sending the notifications of the mailing lists
+type smtpOptions struct {
+	// host:port of the SMTP server
+	server string
+	from   string
+	// PLAIN authentication is used if the username is set
+	username string
+	password string
+}
+
+// mailListAddress returns the email address of the mailing list of the segment,
+// MailList can be an address or a mailto: URL, other URLs (e.g. archives) have no address
+func mailListAddress(s *ProjectSegment) (string, bool) {
+	address := strings.TrimPrefix(s.MailList, "mailto:")
+	address = strings.SplitN(address, "?", 2)[0]
+	a, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", false
+	}
+	return a.Address, true
+}
+
+// mailListFiles returns the changed files of the segments
+func mailListFiles(info *PatchInfo, segments orderedSegmentList) []string {
+	names := make(map[string]bool)
+	for _, s := range segments {
+		names[s.Name] = true
+	}
+	files := make([]string, 0)
+	for _, f := range info.Files {
+		for _, a := range info.fileAttributions(info.Attributions, f) {
+			if names[a.Segment] {
+				files = append(files, f)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// notifyMailLists mails the mail template to the mailing lists of the matching segments,
+// the segments sharing a mailing list are notified in one mail, the notified mailing lists are
+// recorded in the state comment of the pull request, so every list is mailed once per pull request
+func notifyMailLists(pm ProjectManager, c *Config, prURL string, info *PatchInfo, segments orderedSegmentList, opts *smtpOptions, dryRun bool, event string) error {
+	state := &pullRequestState{}
+	if !dryRun {
+		var err error
+		if state, err = pm.PullRequestState(prURL); err != nil {
+			return err
+		}
+	}
+	addresses := make([]string, 0)
+	lists := make(map[string]orderedSegmentList)
+	for _, s := range segments {
+		if s.MailList == "" {
+			continue
+		}
+		address, ok := mailListAddress(s)
+		if !ok {
+			fmt.Printf("Warning! Mailing list '%s' of segment '%s' isn't an email address\n", s.MailList, s.Name)
+			continue
+		}
+		if containsUser(state.Mailed, address) {
+			continue
+		}
+		if _, found := lists[address]; !found {
+			addresses = append(addresses, address)
+		}
+		lists[address] = append(lists[address], s)
+	}
+	for _, address := range addresses {
+		names := make([]string, 0, len(lists[address]))
+		for _, s := range lists[address] {
+			names = append(names, s.Name)
+		}
+		body, err := c.renderComment(mailCommentTemplate, &commentData{
+			PullRequest: prURL,
+			Segments:    lists[address],
+			Files:       mailListFiles(info, lists[address]),
+			Additions:   info.Additions,
+			Deletions:   info.Deletions,
+		})
+		if err != nil {
+			return err
+		}
+		subject := fmt.Sprintf("[%s] %s", strings.Join(names, ", "), prURL)
+		if dryRun {
+			fmt.Printf("Would mail %s: %s\n%s", address, subject, body)
+			continue
+		}
+		if err := sendMail(opts, address, subject, body); err != nil {
+			return err
+		}
+		audit(event, "mail", prURL, address)
+		fmt.Printf("Notified %s\n", address)
+		appendNewFold(&state.Mailed, address)
+		if err := pm.SavePullRequestState(prURL, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendMail sends the plain text mail, the server upgrades the connection with STARTTLS if it supports it
+func sendMail(opts *smtpOptions, to, subject, body string) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", opts.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	var auth smtp.Auth
+	if opts.username != "" {
+		host, _, err := net.SplitHostPort(opts.server)
+		if err != nil {
+			return fmt.Errorf("Invalid SMTP server '%s': %s", opts.server, err)
+		}
+		auth = smtp.PlainAuth("", opts.username, opts.password, host)
+	}
+	from, err := mail.ParseAddress(opts.from)
+	if err != nil {
+		return fmt.Errorf("Invalid sender address '%s': %s", opts.from, err)
+	}
+	if err := smtp.SendMail(opts.server, auth, from.Address, []string{to}, msg.Bytes()); err != nil {
+		return fmt.Errorf("Failed to mail %s: %s", to, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Canonical name and email of an identity
+type identity struct {
+	name  string
+	email string
+}
+
+// Identity mapping of the .mailmap file of the repository
+type mailmap struct {
+	// canonical identities indexed by the lowercase email
+	byEmail map[string]identity
+	// canonical identities indexed by the lowercase name and email
+	byNameEmail map[string]identity
+}
+
+// Proper Name <proper@email> Commit Name <commit@email>, every part is optional except an email
+var mailmapLineRe = regexp.MustCompile(`^\s*([^<]*?)\s*<([^>]*)>\s*(?:([^<]*?)\s*<([^>]*)>)?`)
+
+// parseMailmap parses the content of a .mailmap file
+func parseMailmap(content string) *mailmap {
+	m := &mailmap{byEmail: make(map[string]identity), byNameEmail: make(map[string]identity)}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i != -1 {
+			line = line[:i]
+		}
+		parts := mailmapLineRe.FindStringSubmatch(line)
+		if parts == nil {
+			continue
+		}
+		canonical := identity{name: parts[1], email: parts[2]}
+		switch {
+		case parts[4] == "":
+			// Proper Name <commit@email>
+			m.byEmail[strings.ToLower(parts[2])] = identity{name: parts[1]}
+		case parts[3] == "":
+			m.byEmail[strings.ToLower(parts[4])] = canonical
+		default:
+			m.byNameEmail[strings.ToLower(parts[3])+"\x00"+strings.ToLower(parts[4])] = canonical
+		}
+	}
+	return m
+}
+
+// treeMailmap returns the mailmap of the .mailmap file of the tree or nil if it has no such file
+func treeMailmap(tree *object.Tree) *mailmap {
+	f, err := tree.File(".mailmap")
+	if err != nil {
+		return nil
+	}
+	content, err := f.Contents()
+	if err != nil {
+		return nil
+	}
+	return parseMailmap(content)
+}
+
+// canonical returns the canonical identity of the name and email
+func (m *mailmap) canonical(id identity) identity {
+	if m == nil {
+		return id
+	}
+	mapped, found := m.byNameEmail[strings.ToLower(id.name)+"\x00"+strings.ToLower(id.email)]
+	if !found {
+		mapped, found = m.byEmail[strings.ToLower(id.email)]
+	}
+	if !found {
+		return id
+	}
+	if mapped.name != "" {
+		id.name = mapped.name
+	}
+	if mapped.email != "" {
+		id.email = mapped.email
+		// the canonical email can have a canonical name
+		if mapped.name == "" {
+			if proper, found := m.byEmail[strings.ToLower(mapped.email)]; found && proper.name != "" {
+				id.name = proper.name
+			}
+		}
+	}
+	return id
+}
+
+var identityEmailRe = regexp.MustCompile(`<([^>]*)>`)
+
+// parseIdentity parses a "Name <email> (url)" string
+func parseIdentity(s string) identity {
+	id := identity{name: personName(s)}
+	if m := identityEmailRe.FindStringSubmatch(s); m != nil {
+		id.email = m[1]
+		if strings.HasPrefix(strings.TrimSpace(s), "<") {
+			id.name = ""
+		}
+	}
+	return id
+}
+
+// displayName returns the canonical name of the "Name <email>" identity,
+// or its email if the name is unknown
+func (m *mailmap) displayName(s string) string {
+	id := m.canonical(parseIdentity(s))
+	if id.name != "" {
+		return id.name
+	}
+	return id.email
+}
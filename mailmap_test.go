@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseMailmap(t *testing.T) {
+	tests := []struct {
+		name     string
+		mailmap  string
+		identity string
+		want     string
+	}{
+		{
+			name:     "proper name of the email",
+			mailmap:  "Proper Name <proper@example.com>\n",
+			identity: "Nick <proper@example.com>",
+			want:     "Proper Name",
+		},
+		{
+			name:     "emails are case insensitive",
+			mailmap:  "Proper Name <proper@example.com>\n",
+			identity: "Nick <Proper@Example.com>",
+			want:     "Proper Name",
+		},
+		{
+			name:     "canonical email keeps the name",
+			mailmap:  "<proper@example.com> <commit@example.com>\n",
+			identity: "Nick <commit@example.com>",
+			want:     "Nick",
+		},
+		{
+			name:     "canonical email with a proper name",
+			mailmap:  "Proper Name <proper@example.com>\n<proper@example.com> <commit@example.com>\n",
+			identity: "Nick <commit@example.com>",
+			want:     "Proper Name",
+		},
+		{
+			name:     "name and email mapping",
+			mailmap:  "Proper Name <proper@example.com> Nick <commit@example.com>\n",
+			identity: "nick <COMMIT@example.com>",
+			want:     "Proper Name",
+		},
+		{
+			name:     "name and email mapping needs the name",
+			mailmap:  "Proper Name <proper@example.com> Nick <commit@example.com>\n",
+			identity: "Other <commit@example.com>",
+			want:     "Other",
+		},
+		{
+			name:     "comments are ignored",
+			mailmap:  "# Proper Name <proper@example.com>\nProper Name <proper@example.com> # the maintainer\n",
+			identity: "<proper@example.com>",
+			want:     "Proper Name",
+		},
+		{
+			name:     "unknown identity without name",
+			mailmap:  "",
+			identity: "<someone@example.com>",
+			want:     "someone@example.com",
+		},
+	}
+	for _, tt := range tests {
+		if got := parseMailmap(tt.mailmap).displayName(tt.identity); got != tt.want {
+			t.Errorf("%s: displayName(%q) = %q, want %q", tt.name, tt.identity, got, tt.want)
+		}
+	}
+}
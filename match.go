@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// matchFile prints the segments matching the path with the patterns including or excluding the path
+func matchFile(c *Config, path string) {
+	fmt.Println(path)
+	matching := c.fileNameSegments(path)
+	// fallback segments are returned only if no segment matches the path
+	fallback := len(matching) != 0 && !matching[0].IsFileNameMatch(path)
+	found := false
+	for _, s := range sortedSegments(c.Segments) {
+		var include *pattern
+		for _, fp := range s.filePatterns {
+			if fp.MatchString(path) {
+				include = fp
+				break
+			}
+		}
+		if include == nil {
+			if fallback && s.Fallback {
+				fmt.Printf(" + %s: Fallback segment, no other segment matches\n", s.Name)
+				found = true
+			}
+			continue
+		}
+		found = true
+		if fep := s.fileNameExclude(path); fep != nil {
+			fmt.Printf(" - %s: %s '%s' excluded by %s '%s'\n", s.Name, include.key, include.source, fep.key, fep.source)
+			continue
+		}
+		if !matching.contains(s) {
+			fmt.Printf(" - %s: %s '%s' hidden by %s\n", s.Name, include.key, include.source, hiddenBy(matching))
+			continue
+		}
+		fmt.Printf(" + %s: %s '%s'\n", s.Name, include.key, include.source)
+	}
+	if !found {
+		fmt.Println(" [No segments found]")
+	}
+}
+
+// hiddenBy describes the segment hiding the other matching segments
+func hiddenBy(visible orderedSegmentList) string {
+	if s := exclusiveSegment(visible); s != nil {
+		return fmt.Sprintf("exclusive segment '%s'", s.Name)
+	}
+	return fmt.Sprintf("closer segment '%s'", visible[0].Name)
+}
+
+// exclusiveSegment returns the exclusive segment of the ordered segment list or nil
+func exclusiveSegment(segments orderedSegmentList) *ProjectSegment {
+	for _, s := range segments {
+		if s.Exclusive {
+			return s
+		}
+	}
+	return nil
+}
+
+// match prints the matching segments of the paths or of the paths read from the input line by line
+func match(c *Config, paths []string, in io.Reader) error {
+	if len(paths) != 0 {
+		for _, p := range paths {
+			matchFile(c, p)
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(in)
+	count := 0
+	for scanner.Scan() {
+		p := strings.TrimSpace(scanner.Text())
+		if p == "" {
+			continue
+		}
+		matchFile(c, p)
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Failed to read paths: %s", err)
+	}
+	if count == 0 {
+		return errors.New("No paths to match")
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+)
+
+// splitAssignable separates the users who can be assigned in the repository from the others,
+// e.g. outside reviewers without push access, whose assignment or review request would be rejected
+func (g *GitHubManager) splitAssignable(ctx context.Context, client *github.Client, owner, repo string, users []string) ([]string, []string, error) {
+	assignable := make([]string, 0, len(users))
+	outsiders := make([]string, 0)
+	for _, u := range users {
+		ok, _, err := client.Issues.IsAssignee(ctx, owner, repo, u)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to check if '%s' can be assigned: %s", u, err)
+		}
+		if ok {
+			assignable = append(assignable, u)
+		} else {
+			outsiders = append(outsiders, u)
+		}
+	}
+	return assignable, outsiders, nil
+}
+
+// mentionUsers mentions the users who can't be assigned in a new comment, because GitHub doesn't notify
+// the users mentioned by edited comments, the mentioned users are recorded in the state comment,
+// so repeated runs only comment if new users have to be mentioned
+func (g *GitHubManager) mentionUsers(ctx context.Context, client *github.Client, owner, repo string, num int, u string, c *Config, segments orderedSegmentList, users []string) error {
+	state, err := g.pullRequestState(ctx, client, owner, repo, num)
+	if err != nil {
+		return err
+	}
+	mentions := newValues(state.Mentioned, users)
+	if len(mentions) == 0 {
+		return nil
+	}
+	comment, err := c.renderComment(mentionCommentTemplate, &commentData{PullRequest: u, Segments: segments, Mentions: mentions})
+	if err != nil {
+		return err
+	}
+	body := comment + "\n" + mentionCommentMarker
+	_, _, err = client.Issues.CreateComment(ctx, owner, repo, num, &github.IssueComment{Body: &body})
+	if err != nil {
+		return fmt.Errorf("Failed to create comment: %s", err)
+	}
+	audit(g.event, "comment", githubTarget(owner, repo, num), mentionCommentMarker)
+	for _, m := range mentions {
+		appendNewFold(&state.Mentioned, m)
+	}
+	return g.saveState(ctx, client, owner, repo, num, state)
+}
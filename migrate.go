@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Migration steps of the maintainers file, the step at index i upgrades version i+1 to i+2
+var migrations = []func(e *iniEditor) error{
+	migrateV1,
+}
+
+// migrateV1 renames the segments using the section names reserved by version 2
+func migrateV1(e *iniEditor) error {
+	for _, name := range e.sectionNames() {
+		if name != settingsSection && !strings.HasPrefix(name, settingsSection+".") {
+			continue
+		}
+		// settings sections have no chiefs
+		start, end, err := e.section(name)
+		if err != nil || e.keyLine(start, end, "Chiefs") == -1 {
+			continue
+		}
+		newName := strings.Replace(name, ".", "-", -1)
+		if newName == settingsSection {
+			newName += "-segment"
+		}
+		err = e.renameSection(name, newName)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Segment '%s' renamed to '%s'\n", name, newName)
+	}
+	return nil
+}
+
+func migrate(c *Config, maintainersFileName string) error {
+	if c.Settings.Version == configVersion {
+		fmt.Printf("Maintainers file is up to date (version %d)\n", configVersion)
+		return nil
+	}
+	e, err := loadIniEditor(maintainersFileName)
+	if err != nil {
+		return err
+	}
+	for v := c.Settings.Version; v < configVersion; v++ {
+		err = migrations[v-1](e)
+		if err != nil {
+			return fmt.Errorf("Failed to migrate maintainers file from version %d: %s", v, err)
+		}
+	}
+	if _, _, err := e.section(settingsSection); err != nil {
+		e.addSection(settingsSection)
+	}
+	err = e.setKey(settingsSection, "Version", strconv.Itoa(configVersion))
+	if err != nil {
+		return err
+	}
+	err = e.save(maintainersFileName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Maintainers file migrated from version %d to %d\n", c.Settings.Version, configVersion)
+	return nil
+}
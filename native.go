@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Git executable of the system used for the repositories go-git can't handle
+// (e.g. partial clones, new index versions)
+type nativeGit struct {
+	repoPath string
+	// Additional environment variables of the commands
+	env []string
+}
+
+// nativeFallback retries the failed go-git analysis with the git executable if it is installed,
+// the original error is returned if the retry fails too
+func nativeFallback(err error, analyze func() (*PatchInfo, error)) (*PatchInfo, error) {
+	if _, lookErr := exec.LookPath("git"); lookErr != nil {
+		return nil, err
+	}
+	info, nativeErr := analyze()
+	if nativeErr != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "Warning! %s, using the git executable instead\n", strings.SplitN(err.Error(), "\n", 2)[0])
+	return info, nil
+}
+
+// run returns the output of the git command
+func (g *nativeGit) run(args ...string) ([]byte, error) {
+	gitArgs := []string{"-C", g.repoPath}
+	if gitDir != "" {
+		dir, err := filepath.Abs(gitDir)
+		if err != nil {
+			return nil, err
+		}
+		gitArgs = append(gitArgs, "--git-dir="+dir, "--work-tree=.")
+	}
+	cmd := exec.Command("git", append(gitArgs, args...)...)
+	if len(g.env) != 0 {
+		cmd.Env = append(os.Environ(), g.env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s failed: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s failed: %s", args[0], err)
+	}
+	return out, nil
+}
+
+// commit returns the hash of the commit of the revision
+func (g *nativeGit) commit(revision string) (string, error) {
+	out, err := g.run("rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve revision '%s'", revision)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// mergeBase returns the hash of the best common ancestor of the commits
+func (g *nativeGit) mergeBase(a, b string) (string, error) {
+	out, err := g.run("merge-base", a, b)
+	if err != nil {
+		return "", fmt.Errorf("%s has no common history with %s", a, b)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// detectBase returns the merge base of the head and the base branch like detectBase
+func (g *nativeGit) detectBase(head, baseBranch string) (string, error) {
+	if baseBranch != "" {
+		base, err := g.commit(baseBranch)
+		if err != nil {
+			return "", fmt.Errorf("Failed to resolve base branch: %s", err)
+		}
+		return g.mergeBase(head, base)
+	}
+	for _, b := range baseBranchCandidates() {
+		if base, err := g.commit(b); err == nil {
+			return g.mergeBase(head, base)
+		}
+	}
+	return "", errors.New("Failed to detect base branch, specify the revision or set 'BaseBranch' in the maintainers file")
+}
+
+// diff returns the file patches of the git diff command, blob hashes are complete to read the file contents
+func (g *nativeGit) diff(args ...string) ([]diff.FilePatch, error) {
+	out, err := g.run(append([]string{"diff", "--no-color", "--no-ext-diff", "--full-index", "-M"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	patches, _, err := parsePatchFile(out)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse git diff: %s", err)
+	}
+	return patches, nil
+}
+
+// log returns the hashes and the messages of the commits of the range
+func (g *nativeGit) log(revisionRange string) ([]*object.Commit, error) {
+	out, err := g.run("log", "-z", "--format=%H%n%B", revisionRange)
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]*object.Commit, 0)
+	for _, entry := range strings.Split(string(out), "\x00") {
+		parts := strings.SplitN(entry, "\n", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		commits = append(commits, &object.Commit{Hash: plumbing.NewHash(parts[0]), Message: strings.TrimSpace(parts[1])})
+	}
+	return commits, nil
+}
+
+// fileContent returns the content of the blob of the file, the working tree file is
+// read if the blob isn't stored in the repository (e.g. uncommitted changes)
+func (g *nativeGit) fileContent(f diff.File) (string, error) {
+	if out, err := g.run("cat-file", "blob", f.Hash().String()); err == nil {
+		return string(out), nil
+	}
+	content, err := ioutil.ReadFile(filepath.Join(g.repoPath, f.Path()))
+	if err != nil {
+		return "", err
+	}
+	if plumbing.ComputeHash(plumbing.BlobObject, content) != f.Hash() {
+		return "", fmt.Errorf("Failed to read blob %s of '%s'", f.Hash(), f.Path())
+	}
+	return string(content), nil
+}
+
+// analyzeNativePatch is analyzePatch using the git executable
+func analyzeNativePatch(c *Config, repoPath, revision string) (*PatchInfo, error) {
+	g := &nativeGit{repoPath: repoPath}
+	from, to, symmetric := parseRevisionRange(revision)
+	if to == "" {
+		to = "HEAD"
+	}
+	head, err := g.commit(to)
+	if err != nil {
+		return nil, err
+	}
+	var first string
+	switch {
+	case from == "":
+		first, err = g.detectBase(head, c.Settings.BaseBranch)
+	case symmetric:
+		first, err = g.commit(from)
+		if err == nil {
+			first, err = g.mergeBase(head, first)
+		}
+	default:
+		first, err = g.commit(from)
+	}
+	if err != nil {
+		return nil, err
+	}
+	patches, err := g.diff(first, head)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := g.log(first + ".." + head)
+	if err != nil {
+		return nil, err
+	}
+	return attributePatch(c, &blobReader{native: g}, patches, commits), nil
+}
+
+// analyzeNativeWorktree analyzes the staged or the uncommitted changes including
+// the untracked files using the git executable
+func analyzeNativeWorktree(c *Config, repoPath string, staged bool) (*PatchInfo, error) {
+	g := &nativeGit{repoPath: repoPath}
+	if staged {
+		patches, err := g.diff("--cached", "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		return attributePatch(c, &blobReader{native: g}, patches, nil), nil
+	}
+	patches, err := g.diff("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	out, err := g.run("ls-files", "-z", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path == "" {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(repoPath, path))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read '%s': %s", path, err)
+		}
+		patches = append(patches, newWorktreePatch(nil, &worktreeFile{
+			path:    path,
+			hash:    plumbing.ComputeHash(plumbing.BlobObject, content),
+			mode:    filemode.Regular,
+			content: string(content),
+		}))
+	}
+	return attributePatch(c, &blobReader{native: g}, patches, nil), nil
+}
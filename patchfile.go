@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// first line of the mails of `git format-patch`
+var mailHeaderRe = regexp.MustCompile(`^From ([0-9a-f]{40}) `)
+
+// blob hashes of the "index" line of `git diff --full-index`
+var fullIndexRe = regexp.MustCompile(`^([0-9a-f]{40})\.\.([0-9a-f]{40})$`)
+
+// content of submodule pointer changes
+var subprojectCommitRe = regexp.MustCompile(`^Subproject commit ([0-9a-f]{40})`)
+
+// readPatchFile returns the content of the patch file, "-" is the standard input
+func (s *changeSource) readPatchFile() ([]byte, error) {
+	if s.patch != nil {
+		return s.patch, nil
+	}
+	var content []byte
+	var err error
+	if s.patchFile == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(s.patchFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read patch file: %s", err)
+	}
+	s.patch = content
+	return content, nil
+}
+
+// File of a parsed patch without content
+type patchFileEntry struct {
+	path string
+	hash plumbing.Hash
+	mode filemode.FileMode
+}
+
+func (f *patchFileEntry) Hash() plumbing.Hash     { return f.hash }
+func (f *patchFileEntry) Mode() filemode.FileMode { return f.mode }
+func (f *patchFileEntry) Path() string            { return f.path }
+
+// File patch parsed from a unified diff
+type parsedPatch struct {
+	from   diff.File
+	to     diff.File
+	binary bool
+	chunks []diff.Chunk
+	// Line number of the next line of the new file
+	line int
+	// Abbreviated blob hashes of the "index" line
+	index string
+}
+
+func (p *parsedPatch) IsBinary() bool                { return p.binary }
+func (p *parsedPatch) Files() (diff.File, diff.File) { return p.from, p.to }
+func (p *parsedPatch) Chunks() []diff.Chunk          { return p.chunks }
+
+func (p *parsedPatch) addLine(op diff.Operation, line string) {
+	if n := len(p.chunks); n != 0 && p.chunks[n-1].Type() == op {
+		p.chunks[n-1].(*renameChunk).content += line
+		return
+	}
+	p.chunks = append(p.chunks, &renameChunk{content: line, op: op})
+}
+
+// parsePatchFile parses unified diff and `git format-patch` output,
+// the commits contain the messages of the mail formatted patches
+func parsePatchFile(content []byte) ([]diff.FilePatch, []*object.Commit, error) {
+	patches := make([]diff.FilePatch, 0)
+	commits := make([]*object.Commit, 0)
+	var current *parsedPatch
+	var commit *object.Commit
+	inMessage := false
+	var message strings.Builder
+	var oldPath, newPath string
+	oldMode, newMode := filemode.Regular, filemode.Regular
+	finish := func() {
+		if current == nil {
+			return
+		}
+		hashSource := current.index
+		if hashSource == "" {
+			hashSource = patchContent(current)
+		}
+		if oldPath != "" {
+			current.from = &patchFileEntry{path: oldPath, hash: plumbing.ComputeHash(plumbing.BlobObject, []byte("a"+hashSource)), mode: oldMode}
+		}
+		if newPath != "" {
+			current.to = &patchFileEntry{path: newPath, hash: plumbing.ComputeHash(plumbing.BlobObject, []byte("b"+hashSource)), mode: newMode}
+		}
+		// complete blob hashes of `git diff --full-index` identify the file contents in the repository
+		if m := fullIndexRe.FindStringSubmatch(current.index); m != nil {
+			if current.from != nil {
+				current.from.(*patchFileEntry).hash = plumbing.NewHash(m[1])
+			}
+			if current.to != nil {
+				current.to.(*patchFileEntry).hash = plumbing.NewHash(m[2])
+			}
+		}
+		// submodule entries point to the commits of the "Subproject commit" lines
+		for _, c := range current.chunks {
+			m := subprojectCommitRe.FindStringSubmatch(c.Content())
+			switch {
+			case m == nil:
+			case c.Type() == diff.Delete && oldMode == filemode.Submodule && current.from != nil:
+				current.from.(*patchFileEntry).hash = plumbing.NewHash(m[1])
+			case c.Type() == diff.Add && newMode == filemode.Submodule && current.to != nil:
+				current.to.(*patchFileEntry).hash = plumbing.NewHash(m[1])
+			}
+		}
+		if current.from != nil || current.to != nil {
+			patches = append(patches, current)
+		}
+		current = nil
+	}
+	start := func() {
+		finish()
+		current = &parsedPatch{line: 1}
+		oldPath, newPath = "", ""
+		oldMode, newMode = filemode.Regular, filemode.Regular
+	}
+	finishMessage := func() {
+		if commit != nil && inMessage {
+			commit.Message = strings.TrimSpace(message.String())
+			commits = append(commits, commit)
+		}
+		inMessage = false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	// remaining lines of the current hunk
+	oldLines, newLines := 0, 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case mailHeaderRe.MatchString(line):
+			finish()
+			finishMessage()
+			commit = &object.Commit{Hash: plumbing.NewHash(mailHeaderRe.FindStringSubmatch(line)[1])}
+			message.Reset()
+			continue
+		case commit != nil && !inMessage && current == nil && strings.HasPrefix(line, "Subject: "):
+			subject := strings.TrimPrefix(line, "Subject: ")
+			if strings.HasPrefix(subject, "[") {
+				if i := strings.Index(subject, "] "); i != -1 {
+					subject = subject[i+2:]
+				}
+			}
+			message.WriteString(subject + "\n")
+			inMessage = true
+			continue
+		case inMessage && (line == "---" || strings.HasPrefix(line, "diff --git ")):
+			finishMessage()
+			if line == "---" {
+				continue
+			}
+		case inMessage:
+			message.WriteString(line + "\n")
+			continue
+		}
+		if strings.HasPrefix(line, "diff --git ") {
+			start()
+			parts := strings.SplitN(strings.TrimPrefix(line, "diff --git "), " b/", 2)
+			if len(parts) == 2 {
+				oldPath, newPath = strings.TrimPrefix(parts[0], "a/"), parts[1]
+			}
+			continue
+		}
+		if oldLines > 0 || newLines > 0 {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				current.addLine(diff.Add, line[1:]+"\n")
+				current.line++
+				newLines--
+				continue
+			case strings.HasPrefix(line, "-"):
+				current.addLine(diff.Delete, line[1:]+"\n")
+				oldLines--
+				continue
+			case strings.HasPrefix(line, " ") || line == "":
+				current.addLine(diff.Equal, strings.TrimPrefix(line, " ")+"\n")
+				current.line++
+				oldLines--
+				newLines--
+				continue
+			}
+			return nil, nil, fmt.Errorf("Invalid patch line '%s'", line)
+		}
+		if strings.HasPrefix(line, `\`) {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			if current == nil || len(current.chunks) != 0 {
+				start()
+			}
+			oldPath = patchFilePath(strings.TrimPrefix(line, "--- "), "a/")
+		case strings.HasPrefix(line, "+++ ") && current != nil:
+			newPath = patchFilePath(strings.TrimPrefix(line, "+++ "), "b/")
+		case strings.HasPrefix(line, "new file mode ") && current != nil:
+			oldPath = ""
+			if strings.HasSuffix(line, "755") {
+				newMode = filemode.Executable
+			}
+			if strings.HasSuffix(line, " 160000") {
+				newMode = filemode.Submodule
+			}
+		case strings.HasPrefix(line, "deleted file mode ") && current != nil:
+			newPath = ""
+			if strings.HasSuffix(line, " 160000") {
+				oldMode = filemode.Submodule
+			}
+		case strings.HasPrefix(line, "rename from ") && current != nil:
+			oldPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to ") && current != nil:
+			newPath = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "index ") && current != nil:
+			fields := strings.Fields(line)
+			current.index = fields[1]
+			// submodule pointer change
+			if len(fields) > 2 && fields[2] == "160000" {
+				oldMode, newMode = filemode.Submodule, filemode.Submodule
+			}
+		case (strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch") && current != nil:
+			current.binary = true
+		case strings.HasPrefix(line, "@@ ") && current != nil:
+			m := hunkHeaderRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, nil, fmt.Errorf("Invalid hunk header '%s'", line)
+			}
+			oldLines, newLines = hunkLength(m[2]), hunkLength(m[4])
+			newStart, _ := strconv.Atoi(m[3])
+			// keep the line numbers of the new file by filling the gaps between hunks
+			if newStart > current.line {
+				current.addLine(diff.Equal, strings.Repeat("\n", newStart-current.line))
+				current.line = newStart
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse patch: %s", err)
+	}
+	finish()
+	finishMessage()
+	if len(patches) == 0 {
+		return nil, nil, fmt.Errorf("No file changes found in patch")
+	}
+	return patches, commits, nil
+}
+
+// hunkLength returns the line count of a hunk header range, the count is 1 if omitted
+func hunkLength(count string) int {
+	if count == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(count)
+	return n
+}
+
+// patchFilePath returns the path of a ---/+++ header line or an empty string for /dev/null
+func patchFilePath(header, prefix string) string {
+	if i := strings.IndexByte(header, '\t'); i != -1 {
+		header = header[:i]
+	}
+	if header == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(header, prefix)
+}
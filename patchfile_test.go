@@ -0,0 +1,157 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePatchFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    string
+		files    []string
+		lines    []int
+		messages []string
+		wantErr  bool
+	}{
+		{
+			name: "modified file",
+			patch: `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+-var a = 1
++var a = 2
+ func main() {}
+`,
+			files: []string{"main.go -> main.go"},
+			lines: []int{2},
+		},
+		{
+			name: "added and deleted files",
+			patch: `diff --git a/new.go b/new.go
+new file mode 100644
+index 0000000..1111111
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,2 @@
++package main
++var b = 1
+diff --git a/old.go b/old.go
+deleted file mode 100644
+index 1111111..0000000
+--- a/old.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package main
+`,
+			files: []string{" -> new.go", "old.go -> "},
+			lines: []int{2, 1},
+		},
+		{
+			name: "renamed file",
+			patch: `diff --git a/old.go b/new.go
+similarity index 100%
+rename from old.go
+rename to new.go
+`,
+			files: []string{"old.go -> new.go"},
+			// every changed file counts at least one line
+			lines: []int{1},
+		},
+		{
+			name: "plain unified diff",
+			patch: `--- a/README.md	2024-01-01
++++ b/README.md	2024-01-02
+@@ -10,2 +10,2 @@
+-old
++new
+ same
+`,
+			files: []string{"README.md -> README.md"},
+			lines: []int{2},
+		},
+		{
+			name: "format-patch mails",
+			patch: `From 0123456789abcdef0123456789abcdef01234567 Mon Sep 17 00:00:00 2001
+From: A <a@example.com>
+Subject: [PATCH 1/2] Fix the parser
+
+The parser dropped the last line.
+---
+ main.go | 2 +-
+diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1 @@
+-a
++b
+From 89abcdef0123456789abcdef0123456789abcdef Mon Sep 17 00:00:00 2001
+From: A <a@example.com>
+Subject: Update docs
+
+diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -1 +1,2 @@
+ a
++b
+`,
+			files:    []string{"main.go -> main.go", "README.md -> README.md"},
+			lines:    []int{2, 1},
+			messages: []string{"Fix the parser\n\nThe parser dropped the last line.", "Update docs"},
+		},
+		{
+			name: "invalid hunk header",
+			patch: `--- a/main.go
++++ b/main.go
+@@ -a +1 @@
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid hunk line",
+			patch: `--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ a
+*b
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		patches, commits, err := parsePatchFile([]byte(tt.patch))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+			continue
+		}
+		if got := patchPaths(patches); !reflect.DeepEqual(got, tt.files) {
+			t.Errorf("%s: files = %q, want %q", tt.name, got, tt.files)
+		}
+		lines := make([]int, 0, len(patches))
+		for _, p := range patches {
+			lines = append(lines, changedLines(p))
+		}
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("%s: changed lines = %v, want %v", tt.name, lines, tt.lines)
+		}
+		messages := make([]string, 0, len(commits))
+		for _, c := range commits {
+			messages = append(messages, c.Message)
+		}
+		if len(messages) != 0 || len(tt.messages) != 0 {
+			if !reflect.DeepEqual(messages, tt.messages) {
+				t.Errorf("%s: messages = %q, want %q", tt.name, messages, tt.messages)
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+var githubGraphQLURL string = "https://api.github.com/graphql"
+
+// githubGraphQL executes the GraphQL query and decodes its data to the result
+func githubGraphQL(client *http.Client, query string, variables map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(githubGraphQLURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GraphQL request failed: %s", resp.Status)
+	}
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("Invalid GraphQL response: %s", err)
+	}
+	if len(response.Errors) != 0 {
+		return errors.New(response.Errors[0].Message)
+	}
+	return json.Unmarshal(response.Data, result)
+}
+
+// GitHub project (v2) with the options of its Status field
+type githubProject struct {
+	ID            string
+	StatusFieldID string
+	StatusOptions map[string]string
+}
+
+// parseGitHubProjectURL returns the owner type ("organization" or "user"), the owner and the number
+// of a project URL like https://github.com/orgs/ORG/projects/1
+func parseGitHubProjectURL(u string) (string, string, int, error) {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return "", "", 0, err
+	}
+	parts := strings.Split(strings.Trim(URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[2] != "projects" || (parts[0] != "orgs" && parts[0] != "users") {
+		return "", "", 0, errors.New("invalid GitHub project URL")
+	}
+	num, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return "", "", 0, errors.New("invalid GitHub project URL")
+	}
+	if parts[0] == "orgs" {
+		return "organization", parts[1], num, nil
+	}
+	return "user", parts[1], num, nil
+}
+
+func (g *GitHubManager) project(client *http.Client, u string) (*githubProject, error) {
+	ownerType, owner, num, err := parseGitHubProjectURL(u)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`query($owner: String!, $number: Int!) {
+  owner: %s(login: $owner) {
+    projectV2(number: $number) {
+      id
+      field(name: "Status") { ... on ProjectV2SingleSelectField { id options { id name } } }
+    }
+  }
+}`, ownerType)
+	var result struct {
+		Owner struct {
+			Project *struct {
+				ID    string `json:"id"`
+				Field *struct {
+					ID      string `json:"id"`
+					Options []struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"options"`
+				} `json:"field"`
+			} `json:"projectV2"`
+		} `json:"owner"`
+	}
+	err = githubGraphQL(client, query, map[string]interface{}{"owner": owner, "number": num}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result.Owner.Project == nil {
+		return nil, errors.New("project not found")
+	}
+	p := &githubProject{ID: result.Owner.Project.ID, StatusOptions: make(map[string]string)}
+	if f := result.Owner.Project.Field; f != nil {
+		p.StatusFieldID = f.ID
+		for _, o := range f.Options {
+			p.StatusOptions[o.Name] = o.ID
+		}
+	}
+	return p, nil
+}
+
+// pullRequestProjects returns the node IDs of the projects the pull request is added to
+func (g *GitHubManager) pullRequestProjects(client *http.Client, pr *github.PullRequest) (map[string]bool, error) {
+	var result struct {
+		Node *struct {
+			ProjectItems struct {
+				Nodes []struct {
+					Project struct {
+						ID string `json:"id"`
+					} `json:"project"`
+				} `json:"nodes"`
+			} `json:"projectItems"`
+		} `json:"node"`
+	}
+	err := githubGraphQL(client, `query($pr: ID!) {
+  node(id: $pr) { ... on PullRequest { projectItems(first: 100) { nodes { project { id } } } } }
+}`, map[string]interface{}{"pr": pr.GetNodeID()}, &result)
+	if err != nil {
+		return nil, err
+	}
+	projects := make(map[string]bool)
+	if result.Node != nil {
+		for _, i := range result.Node.ProjectItems.Nodes {
+			projects[i.Project.ID] = true
+		}
+	}
+	return projects, nil
+}
+
+// addToProjects adds the pull request to the projects of the segments and sets its status,
+// the pull requests already in a project are skipped, so the status moved by people is kept
+func (g *GitHubManager) addToProjects(ctx context.Context, pr *github.PullRequest, segments orderedSegmentList) error {
+	added := make(map[string]bool)
+	client := g.httpClient(ctx)
+	var existing map[string]bool
+	for _, s := range segments {
+		if s.Project == "" || added[s.Project] {
+			continue
+		}
+		added[s.Project] = true
+		p, err := g.project(client, s.Project)
+		if err != nil {
+			return fmt.Errorf("Failed to find project '%s': %s", s.Project, err)
+		}
+		if existing == nil {
+			existing, err = g.pullRequestProjects(client, pr)
+			if err != nil {
+				return fmt.Errorf("Failed to list projects of pull request: %s", err)
+			}
+		}
+		if existing[p.ID] {
+			continue
+		}
+		option, found := p.StatusOptions[s.ProjectStatus]
+		if s.ProjectStatus != "" && !found {
+			return fmt.Errorf("Status '%s' not found in project '%s'", s.ProjectStatus, s.Project)
+		}
+		var item struct {
+			Add struct {
+				Item struct {
+					ID string `json:"id"`
+				} `json:"item"`
+			} `json:"addProjectV2ItemById"`
+		}
+		err = githubGraphQL(client, `mutation($project: ID!, $content: ID!) {
+  addProjectV2ItemById(input: {projectId: $project, contentId: $content}) { item { id } }
+}`, map[string]interface{}{"project": p.ID, "content": pr.GetNodeID()}, &item)
+		if err != nil {
+			return fmt.Errorf("Failed to add pull request to project '%s': %s", s.Project, err)
+		}
+		target := fmt.Sprintf("%s#%d", pr.GetBase().GetRepo().GetFullName(), pr.GetNumber())
+		audit(g.event, "add-to-project", target, s.Project)
+		if s.ProjectStatus == "" {
+			continue
+		}
+		var updated interface{}
+		err = githubGraphQL(client, `mutation($project: ID!, $item: ID!, $field: ID!, $option: String!) {
+  updateProjectV2ItemFieldValue(input: {projectId: $project, itemId: $item, fieldId: $field, value: {singleSelectOptionId: $option}}) { projectV2Item { id } }
+}`, map[string]interface{}{"project": p.ID, "item": item.Add.Item.ID, "field": p.StatusFieldID, "option": option}, &updated)
+		if err != nil {
+			return fmt.Errorf("Failed to set status of pull request in project '%s': %s", s.Project, err)
+		}
+		audit(g.event, "set-project-status", target, s.Project, s.ProjectStatus)
+	}
+	return nil
+}
+
+// enableAutoMerge enables the auto-merge of the pull request, GitHub merges it once the required checks pass
+func (g *GitHubManager) enableAutoMerge(client *http.Client, pr *github.PullRequest, method string) error {
+	var result interface{}
+	return githubGraphQL(client, `mutation($pr: ID!, $method: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $pr, mergeMethod: $method}) { clientMutationId }
+}`, map[string]interface{}{"pr": pr.GetNodeID(), "method": strings.ToUpper(method)}, &result)
+}
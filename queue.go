@@ -0,0 +1,149 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Delay of the first retry of a failed job, doubled on every further retry
+var jobRetryDelay time.Duration = time.Minute
+
+// webhookJob is a queued update of a pull request
+type webhookJob struct {
+	prURL string
+	// pending jobs with the same key are coalesced into one, empty if the job is never coalesced
+	key string
+	run func(c *Config, token string, opts *pullRequestOptions) error
+	// updates are idempotent and retried on failure, commands aren't
+	retriable bool
+	// number of failed attempts
+	failures int
+}
+
+// updateJob returns the update of the pull request, the trigger is recorded in the audit log
+func (s *webhookServer) updateJob(prURL, trigger string) *webhookJob {
+	return &webhookJob{prURL: prURL, key: "update " + prURL, retriable: true, run: func(c *Config, token string, opts *pullRequestOptions) error {
+		opts.event = trigger
+		return checkPullRequest(c, s.repoPath, "", &changeSource{kind: committedChanges}, prURL, token, opts)
+	}}
+}
+
+// update queues the update of the pull request, false is returned if the queue is full
+func (s *webhookServer) update(prURL, trigger string) bool {
+	return s.enqueue(s.updateJob(prURL, trigger), false)
+}
+
+// command queues the slash commands of the pull request comment, false is returned if the queue is full
+func (s *webhookServer) command(prURL, commenter, comment, trigger string) bool {
+	return s.enqueue(&webhookJob{prURL: prURL, run: func(c *Config, token string, opts *pullRequestOptions) error {
+		opts.event = trigger
+		return handleSlashCommands(c, s.repoPath, prURL, commenter, comment, token, opts)
+	}}, false)
+}
+
+// enqueue queues the job unless a job with the same key is already queued, if the queue is full
+// enqueue waits for free space or returns false
+func (s *webhookServer) enqueue(job *webhookJob, wait bool) bool {
+	if !s.addPending(job.key) {
+		return true
+	}
+	s.inFlight.Add(1)
+	if wait {
+		s.queue <- job
+		return true
+	}
+	select {
+	case s.queue <- job:
+		return true
+	default:
+		s.removePending(job.key)
+		s.inFlight.Done()
+		log.Printf("Queue is full, dropping the update of %s", job.prURL)
+		return false
+	}
+}
+
+// addPending marks the key queued, false is returned if it's already queued
+func (s *webhookServer) addPending(key string) bool {
+	if key == "" {
+		return true
+	}
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	if s.pending[key] {
+		return false
+	}
+	s.pending[key] = true
+	return true
+}
+
+func (s *webhookServer) removePending(key string) {
+	if key == "" {
+		return
+	}
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	delete(s.pending, key)
+}
+
+// work processes the queued jobs, the failed jobs are retried with exponential backoff
+func (s *webhookServer) work() {
+	for job := range s.queue {
+		// events arriving during the update queue a new job
+		s.removePending(job.key)
+		if err := s.do(job); err != nil && job.retriable && job.failures <= s.retries && !s.isDraining() {
+			s.retry(job)
+			continue
+		}
+		s.inFlight.Done()
+	}
+}
+
+// do runs the job with the config of the repository and the API token of the forge and logs the result
+func (s *webhookServer) do(job *webhookJob) error {
+	lock, _ := s.prLocks.LoadOrStore(job.prURL, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	token, err := apiToken(job.prURL, "")
+	var c *Config
+	if err == nil {
+		c, err = s.repositoryConfig(pullRequestRepository(job.prURL), token)
+	}
+	if err == nil {
+		opts := s.opts
+		err = job.run(c, token, &opts)
+	}
+	if err != nil {
+		job.failures++
+		log.Printf("Failed to update %s (attempt %d): %s", job.prURL, job.failures, err)
+		return err
+	}
+	log.Printf("Updated %s", job.prURL)
+	return nil
+}
+
+// retry queues the failed job again after the backoff delay, the job stays in flight meanwhile
+// and is dropped on shutdown or if a job with the same key is queued already
+func (s *webhookServer) retry(job *webhookJob) {
+	delay := jobRetryDelay << uint(job.failures-1)
+	log.Printf("Retrying %s in %s", job.prURL, delay)
+	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			if s.addPending(job.key) {
+				select {
+				case s.queue <- job:
+					return
+				case <-s.stop:
+					s.removePending(job.key)
+				}
+			}
+		case <-s.stop:
+			log.Printf("Dropping the retry of %s on shutdown", job.prURL)
+		}
+		s.inFlight.Done()
+	}()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Maximum number of retries of the forge API requests failing because of rate limits
+var apiMaxRetries int = 3
+
+// Delay of the first retry without a rate limit reset time, doubled by every retry
+var retryBaseDelay time.Duration = time.Second
+
+// retryTransport retries the requests rejected by the rate limit or the abuse detection of the forge,
+// it sleeps until the rate limit resets or the Retry-After delay passes, otherwise it backs off exponentially
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("Failed to retry request: request body can't be rewound")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("Failed to retry request: %s", err)
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+		resp, err := t.base.RoundTrip(r)
+		if err != nil || attempt >= t.maxRetries {
+			return resp, err
+		}
+		delay, retry := retryDelay(resp, attempt)
+		if !retry {
+			return resp, nil
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		fmt.Fprintf(os.Stderr, "Rate limited by %s, retrying in %s\n", req.URL.Host, delay)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryDelay returns the delay before retrying the response and whether it should be retried
+func retryDelay(resp *http.Response, attempt int) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	// abuse detection (secondary rate limit)
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if seconds, err := strconv.Atoi(s); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	// primary rate limit
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			delay := time.Until(time.Unix(reset, 0)) + time.Second
+			if delay < time.Second {
+				delay = time.Second
+			}
+			return delay, true
+		}
+	}
+	// forbidden requests without rate limit headers are permission errors
+	if resp.StatusCode == http.StatusForbidden {
+		return 0, false
+	}
+	return retryBaseDelay << uint(attempt), true
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		attempt int
+		delay   time.Duration
+		retry   bool
+	}{
+		{"success", http.StatusOK, nil, 0, 0, false},
+		{"not found", http.StatusNotFound, nil, 0, 0, false},
+		{"permission error", http.StatusForbidden, nil, 0, 0, false},
+		{"secondary rate limit", http.StatusForbidden, map[string]string{"Retry-After": "7"}, 0, 7 * time.Second, true},
+		{"primary rate limit reset", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": past}, 0, time.Second, true},
+		{"remaining requests", http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "10", "X-RateLimit-Reset": past}, 0, 0, false},
+		{"too many requests", http.StatusTooManyRequests, nil, 0, retryBaseDelay, true},
+		{"exponential backoff", http.StatusTooManyRequests, nil, 3, 8 * retryBaseDelay, true},
+		{"invalid retry after", http.StatusTooManyRequests, map[string]string{"Retry-After": "soon"}, 1, 2 * retryBaseDelay, true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: make(http.Header)}
+		for k, v := range tt.header {
+			resp.Header.Set(k, v)
+		}
+		delay, retry := retryDelay(resp, tt.attempt)
+		if delay != tt.delay || retry != tt.retry {
+			t.Errorf("%s: retryDelay() = %s, %v, want %s, %v", tt.name, delay, retry, tt.delay, tt.retry)
+		}
+	}
+}
+
+func TestRetryDelayRateLimitReset(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusForbidden, Header: make(http.Header)}
+	resp.Header.Set("X-RateLimit-Remaining", "0")
+	resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+	delay, retry := retryDelay(resp, 0)
+	if !retry || delay < 59*time.Second || delay > 62*time.Second {
+		t.Errorf("retryDelay() = %s, %v, want about a minute", delay, retry)
+	}
+}
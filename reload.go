@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// reloadStatus is the result of the last reload of the maintainers files
+type reloadStatus struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+	// number of segments of the maintainers file of the server
+	Segments int `json:"segments"`
+}
+
+func (s *webhookServer) currentConfig() *Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config
+}
+
+// reloadConfig loads the maintainers file of the server again and drops the cached maintainers files
+// of the repositories, the current config is kept if the new one is invalid
+func (s *webhookServer) reloadConfig() reloadStatus {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	status := reloadStatus{Time: time.Now()}
+	c, err := s.loadConfig()
+	if err != nil {
+		status.Error = err.Error()
+		log.Printf("Failed to reload the maintainers file: %s", err)
+	} else {
+		s.configMu.Lock()
+		c.rotationState = s.config.rotationState
+		s.config = c
+		s.configMu.Unlock()
+		if s.configs != nil {
+			s.configs.reset(c)
+		}
+		status.Success = true
+		status.Segments = len(c.Segments)
+		log.Printf("Reloaded the maintainers file, %d segment(s)", status.Segments)
+	}
+	s.reloadStatus = status
+	return status
+}
+
+func (s *webhookServer) loadConfig() (*Config, error) {
+	if s.reload == nil {
+		return nil, errors.New("Reloading the maintainers file isn't supported")
+	}
+	return s.reload()
+}
+
+// handleReload reloads the maintainers files on POST requests and reports the result of the last reload
+// on GET requests, the requests must be authenticated with the admin token
+func (s *webhookServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.adminToken == "" {
+		http.Error(w, "Admin endpoints are not enabled", http.StatusForbidden)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		log.Printf("Rejected admin request from %s: invalid token", r.RemoteAddr)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+	var status reloadStatus
+	if r.Method == http.MethodPost {
+		status = s.reloadConfig()
+	} else {
+		s.reloadMu.Lock()
+		status = s.reloadStatus
+		s.reloadMu.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Success {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var remoteFileClient = &http.Client{Timeout: 30 * time.Second}
+
+func isRemoteFile(name string) bool {
+	return strings.HasPrefix(name, "https://") || strings.HasPrefix(name, "http://")
+}
+
+func remoteFileCachePath(u string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "chiefr", fmt.Sprintf("%x.ini", sha1.Sum([]byte(u)))), nil
+}
+
+// loadRemoteFile downloads the file and updates its cached copy,
+// the cached copy is used in offline mode or if the download fails
+func loadRemoteFile(u string, offline bool) ([]byte, error) {
+	cachePath, err := remoteFileCachePath(u)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find cache directory: %s", err)
+	}
+	if offline {
+		content, err := ioutil.ReadFile(cachePath)
+		if err != nil {
+			return nil, fmt.Errorf("No cached copy of '%s' found", u)
+		}
+		return content, nil
+	}
+	content, err := downloadFile(u)
+	if err != nil {
+		cached, cacheErr := ioutil.ReadFile(cachePath)
+		if cacheErr != nil {
+			return nil, err
+		}
+		fmt.Printf("Warning! %s, using cached copy\n", err)
+		return cached, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		ioutil.WriteFile(cachePath, content, 0644)
+	}
+	return content, nil
+}
+
+func downloadFile(u string) ([]byte, error) {
+	resp, err := remoteFileClient.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download '%s': %s", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to download '%s': %s", u, resp.Status)
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to download '%s': %s", u, err)
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("Failed to download '%s': empty file", u)
+	}
+	return content, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	gitdiff "gopkg.in/src-d/go-git.v4/utils/diff"
+)
+
+// Minimum ratio of common lines to consider a deleted and an added file a rename
+const renameSimilarity float64 = 0.5
+
+// File patch of a renamed file
+type renamePatch struct {
+	from   diff.File
+	to     diff.File
+	chunks []diff.Chunk
+}
+
+func (r *renamePatch) IsBinary() bool                { return false }
+func (r *renamePatch) Files() (diff.File, diff.File) { return r.from, r.to }
+func (r *renamePatch) Chunks() []diff.Chunk          { return r.chunks }
+
+type renameChunk struct {
+	content string
+	op      diff.Operation
+}
+
+func (c *renameChunk) Content() string      { return c.content }
+func (c *renameChunk) Type() diff.Operation { return c.op }
+
+// diffChunks returns the line based chunks of the changes between the two contents
+func diffChunks(src, dst string) []diff.Chunk {
+	chunks := make([]diff.Chunk, 0)
+	for _, d := range gitdiff.Do(src, dst) {
+		op := diff.Equal
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			op = diff.Add
+		case diffmatchpatch.DiffDelete:
+			op = diff.Delete
+		}
+		chunks = append(chunks, &renameChunk{content: d.Text, op: op})
+	}
+	return chunks
+}
+
+// patchContent returns the full content of an added or deleted file patch
+func patchContent(p diff.FilePatch) string {
+	var buf strings.Builder
+	for _, c := range p.Chunks() {
+		buf.WriteString(c.Content())
+	}
+	return buf.String()
+}
+
+// lineSimilarity returns the ratio of common lines of the two contents
+func lineSimilarity(a, b string) float64 {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+	counts := make(map[string]int, len(aLines))
+	for _, l := range aLines {
+		counts[l]++
+	}
+	common := 0
+	for _, l := range bLines {
+		if counts[l] > 0 {
+			counts[l]--
+			common++
+		}
+	}
+	max := len(aLines)
+	if len(bLines) > max {
+		max = len(bLines)
+	}
+	return float64(common) / float64(max)
+}
+
+// detectRenames replaces the deleted and added file patch pairs of renamed files
+// with a single patch containing the changes between the old and the new file
+func detectRenames(patches []diff.FilePatch) []diff.FilePatch {
+	deleted := make([]diff.FilePatch, 0)
+	added := make([]diff.FilePatch, 0)
+	result := make([]diff.FilePatch, 0, len(patches))
+	for _, p := range patches {
+		from, to := p.Files()
+		switch {
+		case from == nil && to != nil:
+			added = append(added, p)
+		case from != nil && to == nil:
+			deleted = append(deleted, p)
+		default:
+			result = append(result, p)
+		}
+	}
+	for _, a := range added {
+		_, to := a.Files()
+		var best diff.FilePatch
+		bestIndex := -1
+		bestSimilarity := renameSimilarity
+		for i, d := range deleted {
+			if d == nil {
+				continue
+			}
+			from, _ := d.Files()
+			if from.Hash() == to.Hash() {
+				best, bestIndex = d, i
+				break
+			}
+			if a.IsBinary() || d.IsBinary() {
+				continue
+			}
+			if s := lineSimilarity(patchContent(d), patchContent(a)); s >= bestSimilarity {
+				best, bestIndex, bestSimilarity = d, i, s
+			}
+		}
+		if best == nil {
+			result = append(result, a)
+			continue
+		}
+		deleted[bestIndex] = nil
+		from, _ := best.Files()
+		rp := &renamePatch{from: from, to: to, chunks: make([]diff.Chunk, 0)}
+		if from.Hash() != to.Hash() {
+			rp.chunks = diffChunks(patchContent(best), patchContent(a))
+		}
+		result = append(result, rp)
+	}
+	for _, d := range deleted {
+		if d != nil {
+			result = append(result, d)
+		}
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+)
+
+// testFilePatch returns the patch of an added (from is empty), deleted (to is empty) or modified file
+func testFilePatch(from, to, content string) diff.FilePatch {
+	hash := plumbing.ComputeHash(plumbing.BlobObject, []byte(content))
+	p := &parsedPatch{}
+	op := diff.Equal
+	if from != "" {
+		p.from = &patchFileEntry{path: from, hash: hash}
+		op = diff.Delete
+	}
+	if to != "" {
+		p.to = &patchFileEntry{path: to, hash: hash}
+		op = diff.Add
+	}
+	if from != "" && to != "" {
+		op = diff.Equal
+	}
+	p.chunks = []diff.Chunk{&renameChunk{content: content, op: op}}
+	return p
+}
+
+// patchPaths returns the "FROM -> TO" paths of the patches
+func patchPaths(patches []diff.FilePatch) []string {
+	paths := make([]string, 0, len(patches))
+	for _, p := range patches {
+		from, to := p.Files()
+		path := ""
+		if from != nil {
+			path = from.Path()
+		}
+		path += " -> "
+		if to != nil {
+			path += to.Path()
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestDetectRenames(t *testing.T) {
+	tests := []struct {
+		name    string
+		patches []diff.FilePatch
+		want    []string
+	}{
+		{
+			name: "same content",
+			patches: []diff.FilePatch{
+				testFilePatch("old.go", "", "package main\n"),
+				testFilePatch("", "new.go", "package main\n"),
+			},
+			want: []string{"old.go -> new.go"},
+		},
+		{
+			name: "similar content",
+			patches: []diff.FilePatch{
+				testFilePatch("old.txt", "", "a\nb\nc\nd\n"),
+				testFilePatch("", "new.txt", "a\nb\nc\ne\n"),
+			},
+			want: []string{"old.txt -> new.txt"},
+		},
+		{
+			name: "different content",
+			patches: []diff.FilePatch{
+				testFilePatch("old.txt", "", "a\nb\nc\n"),
+				testFilePatch("", "new.txt", "x\ny\nz\n"),
+			},
+			want: []string{" -> new.txt", "old.txt -> "},
+		},
+		{
+			name: "modified files are kept",
+			patches: []diff.FilePatch{
+				testFilePatch("main.go", "main.go", "package main\n"),
+				testFilePatch("a.txt", "", "1\n2\n3\n"),
+				testFilePatch("", "b.txt", "1\n2\n3\n4\n"),
+			},
+			want: []string{"main.go -> main.go", "a.txt -> b.txt"},
+		},
+		{
+			name: "the most similar file is the rename",
+			patches: []diff.FilePatch{
+				testFilePatch("a.txt", "", "1\n2\n3\n4\n5\n"),
+				testFilePatch("b.txt", "", "1\n2\n3\n4\n6\n"),
+				testFilePatch("", "c.txt", "1\n2\n3\n4\n6\n7\n"),
+			},
+			want: []string{"b.txt -> c.txt", "a.txt -> "},
+		},
+	}
+	for _, tt := range tests {
+		if got := patchPaths(detectRenames(tt.patches)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: detectRenames() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
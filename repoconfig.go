@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// repositoryConfigs caches the maintainers files of the repositories handled by a multi-repository server
+type repositoryConfigs struct {
+	mu sync.Mutex
+	// config of the repositories without maintainers file, the runtime options are inherited from it
+	fallback *Config
+	// configs indexed by normalized repository URL
+	configs map[string]*Config
+}
+
+func newRepositoryConfigs(fallback *Config) *repositoryConfigs {
+	return &repositoryConfigs{fallback: fallback, configs: make(map[string]*Config)}
+}
+
+func normalizeRepositoryURL(u string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git"))
+}
+
+// get returns the config of the first existing default maintainers file of the repository's default branch,
+// the file is fetched through the forge API on the first use of the repository
+func (r *repositoryConfigs) get(pm ProjectManager, repoURL string) (*Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := normalizeRepositoryURL(repoURL)
+	if c, found := r.configs[key]; found {
+		return c, nil
+	}
+	for _, l := range maintainersFileLocations {
+		content, err := pm.RepositoryFile(repoURL, l)
+		if err != nil {
+			return nil, err
+		}
+		if content == nil {
+			continue
+		}
+		c, err := parseMaintainers(l, content, r.fallback.offline, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid maintainers file %s of %s: %s", l, repoURL, err)
+		}
+		c.matchCache = r.fallback.matchCache
+		c.nativeGit = r.fallback.nativeGit
+		c.rotationState = r.fallback.rotationState
+		log.Printf("Loaded maintainers file %s of %s", l, repoURL)
+		r.configs[key] = c
+		return c, nil
+	}
+	log.Printf("No maintainers file found in %s, using the maintainers file of the server", repoURL)
+	r.configs[key] = r.fallback
+	return r.fallback, nil
+}
+
+// reset replaces the fallback config and drops every cached config
+func (r *repositoryConfigs) reset(fallback *Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = fallback
+	r.configs = make(map[string]*Config)
+}
+
+// invalidate drops the cached config of the repository, it's fetched again on the next use
+func (r *repositoryConfigs) invalidate(repoURL string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.configs, normalizeRepositoryURL(repoURL))
+}
+
+func (g *GitHubManager) RepositoryFile(repoURL, path string) ([]byte, error) {
+	owner, repo, err := parseGitHubRepositoryURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	file, _, resp, err := g.client(ctx).Repositories.GetContents(ctx, owner, repo, path, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file '%s': %s", path, err)
+	}
+	// directories have no file content
+	if file == nil {
+		return nil, nil
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode file '%s': %s", path, err)
+	}
+	return []byte(content), nil
+}
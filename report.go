@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Name of the check run and the commit status context of the ownership reports
+const ownershipCheckName string = "chiefr/ownership"
+
+// Ownership summary of a pull request published to the forge
+type ownershipReport struct {
+	// Matching segments ordered by rank
+	Segments orderedSegmentList
+	// Changed files not belonging to any segment
+	Uncovered []string
+	// Uncovered files fail the report
+	RequireCoverage bool
+	// Number of approvals required from the chiefs or reviewers of the segments
+	RequiredApprovals map[string]int
+}
+
+func (r *ownershipReport) failed() bool {
+	return r.RequireCoverage && len(r.Uncovered) != 0
+}
+
+// conclusion returns the check run conclusion and the commit status state of the report
+func (r *ownershipReport) conclusion() string {
+	if r.failed() {
+		return "failure"
+	}
+	return "success"
+}
+
+func (r *ownershipReport) title() string {
+	return fmt.Sprintf("%d matching segments, %d uncovered files", len(r.Segments), len(r.Uncovered))
+}
+
+// markdown returns the report in markdown format
+func (r *ownershipReport) markdown() string {
+	var buf bytes.Buffer
+	if len(r.Segments) != 0 {
+		buf.WriteString("**Segments**\n\n")
+		for _, s := range r.Segments {
+			buf.WriteString(fmt.Sprintf(" - %s: %s\n", s.Name, strings.Join(s.Chiefs, ", ")))
+		}
+		buf.WriteString("\n**Required approvals**\n\n")
+		for _, s := range r.Segments {
+			buf.WriteString(fmt.Sprintf(" - %s: %d of %s\n", s.Name, r.RequiredApprovals[s.Name], strings.Join(segmentApprovers(s), ", ")))
+		}
+	}
+	if len(r.Uncovered) != 0 {
+		if buf.Len() != 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("**Files without segment**\n\n")
+		for _, f := range r.Uncovered {
+			buf.WriteString(fmt.Sprintf(" - `%s`\n", f))
+		}
+	}
+	if buf.Len() == 0 {
+		buf.WriteString("No matching segments\n")
+	}
+	return buf.String()
+}
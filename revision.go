@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// Ancestry suffix of a revision: ~N, ^N, ^{commit} or ^{}
+var revisionSuffixRe = regexp.MustCompile(`(~\d*|\^\d*|\^\{(?:commit)?\})$`)
+
+var abbreviatedHashRe = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// getCommitByRev resolves the revision like git rev-parse: full and abbreviated commit hashes,
+// branches, tags and remote-tracking branches followed by ~N and ^N ancestry suffixes
+func getCommitByRev(repo *git.Repository, revision string) (*object.Commit, error) {
+	base := revision
+	suffixes := make([]string, 0)
+	for {
+		loc := revisionSuffixRe.FindStringIndex(base)
+		if loc == nil || loc[0] == 0 {
+			break
+		}
+		suffixes = append([]string{base[loc[0]:]}, suffixes...)
+		base = base[:loc[0]]
+	}
+	commit, err := resolveRevisionBase(repo, base)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to resolve revision '%s': %s", revision, err)
+	}
+	for _, s := range suffixes {
+		if strings.HasPrefix(s, "^{") {
+			continue
+		}
+		n := 1
+		if len(s) > 1 {
+			n, _ = strconv.Atoi(s[1:])
+		}
+		if s[0] == '~' {
+			for i := 0; i < n; i++ {
+				commit, err = parentCommit(commit, 1)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to resolve revision '%s': %s", revision, err)
+				}
+			}
+			continue
+		}
+		// ^0 is the commit itself
+		if n != 0 {
+			commit, err = parentCommit(commit, n)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to resolve revision '%s': %s", revision, err)
+			}
+		}
+	}
+	return commit, nil
+}
+
+// parentCommit returns the nth parent of the commit
+func parentCommit(c *object.Commit, n int) (*object.Commit, error) {
+	if n > c.NumParents() {
+		return nil, fmt.Errorf("commit %s has no parent %d", c.Hash, n)
+	}
+	p, err := c.Parent(n - 1)
+	if err != nil {
+		return nil, fmt.Errorf("parent %d of commit %s is missing: %s", n, c.Hash, err)
+	}
+	return p, nil
+}
+
+// resolveRevisionBase resolves the revision without ancestry suffixes, refs take precedence over
+// abbreviated hashes like in git
+func resolveRevisionBase(repo *git.Repository, name string) (*object.Commit, error) {
+	if name == "" {
+		return nil, fmt.Errorf("empty revision")
+	}
+	if len(name) == 40 && abbreviatedHashRe.MatchString(name) {
+		return peelCommit(repo, plumbing.NewHash(name))
+	}
+	for _, rule := range append([]string{"%s"}, plumbing.RefRevParseRules...) {
+		ref, err := storer.ResolveReference(repo.Storer, plumbing.ReferenceName(fmt.Sprintf(rule, name)))
+		if err == nil {
+			return peelCommit(repo, ref.Hash())
+		}
+	}
+	if !abbreviatedHashRe.MatchString(name) {
+		return nil, fmt.Errorf("unknown branch, tag or commit")
+	}
+	return findCommitByPrefix(repo, strings.ToLower(name))
+}
+
+// peelCommit returns the commit of the hash of a commit or an annotated tag
+func peelCommit(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	if c, err := repo.CommitObject(hash); err == nil {
+		return c, nil
+	}
+	tag, err := repo.TagObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("commit %s not found", hash)
+	}
+	c, err := tag.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("tag %s doesn't point to a commit", tag.Name)
+	}
+	return c, nil
+}
+
+// findCommitByPrefix returns the commit with the abbreviated hash, the history of HEAD is searched first,
+// then every commit of the repository, e.g. the head of a pull request in a detached checkout
+func findCommitByPrefix(repo *git.Repository, prefix string) (*object.Commit, error) {
+	var commit *object.Commit
+	if head, err := repo.Head(); err == nil {
+		if iter, err := repo.Log(&git.LogOptions{From: head.Hash()}); err == nil {
+			iter.ForEach(func(c *object.Commit) error {
+				if strings.HasPrefix(c.Hash.String(), prefix) {
+					commit = c
+					return storer.ErrStop
+				}
+				return nil
+			})
+		}
+	}
+	if commit != nil {
+		return commit, nil
+	}
+	iter, err := repo.CommitObjects()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(c *object.Commit) error {
+		if !strings.HasPrefix(c.Hash.String(), prefix) {
+			return nil
+		}
+		if commit != nil && commit.Hash != c.Hash {
+			return fmt.Errorf("ambiguous abbreviated hash, specify more characters")
+		}
+		commit = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if commit == nil {
+		return nil, fmt.Errorf("unknown branch, tag or commit")
+	}
+	return commit, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func sameRepository(a, b string) bool {
+	normalize := func(u string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+	}
+	return normalize(a) == normalize(b)
+}
+
+// pullRequestRepository returns the repository URL part of a pull request URL
+func pullRequestRepository(prURL string) string {
+	if i := strings.Index(prURL, "/pull/"); i != -1 {
+		return prURL[:i]
+	}
+	if i := strings.Index(prURL, "/-/merge_requests/"); i != -1 {
+		return prURL[:i]
+	}
+	return prURL
+}
+
+// misdirected reports whether none of the segments belongs to the repository of the pull request,
+// HandlePullRequest closes these pull requests with --close
+func misdirected(prURL string, segments orderedSegmentList) bool {
+	for _, s := range segments {
+		if s.Repository != "" && strings.HasPrefix(prURL, s.Repository) {
+			return false
+		}
+	}
+	return true
+}
+
+// redirectTarget returns the repository where the changes affecting the
+// segments are redirected from repoURL, or an empty string if repoURL accepts them
+func redirectTarget(repoURL string, segments orderedSegmentList) string {
+	if len(segments) == 0 {
+		return ""
+	}
+	for _, s := range segments {
+		if s.Repository == "" || sameRepository(s.Repository, repoURL) {
+			return ""
+		}
+	}
+	return segments[0].Repository
+}
+
+// indexedRepository returns the key of the repository in the repository index
+func (c *Config) indexedRepository(repoURL string) (string, bool) {
+	for r := range c.Repositories {
+		if sameRepository(r, repoURL) {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// loadRepositories loads the maintainers files of the repository index
+func (c *Config) loadRepositories() (map[string]*Config, error) {
+	configs := make(map[string]*Config, len(c.Repositories))
+	for r, f := range c.Repositories {
+		rc, err := initMaintainers(f, c.offline)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load maintainers file of repository '%s': %s", r, err)
+		}
+		configs[r] = rc
+	}
+	return configs, nil
+}
+
+// followRoute follows the redirections starting from repoURL and returns
+// the visited repositories if the route leads back to an already visited one
+func followRoute(repoURL string, next func(string) (string, error)) ([]string, error) {
+	route := []string{repoURL}
+	for {
+		target, err := next(route[len(route)-1])
+		if err != nil || target == "" {
+			return nil, err
+		}
+		for _, r := range route {
+			if sameRepository(r, target) {
+				return append(route, target), nil
+			}
+		}
+		route = append(route, target)
+	}
+}
+
+// checkRoutingLoop returns error if closing the pull request of repoURL
+// would redirect the contributor to a chain of repositories leading back
+func checkRoutingLoop(c *Config, repoPath, revision string, source *changeSource, repoURL string, segments orderedSegmentList) error {
+	configs, err := c.loadRepositories()
+	if err != nil {
+		return err
+	}
+	route, err := followRoute(repoURL, func(r string) (string, error) {
+		if sameRepository(r, repoURL) {
+			return redirectTarget(r, segments), nil
+		}
+		key, found := c.indexedRepository(r)
+		if !found {
+			return "", nil
+		}
+		info, err := analyzeChanges(configs[key], repoPath, revision, source)
+		if err != nil {
+			return "", err
+		}
+		return redirectTarget(r, configs[key].rankSegments(info)), nil
+	})
+	if err != nil {
+		return err
+	}
+	if route != nil {
+		return fmt.Errorf("Routing loop detected, not closing pull request: %s", strings.Join(route, " -> "))
+	}
+	return nil
+}
+
+// findRoutingLoops returns the routing loops between the indexed
+// repositories for the files of the tree with an example file for each loop
+func findRoutingLoops(c *Config, tree *object.Tree) (map[string]string, error) {
+	configs, err := c.loadRepositories()
+	if err != nil {
+		return nil, err
+	}
+	loops := make(map[string]string)
+	err = tree.Files().ForEach(func(f *object.File) error {
+		for r := range configs {
+			route, _ := followRoute(r, func(r string) (string, error) {
+				key, found := c.indexedRepository(r)
+				if !found {
+					return "", nil
+				}
+				return redirectTarget(r, configs[key].fileNameSegments(f.Name)), nil
+			})
+			if route == nil {
+				continue
+			}
+			loop := strings.Join(normalizeLoop(route), " -> ")
+			if _, found := loops[loop]; !found {
+				loops[loop] = f.Name
+			}
+		}
+		return nil
+	})
+	return loops, err
+}
+
+// normalizeLoop cuts the leading repositories of the route which are not
+// part of the loop and rotates the loop to start with the smallest URL
+func normalizeLoop(route []string) []string {
+	last := route[len(route)-1]
+	start := 0
+	for i, r := range route {
+		if sameRepository(r, last) {
+			start = i
+			break
+		}
+	}
+	loop := route[start : len(route)-1]
+	min := 0
+	for i, r := range loop {
+		if r < loop[min] {
+			min = i
+		}
+	}
+	normalized := append([]string{}, loop[min:]...)
+	normalized = append(normalized, loop[:min]...)
+	return append(normalized, normalized[0])
+}
+
+func lint(c *Config, repoPath string) error {
+	problems := 0
+	if len(c.Repositories) != 0 {
+		tree, err := getHeadTree(repoPath)
+		if err != nil {
+			return err
+		}
+		loops, err := findRoutingLoops(c, tree)
+		if err != nil {
+			return err
+		}
+		sortedLoops := make([]string, 0, len(loops))
+		for loop := range loops {
+			sortedLoops = append(sortedLoops, loop)
+		}
+		sort.Strings(sortedLoops)
+		for _, loop := range sortedLoops {
+			fmt.Printf("Warning! Routing loop between repositories: %s (e.g. '%s')\n", loop, loops[loop])
+			problems++
+		}
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for _, s := range sortedSegments(c.ShadowSegments) {
+		if s.shadowUntil.Before(today) {
+			fmt.Printf("Warning! Shadow trial of segment '%s' ended on %s\n", s.Name, s.ShadowUntil)
+			problems++
+		}
+	}
+	if problems != 0 {
+		return fmt.Errorf("%d problem(s) found", problems)
+	}
+	fmt.Println("No problems found")
+	return nil
+}
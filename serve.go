@@ -0,0 +1,567 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Maximum size of webhook payloads
+const maxWebhookPayload int64 = 25 << 20
+
+// Actions of pull_request events updating the pull request
+var githubPullRequestActions = map[string]bool{
+	"opened":           true,
+	"reopened":         true,
+	"synchronize":      true,
+	"ready_for_review": true,
+}
+
+// Actions of merge request events updating the merge request, updates are filtered further in handleGitLab
+var gitlabMergeRequestActions = map[string]bool{
+	"open":   true,
+	"reopen": true,
+	"update": true,
+}
+
+// GitHub push event payload
+type githubPushEvent struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		HTMLURL       string `json:"html_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// GitHub issue_comment event payload
+type githubIssueCommentEvent struct {
+	Action string `json:"action"`
+	Issue  struct {
+		// set if the issue is a pull request
+		PullRequest *struct {
+			HTMLURL string `json:"html_url"`
+		} `json:"pull_request"`
+	} `json:"issue"`
+	Comment struct {
+		Body string `json:"body"`
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"comment"`
+}
+
+// webhookServer runs the update-pull-request logic on the pull request events of the forges
+type webhookServer struct {
+	// maintainers file of the server, replaced by reloads
+	configMu sync.RWMutex
+	config   *Config
+	repoPath string
+	opts     pullRequestOptions
+	secrets  webhookSecrets
+	// maintainers files of the repositories, nil if the server handles a single repository
+	configs *repositoryConfigs
+	// queued jobs processed by the workers
+	queue chan *webhookJob
+	// coalescing keys of the queued jobs, see webhookJob
+	pendingMu sync.Mutex
+	pending   map[string]bool
+	// locks of the pull requests being updated indexed by URL, so a pull request is updated by one worker at a time
+	prLocks sync.Map
+	// number of retries of the failed jobs
+	retries int
+	// queued, running and retried jobs
+	inFlight sync.WaitGroup
+	// set to 1 on shutdown, no new updates are started while draining
+	draining int32
+	// closed on shutdown to drop the scheduled retries
+	stop chan struct{}
+	// see serverOptions
+	trustProxy bool
+	basePath   string
+	adminToken string
+	reload     func() (*Config, error)
+	// result of the last reload of the maintainers files
+	reloadMu     sync.Mutex
+	reloadStatus reloadStatus
+}
+
+// webhookSecrets are the secrets authenticating the webhooks of the forges,
+// the webhooks of a forge are rejected if its secret is empty
+type webhookSecrets struct {
+	// secret of the HMAC signature of GitHub webhooks
+	github string
+	// secret token of GitLab webhooks
+	gitlab string
+}
+
+// loadSecret returns the secret of the option or the content of the secret file,
+// e.g. the webhook secrets, the token of the admin endpoints or the password of the SMTP server
+func loadSecret(secret, file string) (string, error) {
+	if secret != "" && file != "" {
+		return "", errors.New("Secrets can't be set both directly and from a file")
+	}
+	if file == "" {
+		return secret, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read secret file: %s", err)
+	}
+	if secret = strings.TrimSpace(string(content)); secret == "" {
+		return "", fmt.Errorf("Failed to read secret file: '%s' is empty", file)
+	}
+	return secret, nil
+}
+
+// validGitHubSignature reports whether the X-Hub-Signature-256 header is the HMAC-SHA256 signature of the payload
+func validGitHubSignature(secret string, payload []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	sum, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(sum, mac.Sum(nil))
+}
+
+// Options of the webhook server
+type serverOptions struct {
+	addr    string
+	secrets webhookSecrets
+	// Repository updated every sweepInterval, no sweeps if the interval is 0
+	sweepRepository string
+	sweepInterval   time.Duration
+	// Maximum time of draining the pending updates on shutdown
+	shutdownTimeout time.Duration
+	// Use the maintainers files of the repositories of the webhooks
+	multiRepository bool
+	// Number of concurrent updates
+	workers int
+	// Maximum number of queued updates, webhooks are rejected if the queue is full
+	queueSize int
+	// Number of retries of the failed updates
+	retries int
+	// Certificate and key files of HTTPS
+	tlsCert string
+	tlsKey  string
+	// Domains of the certificates obtained through ACME and their cache directory
+	acmeDomains []string
+	acmeCache   string
+	// Trust the X-Forwarded-* headers of the reverse proxy
+	trustProxy bool
+	// Path prefix of the endpoints, e.g. /chiefr
+	basePath string
+	// Bearer token of the admin endpoints, they are disabled if it's empty
+	adminToken string
+	// Loads the maintainers file of the server again, see reloadConfig
+	reload func() (*Config, error)
+}
+
+func newWebhookServer(c *Config, repoPath string, serverOpts *serverOptions, opts *pullRequestOptions) *webhookServer {
+	s := &webhookServer{
+		config:     c,
+		repoPath:   repoPath,
+		secrets:    serverOpts.secrets,
+		opts:       *opts,
+		queue:      make(chan *webhookJob, serverOpts.queueSize),
+		pending:    make(map[string]bool),
+		retries:    serverOpts.retries,
+		stop:       make(chan struct{}),
+		trustProxy: serverOpts.trustProxy,
+		basePath:   normalizeBasePath(serverOpts.basePath),
+		adminToken: serverOpts.adminToken,
+		reload:     serverOpts.reload,
+	}
+	s.reloadStatus = reloadStatus{Time: time.Now(), Success: true, Segments: len(c.Segments)}
+	s.opts.fetch = true
+	if serverOpts.multiRepository {
+		s.configs = newRepositoryConfigs(c)
+	}
+	for i := 0; i < serverOpts.workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+// repositoryConfig returns the config of the repository, the maintainers file of the repository
+// if the server handles multiple repositories
+func (s *webhookServer) repositoryConfig(repoURL, token string) (*Config, error) {
+	if s.configs == nil {
+		return s.currentConfig(), nil
+	}
+	pm, err := getProjectManagerFromURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	pm.SetAPIKey(token)
+	return s.configs.get(pm, repoURL)
+}
+
+// invalidateConfig drops the cached config of the repository if the push updated its default branch
+func (s *webhookServer) invalidateConfig(w http.ResponseWriter, repoURL, ref, defaultBranch string) {
+	if s.configs == nil || repoURL == "" || ref != "refs/heads/"+defaultBranch {
+		fmt.Fprintln(w, "Ignoring push")
+		return
+	}
+	s.configs.invalidate(repoURL)
+	log.Printf("Invalidated the maintainers file of %s", repoURL)
+	fmt.Fprintf(w, "Invalidated the maintainers file of %s\n", repoURL)
+}
+
+func (s *webhookServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/github", s.handleGitHub)
+	mux.HandleFunc("/gitlab", s.handleGitLab)
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+	mux.HandleFunc("/admin/reload", s.handleReload)
+	var h http.Handler = mux
+	if s.basePath != "" {
+		h = http.StripPrefix(s.basePath, h)
+	}
+	if s.trustProxy {
+		h = forwardedHeaders(h)
+	}
+	return h
+}
+
+// handleHealth reports that the server is alive
+func (s *webhookServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReady reports whether the server accepts webhooks, it fails while draining on shutdown
+func (s *webhookServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.isDraining() {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *webhookServer) isDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// shutdown stops accepting webhooks and waits for the pull requests being updated until the timeout
+func (s *webhookServer) shutdown(srv *http.Server, timeout time.Duration) error {
+	atomic.StoreInt32(&s.draining, 1)
+	close(s.stop)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("Failed to shut down: %s", err)
+	}
+	drained := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		log.Printf("Drained the pending updates")
+		return nil
+	case <-ctx.Done():
+		return errors.New("Failed to shut down: timed out waiting for the pending updates")
+	}
+}
+
+// webhookTrigger describes the webhook event in the audit log with the delivery ID of the forge
+func webhookTrigger(r *http.Request, event string) string {
+	for _, h := range []string{"X-GitHub-Delivery", "X-Gitlab-Event-UUID"} {
+		if id := r.Header.Get(h); id != "" {
+			return fmt.Sprintf("%s (delivery %s)", event, id)
+		}
+	}
+	return event
+}
+
+// GitHub pull_request event payload
+type githubPullRequestEvent struct {
+	Action      string `json:"action"`
+	PullRequest struct {
+		HTMLURL string `json:"html_url"`
+	} `json:"pull_request"`
+}
+
+func (s *webhookServer) handleGitHub(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, "Failed to read payload", http.StatusBadRequest)
+		return
+	}
+	if s.secrets.github == "" {
+		http.Error(w, "GitHub webhooks are not enabled", http.StatusForbidden)
+		return
+	}
+	// unsigned payloads are rejected too
+	if !validGitHubSignature(s.secrets.github, payload, r.Header.Get("X-Hub-Signature-256")) {
+		log.Printf("Rejected GitHub webhook from %s: invalid signature", r.RemoteAddr)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	switch r.Header.Get("X-GitHub-Event") {
+	case "ping":
+		fmt.Fprintln(w, "pong")
+	case "pull_request":
+		var event githubPullRequestEvent
+		if err := json.Unmarshal(payload, &event); err != nil || event.PullRequest.HTMLURL == "" {
+			http.Error(w, "Invalid pull_request event", http.StatusBadRequest)
+			return
+		}
+		if !githubPullRequestActions[event.Action] {
+			fmt.Fprintf(w, "Ignoring action '%s'\n", event.Action)
+			return
+		}
+		// forges time out the webhook deliveries after a few seconds, so the update runs in the background
+		if !s.update(event.PullRequest.HTMLURL, webhookTrigger(r, "github pull_request "+event.Action)) {
+			http.Error(w, "Queue is full", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "Updating %s\n", event.PullRequest.HTMLURL)
+	case "issue_comment":
+		var event githubIssueCommentEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			http.Error(w, "Invalid issue_comment event", http.StatusBadRequest)
+			return
+		}
+		if event.Action != "created" || event.Issue.PullRequest == nil || len(parseSlashCommands(event.Comment.Body)) == 0 {
+			fmt.Fprintln(w, "Ignoring comment")
+			return
+		}
+		trigger := webhookTrigger(r, "github issue_comment by "+event.Comment.User.Login)
+		if !s.command(event.Issue.PullRequest.HTMLURL, event.Comment.User.Login, event.Comment.Body, trigger) {
+			http.Error(w, "Queue is full", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "Running the commands of %s\n", event.Comment.User.Login)
+	case "push":
+		var event githubPushEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			http.Error(w, "Invalid push event", http.StatusBadRequest)
+			return
+		}
+		s.invalidateConfig(w, event.Repository.HTMLURL, event.Ref, event.Repository.DefaultBranch)
+	default:
+		fmt.Fprintf(w, "Ignoring event '%s'\n", r.Header.Get("X-GitHub-Event"))
+	}
+}
+
+// GitLab merge request event payload
+type gitlabMergeRequestEvent struct {
+	ObjectKind       string `json:"object_kind"`
+	ObjectAttributes struct {
+		URL    string `json:"url"`
+		Action string `json:"action"`
+		// previous head commit of updates pushing new commits
+		OldRev string `json:"oldrev"`
+	} `json:"object_attributes"`
+	Changes map[string]json.RawMessage `json:"changes"`
+}
+
+func (s *webhookServer) handleGitLab(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.secrets.gitlab == "" {
+		http.Error(w, "GitLab webhooks are not enabled", http.StatusForbidden)
+		return
+	}
+	token := r.Header.Get("X-Gitlab-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.secrets.gitlab)) != 1 {
+		log.Printf("Rejected GitLab webhook from %s: invalid token", r.RemoteAddr)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(w, "Failed to read payload", http.StatusBadRequest)
+		return
+	}
+	switch r.Header.Get("X-Gitlab-Event") {
+	case "Merge Request Hook":
+		s.handleGitLabMergeRequest(w, r, payload)
+	case "Note Hook":
+		s.handleGitLabNote(w, r, payload)
+	case "Push Hook":
+		var event gitlabPushEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			http.Error(w, "Invalid push event", http.StatusBadRequest)
+			return
+		}
+		s.invalidateConfig(w, event.Project.WebURL, event.Ref, event.Project.DefaultBranch)
+	default:
+		fmt.Fprintf(w, "Ignoring event '%s'\n", r.Header.Get("X-Gitlab-Event"))
+	}
+}
+
+func (s *webhookServer) handleGitLabMergeRequest(w http.ResponseWriter, r *http.Request, payload []byte) {
+	var event gitlabMergeRequestEvent
+	if err := json.Unmarshal(payload, &event); err != nil || event.ObjectAttributes.URL == "" {
+		http.Error(w, "Invalid merge request event", http.StatusBadRequest)
+		return
+	}
+	action := event.ObjectAttributes.Action
+	// updates are also sent on edits of the title, the labels or the assignees,
+	// only new commits and marking the merge request ready change the assignment
+	_, draftChanged := event.Changes["draft"]
+	if !gitlabMergeRequestActions[action] || action == "update" && event.ObjectAttributes.OldRev == "" && !draftChanged {
+		fmt.Fprintf(w, "Ignoring action '%s'\n", action)
+		return
+	}
+	if !s.update(event.ObjectAttributes.URL, webhookTrigger(r, "gitlab merge_request "+action)) {
+		http.Error(w, "Queue is full", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "Updating %s\n", event.ObjectAttributes.URL)
+}
+
+// GitLab push event payload
+type gitlabPushEvent struct {
+	Ref     string `json:"ref"`
+	Project struct {
+		WebURL        string `json:"web_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+// GitLab note event payload
+type gitlabNoteEvent struct {
+	User struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ObjectAttributes struct {
+		Note         string `json:"note"`
+		NoteableType string `json:"noteable_type"`
+		// URL of the note, the URL of the merge request with a #note_N fragment
+		URL string `json:"url"`
+	} `json:"object_attributes"`
+}
+
+func (s *webhookServer) handleGitLabNote(w http.ResponseWriter, r *http.Request, payload []byte) {
+	var event gitlabNoteEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		http.Error(w, "Invalid note event", http.StatusBadRequest)
+		return
+	}
+	note := event.ObjectAttributes
+	if note.NoteableType != "MergeRequest" || note.URL == "" || len(parseSlashCommands(note.Note)) == 0 {
+		fmt.Fprintln(w, "Ignoring note")
+		return
+	}
+	trigger := webhookTrigger(r, "gitlab note by "+event.User.Username)
+	if !s.command(strings.SplitN(note.URL, "#", 2)[0], event.User.Username, note.Note, trigger) {
+		http.Error(w, "Queue is full", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "Running the commands of %s\n", event.User.Username)
+}
+
+// sweepEvery updates the open pull requests of the repository at start and then periodically,
+// catching the pull requests whose webhooks were missed or whose segments changed since they were opened
+func (s *webhookServer) sweepEvery(repoURL string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.sweep(repoURL)
+		<-ticker.C
+	}
+}
+
+// sweep queues the updates of the open pull requests of the repository, waiting for free space in the queue
+func (s *webhookServer) sweep(repoURL string) {
+	pm, err := getProjectManagerFromURL(repoURL)
+	if err != nil {
+		log.Printf("Failed to sweep %s: %s", repoURL, err)
+		return
+	}
+	token, err := apiToken(repoURL, "")
+	if err != nil {
+		log.Printf("Failed to sweep %s: %s", repoURL, err)
+		return
+	}
+	pm.SetAPIKey(token)
+	prs, err := pm.OpenPullRequests(repoURL)
+	if err != nil {
+		log.Printf("Failed to sweep %s: %s", repoURL, err)
+		return
+	}
+	log.Printf("Sweeping %d open pull requests of %s", len(prs), repoURL)
+	for _, pr := range prs {
+		if s.isDraining() {
+			return
+		}
+		s.enqueue(s.updateJob(pr, "sweep"), true)
+	}
+}
+
+// serve listens for webhooks, the open pull requests of the repository are swept periodically
+// if the sweep interval isn't 0, SIGTERM and interrupts shut the server down gracefully, see shutdown,
+// SIGHUP reloads the maintainers files, see reloadConfig
+func serve(c *Config, repoPath string, serverOpts *serverOptions, opts *pullRequestOptions) error {
+	if serverOpts.secrets.github == "" && serverOpts.secrets.gitlab == "" {
+		return errors.New("No webhook secret set, set CHIEFR_GITHUB_WEBHOOK_SECRET or CHIEFR_GITLAB_WEBHOOK_TOKEN")
+	}
+	s := newWebhookServer(c, repoPath, serverOpts, opts)
+	if interval := serverOpts.sweepInterval; interval > 0 {
+		repoURL := serverOpts.sweepRepository
+		if repoURL == "" {
+			var err error
+			if repoURL, err = sweepRepository(c); err != nil {
+				return err
+			}
+		}
+		log.Printf("Sweeping %s every %s", repoURL, interval)
+		go s.sweepEvery(repoURL, interval)
+	}
+	addr := serverOpts.addr
+	srv := &http.Server{Addr: addr, Handler: s.handler()}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- listen(srv, serverOpts)
+	}()
+	log.Printf("Listening on %s%s", addr, s.basePath)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case err := <-errs:
+			return fmt.Errorf("Failed to serve webhooks: %s", err)
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				s.reloadConfig()
+				continue
+			}
+			log.Printf("Received %s, shutting down", sig)
+		}
+		return s.shutdown(srv, serverOpts.shutdownTimeout)
+	}
+}
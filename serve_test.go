@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestValidGitHubSignature(t *testing.T) {
+	payload := []byte(`{"action":"opened"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(payload)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	tests := []struct {
+		name      string
+		secret    string
+		payload   []byte
+		signature string
+		want      bool
+	}{
+		{"valid", "secret", payload, signature, true},
+		{"wrong secret", "other", payload, signature, false},
+		{"modified payload", "secret", []byte(`{"action":"closed"}`), signature, false},
+		{"missing prefix", "secret", payload, signature[len("sha256="):], false},
+		{"sha1 signature", "secret", payload, "sha1=" + signature[len("sha256="):], false},
+		{"invalid hex", "secret", payload, "sha256=zz", false},
+		{"empty", "secret", payload, "", false},
+	}
+	for _, tt := range tests {
+		if got := validGitHubSignature(tt.secret, tt.payload, tt.signature); got != tt.want {
+			t.Errorf("%s: validGitHubSignature() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
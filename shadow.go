@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const shadowDateFormat string = "2006-01-02"
+
+// reportShadowSegments logs the assignments the shadow segments would make
+// on the pull request and comments them to the shadow issue if configured
+func reportShadowSegments(pm ProjectManager, c *Config, repoPath, revision string, source *changeSource, prURL string) error {
+	// the shadow segments are matched with the settings, caches and git options of the config
+	shadow := *c
+	shadow.Segments = c.ShadowSegments
+	shadow.ShadowSegments = ProjectSegments{}
+	shadow.fingerprint = ""
+	segments, _, err := getPatchInfo(&shadow, repoPath, revision, source)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	active := make(orderedSegmentList, 0, len(segments))
+	for _, s := range sortedSegments(segments) {
+		if s.shadowUntil.Before(today) {
+			fmt.Printf("Warning! Shadow trial of segment '%s' ended on %s\n", s.Name, s.ShadowUntil)
+			continue
+		}
+		active = append(active, s)
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	report, err := c.renderComment(shadowCommentTemplate, &commentData{PullRequest: prURL, Segments: active})
+	if err != nil {
+		return err
+	}
+	fmt.Print(report)
+	if c.Settings.ShadowIssue == "" {
+		return nil
+	}
+	// one report per pull request
+	return pm.CommentIssue(c.Settings.ShadowIssue, fmt.Sprintf("<!-- chiefr:shadow %s -->", prURL), report)
+}
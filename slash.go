@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Slash commands of pull request comments, e.g. "/chiefr reassign", "/chiefr route security"
+// or "/chiefr unassign @alice"
+var slashCommandRe = regexp.MustCompile(`(?m)^[ \t]*/chiefr[ \t]+(reassign|route|unassign)\b[ \t]*(.*?)[ \t]*$`)
+
+type slashCommand struct {
+	Name string
+	// segment names of route, users of unassign
+	Args []string
+}
+
+// parseSlashCommands returns the slash commands of the comment in order,
+// the arguments are separated by commas or spaces
+func parseSlashCommands(comment string) []*slashCommand {
+	commands := make([]*slashCommand, 0)
+	for _, m := range slashCommandRe.FindAllStringSubmatch(comment, -1) {
+		args := strings.FieldsFunc(m[2], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if m[1] == "unassign" {
+			for i, a := range args {
+				args[i] = strings.TrimPrefix(a, "@")
+			}
+		}
+		commands = append(commands, &slashCommand{Name: m[1], Args: args})
+	}
+	return commands
+}
+
+func containsUser(users []string, login string) bool {
+	for _, u := range users {
+		if strings.EqualFold(u, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// isChief reports whether the user is a chief of any of the segments, the teams of the chiefs are expanded
+func isChief(pm ProjectManager, login string, segments orderedSegmentList) (bool, error) {
+	teams := make([]string, 0)
+	for _, s := range segments {
+		if containsUser(s.Chiefs, login) {
+			return true, nil
+		}
+		for _, chief := range s.Chiefs {
+			if strings.HasPrefix(chief, "@") {
+				appendNew(&teams, chief)
+			}
+		}
+	}
+	if len(teams) == 0 {
+		return false, nil
+	}
+	members, err := pm.ExpandTeams(teams)
+	if err != nil {
+		return false, err
+	}
+	return containsUser(members, login), nil
+}
+
+// handleSlashCommands applies the slash commands of the pull request comment if its author is a chief of
+// the segments matching the pull request: reassign replaces the assignees of the pull request with other chiefs,
+// route forces the segments, also on later updates, unassign removes the users from the assignees and the reviewers
+func handleSlashCommands(c *Config, repoPath, prURL, commenter, comment, APIKey string, opts *pullRequestOptions) error {
+	if len(parseSlashCommands(comment)) == 0 {
+		return nil
+	}
+	pm, err := getProjectManagerFromURL(prURL)
+	if err != nil {
+		return err
+	}
+	return handleSlashCommandsWith(pm, c, repoPath, prURL, commenter, comment, APIKey, opts)
+}
+
+// handleSlashCommandsWith applies the slash commands of the pull request comment with the manager
+func handleSlashCommandsWith(pm ProjectManager, c *Config, repoPath, prURL, commenter, comment, APIKey string, opts *pullRequestOptions) error {
+	commands := parseSlashCommands(comment)
+	if len(commands) == 0 {
+		return nil
+	}
+	pm.SetAPIKey(APIKey)
+	pm.SetDryRun(opts.dryRun)
+	pm.SetEvent(opts.event)
+	revision, err := pullRequestRevision(pm, repoPath, "", prURL, APIKey, opts)
+	if err != nil {
+		return err
+	}
+	// the chiefs are authorized by the segments of the changes only, the directives of the description
+	// and the route can be set by people who aren't chiefs of the changes
+	info, err := analyzeChanges(c, repoPath, revision, &changeSource{kind: committedChanges})
+	if err != nil {
+		return err
+	}
+	chief, err := isChief(pm, commenter, c.rankSegments(info))
+	if err != nil {
+		return err
+	}
+	if !chief {
+		return fmt.Errorf("Ignoring the commands of '%s': only the chiefs of the pull request's segments can use chiefr commands", commenter)
+	}
+	// the pull request is fetched only once
+	update := *opts
+	update.fetch = false
+	for _, cmd := range commands {
+		switch cmd.Name {
+		case "reassign":
+			assignees, err := pm.PullRequestAssignees(prURL)
+			if err != nil {
+				return err
+			}
+			if err := pm.RemoveAssignees(prURL, assignees); err != nil {
+				return err
+			}
+			o := update
+			o.excludedUsers = assignees
+			err = checkPullRequest(c, repoPath, revision, &changeSource{kind: committedChanges}, prURL, APIKey, &o)
+			if err != nil {
+				return err
+			}
+		case "route":
+			if len(cmd.Args) == 0 {
+				return errors.New("Missing segment names of /chiefr route")
+			}
+			// the route is recorded in the state comment, so later updates keep it
+			state, err := pm.PullRequestState(prURL)
+			if err != nil {
+				return err
+			}
+			state.Route = cmd.Args
+			if err := pm.SavePullRequestState(prURL, state); err != nil {
+				return err
+			}
+			o := update
+			o.directives = &routingDirectives{Include: cmd.Args}
+			err = checkPullRequest(c, repoPath, revision, &changeSource{kind: committedChanges}, prURL, APIKey, &o)
+			if err != nil {
+				return err
+			}
+		case "unassign":
+			if len(cmd.Args) == 0 {
+				return errors.New("Missing users of /chiefr unassign")
+			}
+			if err := pm.RemoveAssignees(prURL, cmd.Args); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *GitHubManager) PullRequestAssignees(u string) ([]string, error) {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return nil, errors.New("Invalid pull request URL")
+	}
+	ctx := context.Background()
+	pr, err := g.pullRequest(ctx, g.client(ctx), user, repo, prNum)
+	if err != nil {
+		return nil, err
+	}
+	assignees := make([]string, 0, len(pr.Assignees))
+	for _, a := range pr.Assignees {
+		assignees = append(assignees, a.GetLogin())
+	}
+	return assignees, nil
+}
+
+func (g *GitHubManager) RemoveAssignees(u string, users []string) error {
+	URL, err := url.Parse(u)
+	if err != nil {
+		return fmt.Errorf("Failed to parse pull request URL: %s", err)
+	}
+	user, repo, prNum, err := parseGitHubIssueURL(URL, "pull")
+	if err != nil {
+		return errors.New("Invalid pull request URL")
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	if g.DryRun {
+		fmt.Printf("Would remove assignees and reviewers from %s: %s\n", u, strings.Join(users, ", "))
+		return nil
+	}
+	ctx := context.Background()
+	client := g.client(ctx)
+	pr, err := g.pullRequest(ctx, client, user, repo, prNum)
+	if err != nil {
+		return err
+	}
+	assigned := make([]string, 0, len(users))
+	for _, a := range pr.Assignees {
+		if containsUser(users, a.GetLogin()) {
+			assigned = append(assigned, a.GetLogin())
+		}
+	}
+	if len(assigned) != 0 {
+		if _, _, err := client.Issues.RemoveAssignees(ctx, user, repo, prNum, assigned); err != nil {
+			return fmt.Errorf("Failed to remove assignees: %s", err)
+		}
+		audit(g.event, "remove-assignees", githubTarget(user, repo, prNum), assigned...)
+		fmt.Printf("Removed assignees: %s\n", strings.Join(assigned, ", "))
+	}
+	requested := make([]string, 0, len(users))
+	for _, r := range pr.RequestedReviewers {
+		if containsUser(users, r.GetLogin()) {
+			requested = append(requested, r.GetLogin())
+		}
+	}
+	if len(requested) != 0 {
+		_, err := client.PullRequests.RemoveReviewers(ctx, user, repo, prNum, github.ReviewersRequest{Reviewers: requested})
+		if err != nil {
+			return fmt.Errorf("Failed to remove review requests: %s", err)
+		}
+		audit(g.event, "remove-review-requests", githubTarget(user, repo, prNum), requested...)
+		fmt.Printf("Removed review requests: %s\n", strings.Join(requested, ", "))
+	}
+	return nil
+}
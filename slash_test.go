@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestParseSlashCommands(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    []*slashCommand
+	}{
+		{"LGTM", []*slashCommand{}},
+		{"/chiefr reassign", []*slashCommand{{Name: "reassign", Args: []string{}}}},
+		{"/chiefr route core, docs", []*slashCommand{{Name: "route", Args: []string{"core", "docs"}}}},
+		{"/chiefr unassign @alice bob", []*slashCommand{{Name: "unassign", Args: []string{"alice", "bob"}}}},
+		{
+			"Thanks!\n  /chiefr route security\n/chiefr reassign\n",
+			[]*slashCommand{{Name: "route", Args: []string{"security"}}, {Name: "reassign", Args: []string{}}},
+		},
+		{"please run /chiefr reassign", []*slashCommand{}},
+		{"/chiefr reassigned", []*slashCommand{}},
+		{"/chiefr merge", []*slashCommand{}},
+	}
+	for _, tt := range tests {
+		if got := parseSlashCommands(tt.comment); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSlashCommands(%q) = %v, want %v", tt.comment, got, tt.want)
+		}
+	}
+}
+
+// slashTestManager is a forge with a recorded state which records the removed assignees
+type slashTestManager struct {
+	ProjectManager
+	state   *pullRequestState
+	removed []string
+}
+
+func (m *slashTestManager) SetAPIKey(key string)                         {}
+func (m *slashTestManager) SetDryRun(dryRun bool)                        {}
+func (m *slashTestManager) SetEvent(event string)                        {}
+func (m *slashTestManager) ExpandTeams(users []string) ([]string, error) { return users, nil }
+
+func (m *slashTestManager) PullRequestState(u string) (*pullRequestState, error) {
+	return m.state, nil
+}
+
+func (m *slashTestManager) RemoveAssignees(u string, users []string) error {
+	m.removed = append(m.removed, users...)
+	return nil
+}
+
+func TestSlashCommandChiefs(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(path string) string {
+		if err := ioutil.WriteFile(filepath.Join(dir, path), []byte(path+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Add(path); err != nil {
+			t.Fatal(err)
+		}
+		sig := &object.Signature{Name: "alice", Email: "alice@example.com", When: time.Now()}
+		h, err := w.Commit("Add "+path, &git.CommitOptions{Author: sig})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h.String()
+	}
+	base := commit("README")
+	commit("core.go")
+	c, err := parseMaintainers("MAINTAINERS", []byte("[core]\nChiefs = alice\nFilePatterns = ^core\\.go$\n\n[docs]\nChiefs = mallory\nFilePatterns = ^docs/\n"), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Settings.BaseBranch = base
+	// the route is recorded as if the state was forged to route the changes to docs
+	forged := &pullRequestState{Route: []string{"docs"}}
+	tests := []struct {
+		name      string
+		commenter string
+		wantErr   bool
+		removed   []string
+	}{
+		{name: "chief of the changes", commenter: "alice", removed: []string{"bob"}},
+		{name: "chief of the routed segment", commenter: "mallory", wantErr: true},
+		{name: "not a chief", commenter: "bob", wantErr: true},
+	}
+	for _, tt := range tests {
+		pm := &slashTestManager{state: forged}
+		err := handleSlashCommandsWith(pm, c, dir, "https://github.com/o/r/pull/1", tt.commenter, "/chiefr unassign @bob", "", &pullRequestOptions{})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(pm.removed, tt.removed) {
+			t.Errorf("%s: removed %q, want %q", tt.name, pm.removed, tt.removed)
+		}
+	}
+}
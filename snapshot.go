@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Owners of a segment at the time of the snapshot
+type SnapshotSegment struct {
+	Chiefs    []string `json:"chiefs"`
+	Reviewers []string `json:"reviewers"`
+}
+
+// File to segment to owners mapping of a repository revision
+type Snapshot struct {
+	Created  time.Time                   `json:"created"`
+	Revision string                      `json:"revision"`
+	Segments map[string]*SnapshotSegment `json:"segments"`
+	Files    map[string][]string         `json:"files"`
+}
+
+func saveSnapshot(c *Config, repoPath, fileName string) error {
+	repo, err := openRepository(repoPath)
+	if err != nil {
+		return fmt.Errorf("Failed to open git repository: %s", err.Error())
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("Failed to get HEAD reference: %s", err.Error())
+	}
+	tree, err := getHeadTree(repoPath)
+	if err != nil {
+		return err
+	}
+	snapshot := &Snapshot{
+		Created:  time.Now().UTC(),
+		Revision: head.Hash().String(),
+		Segments: make(map[string]*SnapshotSegment, len(c.Segments)),
+		Files:    make(map[string][]string),
+	}
+	for name, s := range c.Segments {
+		snapshot.Segments[name] = &SnapshotSegment{Chiefs: s.Chiefs, Reviewers: s.Reviewers}
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		segments := make([]string, 0)
+		for _, s := range c.fileNameSegments(f.Name) {
+			segments = append(segments, s.Name)
+		}
+		sort.Strings(segments)
+		snapshot.Files[f.Name] = segments
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to list files of repository: %s", err)
+	}
+	content, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Failed to serialize snapshot: %s", err)
+	}
+	err = ioutil.WriteFile(fileName, content, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to write snapshot: %s", err)
+	}
+	fmt.Printf("Snapshot of revision %s saved to %s\n", snapshot.Revision, fileName)
+	return nil
+}
+
+func loadSnapshot(fileName string) (*Snapshot, error) {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read snapshot: %s", err)
+	}
+	snapshot := &Snapshot{}
+	err = json.Unmarshal(content, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse snapshot '%s': %s", fileName, err)
+	}
+	return snapshot, nil
+}
+
+func (s *Snapshot) owners(file string) string {
+	segments, found := s.Files[file]
+	if !found {
+		return "[No file]"
+	}
+	if len(segments) == 0 {
+		return "[No segments found]"
+	}
+	owners := make([]string, 0, len(segments))
+	for _, name := range segments {
+		chiefs := ""
+		if seg, found := s.Segments[name]; found {
+			chiefs = strings.Join(seg.Chiefs, ", ")
+		}
+		owners = append(owners, fmt.Sprintf("%s (%s)", name, chiefs))
+	}
+	return strings.Join(owners, ", ")
+}
+
+func compareSnapshots(oldFileName, newFileName string) error {
+	oldSnapshot, err := loadSnapshot(oldFileName)
+	if err != nil {
+		return err
+	}
+	newSnapshot, err := loadSnapshot(newFileName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Ownership changes between %s (%s) and %s (%s)\n\n",
+		oldSnapshot.Revision,
+		oldSnapshot.Created.Format(time.RFC3339),
+		newSnapshot.Revision,
+		newSnapshot.Created.Format(time.RFC3339),
+	)
+
+	segmentNames := make([]string, 0)
+	for name := range oldSnapshot.Segments {
+		appendNew(&segmentNames, name)
+	}
+	for name := range newSnapshot.Segments {
+		appendNew(&segmentNames, name)
+	}
+	sort.Strings(segmentNames)
+	fmt.Println("Segments:")
+	segmentChanges := 0
+	for _, name := range segmentNames {
+		o, oldFound := oldSnapshot.Segments[name]
+		n, newFound := newSnapshot.Segments[name]
+		switch {
+		case !oldFound:
+			fmt.Printf(" + %s: chiefs: %s\n", name, strings.Join(n.Chiefs, ", "))
+		case !newFound:
+			fmt.Printf(" - %s: chiefs: %s\n", name, strings.Join(o.Chiefs, ", "))
+		case strings.Join(o.Chiefs, ",") != strings.Join(n.Chiefs, ","):
+			fmt.Printf(" ~ %s: chiefs: %s -> %s\n", name, strings.Join(o.Chiefs, ", "), strings.Join(n.Chiefs, ", "))
+		case strings.Join(o.Reviewers, ",") != strings.Join(n.Reviewers, ","):
+			fmt.Printf(" ~ %s: reviewers: %s -> %s\n", name, strings.Join(o.Reviewers, ", "), strings.Join(n.Reviewers, ", "))
+		default:
+			continue
+		}
+		segmentChanges++
+	}
+	if segmentChanges == 0 {
+		fmt.Println(" No changes")
+	}
+
+	files := make([]string, 0, len(newSnapshot.Files))
+	for f := range oldSnapshot.Files {
+		files = append(files, f)
+	}
+	for f := range newSnapshot.Files {
+		if _, found := oldSnapshot.Files[f]; !found {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	fmt.Println("\nFiles:")
+	fileChanges := 0
+	for _, f := range files {
+		oldOwners := oldSnapshot.owners(f)
+		newOwners := newSnapshot.owners(f)
+		if oldOwners == newOwners {
+			continue
+		}
+		fmt.Printf(" %s: %s -> %s\n", f, oldOwners, newOwners)
+		fileChanges++
+	}
+	if fileChanges == 0 {
+		fmt.Println(" No changes")
+	}
+	return nil
+}
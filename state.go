@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// stateCommentMarker marks the comment recording what chiefr applied to a pull request
+	stateCommentMarker string = "<!-- chiefr:state -->"
+	stateDataPrefix    string = "<!-- chiefr:state-data "
+	stateDataSuffix    string = " -->"
+)
+
+// pullRequestState records the labels, assignees and review requests chiefr applied to a pull request,
+// --sync only removes what is recorded, the changes of the users are kept, and the route of the chiefs
+type pullRequestState struct {
+	Labels    []string `json:"labels,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+	Reviewers []string `json:"reviewers,omitempty"`
+	Teams     []string `json:"teams,omitempty"`
+	// segment names forced by the route slash command
+	Route []string `json:"route,omitempty"`
+	// addresses of the mailing lists notified about the pull request
+	Mailed []string `json:"mailed,omitempty"`
+	// users mentioned instead of being assigned or requested to review
+	Mentioned []string `json:"mentioned,omitempty"`
+}
+
+// parsePullRequestState reads the state from the body of the state comment, an empty body is an empty state
+func parsePullRequestState(body string) (*pullRequestState, error) {
+	state := &pullRequestState{}
+	start := strings.Index(body, stateDataPrefix)
+	if start == -1 {
+		return state, nil
+	}
+	data := body[start+len(stateDataPrefix):]
+	end := strings.Index(data, stateDataSuffix)
+	if end == -1 {
+		return nil, fmt.Errorf("Failed to parse pull request state: unterminated comment")
+	}
+	if err := json.Unmarshal([]byte(data[:end]), state); err != nil {
+		return nil, fmt.Errorf("Failed to parse pull request state: %s", err)
+	}
+	return state, nil
+}
+
+// comment renders the state comment, the marker is appended by the comment upsert
+func (s *pullRequestState) comment() (string, error) {
+	// HTML characters are escaped by the encoder, the data can't terminate the HTML comment
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode pull request state: %s", err)
+	}
+	return "chiefr keeps track of the labels, assignees and review requests it applied in this comment.\n" +
+		stateDataPrefix + string(data) + stateDataSuffix, nil
+}
+
+// syncApplied returns the recorded values which aren't wanted anymore and the new record,
+// the recorded values removed by users are forgotten and the newly applied ones are added
+func syncApplied(recorded, present, wanted, applied []string) ([]string, []string) {
+	set := func(values []string) map[string]bool {
+		m := make(map[string]bool)
+		for _, v := range values {
+			m[strings.ToLower(v)] = true
+		}
+		return m
+	}
+	presentSet, wantedSet := set(present), set(wanted)
+	stale := make([]string, 0)
+	record := make([]string, 0)
+	for _, v := range recorded {
+		if !presentSet[strings.ToLower(v)] {
+			continue
+		}
+		if wantedSet[strings.ToLower(v)] {
+			appendNewFold(&record, v)
+		} else {
+			stale = append(stale, v)
+		}
+	}
+	for _, v := range applied {
+		appendNewFold(&record, v)
+	}
+	return stale, record
+}
+
+// appendNewFold appends the value if the slice doesn't contain it ignoring case
+func appendNewFold(values *[]string, value string) {
+	for _, v := range *values {
+		if strings.EqualFold(v, value) {
+			return
+		}
+	}
+	*values = append(*values, value)
+}
+
+// newValues returns the values missing from the present ones ignoring case
+func newValues(present, values []string) []string {
+	missing := make([]string, 0)
+	for _, v := range values {
+		found := false
+		for _, p := range present {
+			if strings.EqualFold(p, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
+
+// empty reports whether nothing is recorded
+func (s *pullRequestState) empty() bool {
+	return len(s.Labels) == 0 && len(s.Assignees) == 0 && len(s.Reviewers) == 0 && len(s.Teams) == 0 && len(s.Route) == 0 && len(s.Mailed) == 0 && len(s.Mentioned) == 0
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Submodule pointer of a tree
+type submoduleEntry struct {
+	path string
+	hash plumbing.Hash
+}
+
+func (e *submoduleEntry) Hash() plumbing.Hash     { return e.hash }
+func (e *submoduleEntry) Mode() filemode.FileMode { return filemode.Submodule }
+func (e *submoduleEntry) Path() string            { return e.path }
+
+// File patch of a submodule pointer change in the format of git diff
+type submodulePatch struct {
+	from   diff.File
+	to     diff.File
+	chunks []diff.Chunk
+}
+
+func (p *submodulePatch) IsBinary() bool                { return false }
+func (p *submodulePatch) Files() (diff.File, diff.File) { return p.from, p.to }
+func (p *submodulePatch) Chunks() []diff.Chunk          { return p.chunks }
+
+// treePatches returns the file patches between the trees including the submodule pointer changes,
+// which are left out of the patches of go-git, from is nil for the patch of every file of the tree
+func treePatches(from, to *object.Tree) ([]diff.FilePatch, error) {
+	changes, err := object.DiffTree(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create patch: %s", err)
+	}
+	patch, err := changes.Patch()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create patch: %s", err)
+	}
+	// the file patches are in the order of the changes
+	patches := patch.FilePatches()
+	for i, c := range changes {
+		if c.From.TreeEntry.Mode != filemode.Submodule && c.To.TreeEntry.Mode != filemode.Submodule {
+			continue
+		}
+		sp := &submodulePatch{chunks: make([]diff.Chunk, 0, 2)}
+		if c.From.TreeEntry.Mode == filemode.Submodule {
+			sp.from = &submoduleEntry{path: c.From.Name, hash: c.From.TreeEntry.Hash}
+			sp.chunks = append(sp.chunks, &renameChunk{content: fmt.Sprintf("Subproject commit %s\n", c.From.TreeEntry.Hash), op: diff.Delete})
+		}
+		if c.To.TreeEntry.Mode == filemode.Submodule {
+			sp.to = &submoduleEntry{path: c.To.Name, hash: c.To.TreeEntry.Hash}
+			sp.chunks = append(sp.chunks, &renameChunk{content: fmt.Sprintf("Subproject commit %s\n", c.To.TreeEntry.Hash), op: diff.Add})
+		}
+		// a file replaced by a submodule or vice versa
+		if from, to := patches[i].Files(); from != nil || to != nil {
+			patches = append(patches, sp)
+			continue
+		}
+		patches[i] = sp
+	}
+	return patches, nil
+}
+
+// isSubmodulePatch returns true if the file patch changes a submodule pointer
+func isSubmodulePatch(p diff.FilePatch) bool {
+	from, to := p.Files()
+	return (from != nil && from.Mode() == filemode.Submodule) || (to != nil && to.Mode() == filemode.Submodule)
+}
+
+// attributeSubmodule matches the changes between the old and the new commit of the submodule
+// against the segments of the submodule's maintainers file, the result is nil if the submodule
+// is removed or has no maintainers file
+func attributeSubmodule(c *Config, repo *git.Repository, p diff.FilePatch) (string, *PatchInfo, error) {
+	from, to := p.Files()
+	if to == nil || to.Mode() != filemode.Submodule {
+		return "", nil, nil
+	}
+	path := to.Path()
+	wt, err := repo.Worktree()
+	if err != nil {
+		return path, nil, fmt.Errorf("Failed to open worktree of submodule '%s': %s", path, err)
+	}
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return path, nil, fmt.Errorf("Failed to read submodules: %s", err)
+	}
+	var subRepo *git.Repository
+	for _, s := range submodules {
+		if s.Config().Path == path {
+			subRepo, err = s.Repository()
+			if err != nil {
+				return path, nil, fmt.Errorf("Failed to open submodule '%s': %s", path, err)
+			}
+			break
+		}
+	}
+	if subRepo == nil {
+		return path, nil, fmt.Errorf("Failed to find submodule '%s' in .gitmodules", path)
+	}
+	subWt, err := subRepo.Worktree()
+	if err != nil {
+		return path, nil, fmt.Errorf("Failed to open worktree of submodule '%s': %s", path, err)
+	}
+	maintainersFile, err := findMaintainersFile(subWt.Filesystem.Root())
+	if err != nil {
+		return path, nil, nil
+	}
+	subConfig, err := loadMaintainers(maintainersFile, c.offline, nil)
+	if err != nil {
+		return path, nil, fmt.Errorf("Failed to load maintainers file of submodule '%s': %s", path, err)
+	}
+	subConfig.matchCache = c.matchCache
+	head, err := subRepo.CommitObject(to.Hash())
+	if err != nil {
+		return path, nil, fmt.Errorf("Failed to get commit %s of submodule '%s', update the submodule: %s", to.Hash(), path, err)
+	}
+	headTree, err := head.Tree()
+	if err != nil {
+		return path, nil, fmt.Errorf("Failed to get tree of submodule '%s': %s", path, err)
+	}
+	// added submodules have every file changed
+	var fromTree *object.Tree
+	var commits []*object.Commit
+	if from != nil && from.Mode() == filemode.Submodule {
+		first, err := subRepo.CommitObject(from.Hash())
+		if err != nil {
+			return path, nil, fmt.Errorf("Failed to get commit %s of submodule '%s', update the submodule: %s", from.Hash(), path, err)
+		}
+		fromTree, err = first.Tree()
+		if err != nil {
+			return path, nil, fmt.Errorf("Failed to get tree of submodule '%s': %s", path, err)
+		}
+		// the submodule may be moved to an unrelated commit, its messages are matched from the merge base
+		base, err := mergeBase(head, first)
+		if err != nil {
+			return path, nil, fmt.Errorf("Failed to get history of submodule '%s': %s", path, err)
+		}
+		commits, err = getRangeCommits(subRepo, head, base)
+		if err != nil {
+			return path, nil, err
+		}
+	}
+	patches, err := treePatches(fromTree, headTree)
+	if err != nil {
+		return path, nil, err
+	}
+	return path, attributePatch(subConfig, newBlobReader(subRepo), patches, commits), nil
+}
+
+// addSubmodule adds the segments and attributions of the submodule changes to the patch,
+// the segment names are prefixed with the submodule path and the changed files of the
+// submodule are reported as the submodule path
+func (p *PatchInfo) addSubmodule(path string, sub *PatchInfo) {
+	for name, s := range sub.Segments {
+		ps := *s
+		ps.Name = path + "/" + name
+		p.Segments[ps.Name] = &ps
+		p.Scores[ps.Name] += sub.Scores[name]
+	}
+	for _, a := range sub.Attributions {
+		sa := *a
+		sa.Segment = path + "/" + a.Segment
+		if a.Commit == nil {
+			sa.Path = path
+			sa.SubmoduleFile = path + "/" + a.Path
+			if a.SubmoduleFile != "" {
+				sa.SubmoduleFile = path + "/" + a.SubmoduleFile
+			}
+		}
+		p.Attributions = append(p.Attributions, &sa)
+	}
+}
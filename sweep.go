@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// parseGitHubRepositoryURL returns the owner and the name of a GitHub repository URL
+func parseGitHubRepositoryURL(u string) (string, string, error) {
+	URL, err := url.Parse(strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git"))
+	if err != nil || URL.Host != "github.com" {
+		return "", "", errors.New("Invalid GitHub repository URL")
+	}
+	parts := strings.Split(strings.Trim(URL.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("Invalid GitHub repository URL")
+	}
+	return parts[0], parts[1], nil
+}
+
+func (g *GitHubManager) OpenPullRequests(repoURL string) ([]string, error) {
+	owner, repo, err := parseGitHubRepositoryURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	client := g.client(ctx)
+	urls := make([]string, 0)
+	opt := &github.PullRequestListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		prs, resp, err := client.PullRequests.List(ctx, owner, repo, opt)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list open pull requests: %s", err)
+		}
+		for _, pr := range prs {
+			urls = append(urls, pr.GetHTMLURL())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return urls, nil
+}
+
+// sweepRepository returns the repository of the segments if all of them belong to the same repository
+func sweepRepository(c *Config) (string, error) {
+	repoURL := ""
+	for _, s := range c.Segments {
+		if s.Repository == "" || sameRepository(s.Repository, repoURL) {
+			continue
+		}
+		if repoURL != "" {
+			return "", errors.New("The segments belong to multiple repositories, specify REPOSITORY_URL")
+		}
+		repoURL = s.Repository
+	}
+	if repoURL == "" {
+		return "", errors.New("No repository found in the maintainers file, specify REPOSITORY_URL")
+	}
+	return repoURL, nil
+}
+
+// sweep updates every open pull request of the repository like update-pull-request --fetch with one manager,
+// the failed pull requests are reported and the others are still updated
+func sweep(c *Config, repoPath, repoURL, APIKey string, opts *pullRequestOptions) error {
+	pm, err := getProjectManagerFromURL(repoURL)
+	if err != nil {
+		return err
+	}
+	pm.SetAPIKey(APIKey)
+	prs, err := pm.OpenPullRequests(repoURL)
+	if err != nil {
+		return err
+	}
+	opts.fetch = true
+	failed := 0
+	for _, pr := range prs {
+		fmt.Println("Updating", pr)
+		err := checkPullRequestWith(pm, c, repoPath, "", &changeSource{kind: committedChanges}, pr, APIKey, opts)
+		if err != nil {
+			fmt.Printf("Failed to update %s: %s\n", pr, err)
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("Failed to update %d of %d pull requests", failed, len(prs))
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+)
+
+// attributeSymbols matches the symbol patterns against the declarations touched by the patch
+func (s *ProjectSegment) attributeSymbols(path string, file *changedFile) *Attribution {
+	if len(s.symbolPatterns) == 0 {
+		return nil
+	}
+	for _, symbol := range file.changedSymbols() {
+		for _, sp := range s.symbolPatterns {
+			if sp.re.MatchString(symbol) {
+				return &Attribution{Segment: s.Name, Path: path, Pattern: sp, Symbol: symbol}
+			}
+		}
+	}
+	return nil
+}
+
+// changedSymbols returns the declarations of Go files touched by the added lines of the new file
+// or the deleted lines of the original file, qualified with the package name
+func (f *changedFile) changedSymbols() []string {
+	if f == nil {
+		return nil
+	}
+	if f.parsed {
+		return f.symbols
+	}
+	f.parsed = true
+	from, to := f.patch.Files()
+	if (to == nil || !strings.HasSuffix(to.Path(), ".go")) && (from == nil || !strings.HasSuffix(from.Path(), ".go")) {
+		return nil
+	}
+	added := make([]*Hunk, 0)
+	deleted := make([]*Hunk, 0)
+	for _, h := range patchHunks(f.patch) {
+		switch h.Operation {
+		case diff.Add:
+			added = append(added, h)
+		case diff.Delete:
+			deleted = append(deleted, h)
+		}
+	}
+	if to != nil && len(added) != 0 {
+		if content, ok := f.newContent(); ok {
+			for _, s := range goDeclarations(content, added) {
+				appendNew(&f.symbols, s)
+			}
+		}
+	}
+	if from != nil && len(deleted) != 0 {
+		if content, err := f.blobs.fileContent(from); err == nil {
+			for _, s := range goDeclarations(content, deleted) {
+				appendNew(&f.symbols, s)
+			}
+		}
+	}
+	return f.symbols
+}
+
+// goDeclarations returns the top level declarations of the Go source overlapping the line ranges
+func goDeclarations(src string, ranges []*Hunk) []string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil
+	}
+	pkg := file.Name.Name
+	symbols := make([]string, 0)
+	touched := func(n ast.Node) bool {
+		start, end := fset.Position(n.Pos()).Line, fset.Position(n.End()).Line
+		for _, r := range ranges {
+			if r.Start <= end && r.End >= start {
+				return true
+			}
+		}
+		return false
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !touched(d) {
+				continue
+			}
+			if d.Recv != nil && len(d.Recv.List) != 0 {
+				symbols = append(symbols, fmt.Sprintf("%s.%s.%s", pkg, receiverName(d.Recv.List[0].Type), d.Name.Name))
+			} else {
+				symbols = append(symbols, fmt.Sprintf("%s.%s", pkg, d.Name.Name))
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				var node ast.Node = spec
+				// the keyword of unparenthesized declarations belongs to the single spec
+				if !d.Lparen.IsValid() {
+					node = d
+				}
+				if !touched(node) {
+					continue
+				}
+				switch sp := spec.(type) {
+				case *ast.TypeSpec:
+					symbols = append(symbols, fmt.Sprintf("%s.%s", pkg, sp.Name.Name))
+				case *ast.ValueSpec:
+					for _, n := range sp.Names {
+						symbols = append(symbols, fmt.Sprintf("%s.%s", pkg, n.Name))
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// receiverName returns the type name of a method receiver
+func receiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(e.X)
+	case *ast.IndexExpr:
+		return receiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
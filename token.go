@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Environment variable of the forge API token
+const tokenEnvVar string = "CHIEFR_TOKEN"
+
+// Name of the keyring service of the forge API tokens, the account is the host of the forge
+const keyringService string = "chiefr"
+
+// File of the forge API token set by --token-file
+var tokenFile string
+
+// shiftTokenArgument moves the arguments of the optional REVISION if the deprecated API_KEY argument
+// is specified without a revision, because the command line parser assigns the arguments from the left
+func shiftTokenArgument(revision, pullRequestURL, key *string) {
+	if *key == "" && *revision != "" && strings.Contains(*revision, "://") && !strings.Contains(*pullRequestURL, "://") {
+		*revision, *pullRequestURL, *key = "", *revision, *pullRequestURL
+	}
+}
+
+// hostTokenEnvVar returns the environment variable of the API token of the host,
+// e.g. CHIEFR_TOKEN_GITLAB_EXAMPLE_COM for gitlab.example.com
+func hostTokenEnvVar(host string) string {
+	name := make([]rune, 0, len(host))
+	for _, r := range strings.ToUpper(host) {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			r = '_'
+		}
+		name = append(name, r)
+	}
+	return tokenEnvVar + "_" + string(name)
+}
+
+// forgeTokenEnvVar returns the environment variable of the API token of the forge of the URL
+func forgeTokenEnvVar(u *url.URL) string {
+	if isGitLabURL(u) {
+		return "CHIEFR_GITLAB_TOKEN"
+	}
+	return "CHIEFR_GITHUB_TOKEN"
+}
+
+// apiToken returns the API token of the forge of the URL from the API_KEY argument (deprecated),
+// the host's CHIEFR_TOKEN_HOST or the forge's CHIEFR_GITHUB_TOKEN or CHIEFR_GITLAB_TOKEN environment variable,
+// the CHIEFR_TOKEN environment variable, the --token-file file, the git credential helpers
+// or the keyring of the OS, in that order
+func apiToken(forgeURL, argument string) (string, error) {
+	if argument != "" {
+		fmt.Fprintf(os.Stderr, "Warning! Passing the API key as an argument is deprecated, use %s or --token-file instead\n", tokenEnvVar)
+		return argument, nil
+	}
+	u, err := url.Parse(forgeURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("Failed to find API token: invalid URL '%s'", forgeURL)
+	}
+	if token := os.Getenv(hostTokenEnvVar(u.Host)); token != "" {
+		return token, nil
+	}
+	if token := os.Getenv(forgeTokenEnvVar(u)); token != "" {
+		return token, nil
+	}
+	if token := os.Getenv(tokenEnvVar); token != "" {
+		return token, nil
+	}
+	if tokenFile != "" {
+		content, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read token file: %s", err)
+		}
+		if token := strings.TrimSpace(string(content)); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("Failed to read token file: '%s' is empty", tokenFile)
+	}
+	if token := credentialHelperToken(u); token != "" {
+		return token, nil
+	}
+	if token := keyringToken(u.Host); token != "" {
+		return token, nil
+	}
+	return "", fmt.Errorf("API token of %s not found: set %s, %s, %s, --token-file, a git credential or a '%s' keyring entry", u.Host, hostTokenEnvVar(u.Host), forgeTokenEnvVar(u), tokenEnvVar, keyringService)
+}
+
+// credentialHelperToken returns the password of the host stored by the git credential helpers,
+// empty string is returned if git isn't installed or no credential is stored
+func credentialHelperToken(u *url.URL) string {
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\n\n", u.Scheme, u.Host))
+	// the user isn't prompted if the helpers have no credential
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "password=") {
+			return strings.TrimPrefix(line, "password=")
+		}
+	}
+	return ""
+}
+
+// keyringToken returns the token of the host stored in the keyring of the OS with the service
+// name chiefr, empty string is returned if the keyring tool isn't available or has no token
+func keyringToken(host string) string {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", host, "-w")
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "host", host)
+	default:
+		return ""
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
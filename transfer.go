@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+// Instructions of submitting the branch of a pull request to another repository
+type transferInstructions struct {
+	// Repository responsible for the changes
+	Repository string
+	// Commands pushing the branch of the pull request to the fork of the repository
+	Commands []string
+	// URL opening a pull request of the pushed branch against the repository
+	CompareURL string
+}
+
+// transfers returns the instructions of submitting the branch of the author to the GitHub
+// repositories, other repositories have no instructions
+func transfers(repositories []string, author, branch string) []*transferInstructions {
+	instructions := make([]*transferInstructions, 0)
+	for _, r := range repositories {
+		owner, name, err := parseGitHubRepositoryURL(r)
+		if err != nil {
+			continue
+		}
+		// the remote is named after the repository to keep the commands of multiple repositories apart
+		remote := name
+		fork := fmt.Sprintf("https://github.com/%s/%s.git", author, name)
+		instructions = append(instructions, &transferInstructions{
+			Repository: r,
+			Commands: []string{
+				fmt.Sprintf("git remote add %s %s", remote, fork),
+				fmt.Sprintf("git push %s %s", remote, branch),
+			},
+			CompareURL: fmt.Sprintf("https://github.com/%s/%s/compare/%s:%s?expand=1", owner, name, author, branch),
+		})
+	}
+	return instructions
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Date format of the end of the unavailability
+const unavailableDateFormat string = "2006-01-02"
+
+// parseUnavailable returns the last day of the unavailability, zero time if the user is unavailable until removed
+func parseUnavailable(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(unavailableDateFormat, value)
+}
+
+// unavailable reports whether the user opted out of the automatic assignment at the time,
+// the user is available again the day after the end of the unavailability
+func (c *Config) unavailable(login string, now time.Time) bool {
+	for user, until := range c.Unavailable {
+		if strings.EqualFold(user, login) {
+			return until.IsZero() || now.Before(until.AddDate(0, 0, 1))
+		}
+	}
+	return false
+}
+
+// skipUser returns the function reporting the users who aren't assigned or requested to review:
+// the author, the unavailable users and with the BusyStatus setting the users having busy GitHub status
+func (g *GitHubManager) skipUser(c *Config, author string) func(string) bool {
+	now := time.Now()
+	return func(login string) bool {
+		if strings.EqualFold(login, author) || c.unavailable(login, now) || containsUser(g.excludedUsers, login) {
+			return true
+		}
+		// the status of teams can't be set, dry runs don't call the API
+		if !c.Settings.BusyStatus || g.DryRun || strings.HasPrefix(login, "@") {
+			return false
+		}
+		busy, err := g.busy(login)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning! %s\n", err)
+		}
+		return busy
+	}
+}
+
+// busy reports whether the GitHub status of the user indicates limited availability
+func (g *GitHubManager) busy(login string) (bool, error) {
+	if g.busyUsers == nil {
+		g.busyUsers = make(map[string]bool)
+	}
+	if busy, found := g.busyUsers[strings.ToLower(login)]; found {
+		return busy, nil
+	}
+	var result struct {
+		User struct {
+			Status *struct {
+				IndicatesLimitedAvailability bool `json:"indicatesLimitedAvailability"`
+			} `json:"status"`
+		} `json:"user"`
+	}
+	query := `query($login: String!) { user(login: $login) { status { indicatesLimitedAvailability } } }`
+	client := g.httpClient(context.Background())
+	if err := githubGraphQL(client, query, map[string]interface{}{"login": login}, &result); err != nil {
+		return false, fmt.Errorf("Failed to get the status of '%s': %s", login, err)
+	}
+	busy := result.User.Status != nil && result.User.Status.IndicatesLimitedAvailability
+	g.busyUsers[strings.ToLower(login)] = busy
+	return busy, nil
+}
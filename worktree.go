@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/diff"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/utils/binary"
+)
+
+type changeKind int
+
+const (
+	// commits since the revision
+	committedChanges changeKind = iota
+	// changes of the index compared to HEAD
+	stagedChanges
+	// uncommitted changes of the working tree including untracked files
+	worktreeChanges
+	// changes of a unified diff or `git format-patch` file
+	patchFileChanges
+)
+
+// Source of the changes to analyze
+type changeSource struct {
+	kind changeKind
+	// Path of the patch file, "-" is the standard input
+	patchFile string
+	// Content of the patch file read once for repeated analysis
+	patch []byte
+}
+
+// File of the HEAD tree, the index or the working tree with its content
+type worktreeFile struct {
+	path    string
+	hash    plumbing.Hash
+	mode    filemode.FileMode
+	content string
+}
+
+func (f *worktreeFile) Hash() plumbing.Hash     { return f.hash }
+func (f *worktreeFile) Mode() filemode.FileMode { return f.mode }
+func (f *worktreeFile) Path() string            { return f.path }
+
+// File patch of uncommitted changes
+type worktreePatch struct {
+	from   diff.File
+	to     diff.File
+	binary bool
+	chunks []diff.Chunk
+}
+
+func (p *worktreePatch) IsBinary() bool                { return p.binary }
+func (p *worktreePatch) Files() (diff.File, diff.File) { return p.from, p.to }
+func (p *worktreePatch) Chunks() []diff.Chunk          { return p.chunks }
+
+// analyzeChanges matches the changes of the source against the segments,
+// revision is the first commit of the committed changes, nil source means committed changes
+func analyzeChanges(c *Config, repoPath, revision string, source *changeSource) (*PatchInfo, error) {
+	if source == nil || source.kind == committedChanges {
+		if c.nativeGit {
+			return analyzeNativePatch(c, repoPath, revision)
+		}
+		info, err := analyzePatch(c, repoPath, revision)
+		if err != nil {
+			return nativeFallback(err, func() (*PatchInfo, error) {
+				return analyzeNativePatch(c, repoPath, revision)
+			})
+		}
+		return info, nil
+	}
+	if source.kind == patchFileChanges {
+		content, err := source.readPatchFile()
+		if err != nil {
+			return nil, err
+		}
+		patches, commits, err := parsePatchFile(content)
+		if err != nil {
+			return nil, err
+		}
+		// the blobs of the repository are used only if the patch is analyzed in a clone
+		repo, err := openRepository(repoPath)
+		if err != nil {
+			repo = nil
+			if c.usesFileContents() {
+				fmt.Fprintf(os.Stderr, "Warning! FileContentPatterns and SymbolPatterns are not available without the repository: %s\n", err)
+			}
+		}
+		return attributePatch(c, newBlobReader(repo), patches, commits), nil
+	}
+	staged := source.kind == stagedChanges
+	if c.nativeGit {
+		return analyzeNativeWorktree(c, repoPath, staged)
+	}
+	repo, err := openRepository(repoPath)
+	if err != nil {
+		return nativeFallback(fmt.Errorf("Failed to open git repository: %s", err.Error()), func() (*PatchInfo, error) {
+			return analyzeNativeWorktree(c, repoPath, staged)
+		})
+	}
+	patches, err := worktreePatches(repo, staged)
+	if err != nil {
+		return nativeFallback(err, func() (*PatchInfo, error) {
+			return analyzeNativeWorktree(c, repoPath, staged)
+		})
+	}
+	return attributePatch(c, newBlobReader(repo), patches, nil), nil
+}
+
+// worktreePatches returns the patches of the staged or the uncommitted changes compared to HEAD
+func worktreePatches(repo *git.Repository, staged bool) ([]diff.FilePatch, error) {
+	tree, err := repoHeadTree(repo)
+	if err != nil {
+		return nil, err
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open working tree: %s", err)
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get working tree status: %s", err)
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read index: %s", err)
+	}
+	paths := make([]string, 0, len(status))
+	for path, fs := range status {
+		if staged && (fs.Staging == git.Unmodified || fs.Staging == git.Untracked) {
+			continue
+		}
+		if !staged && fs.Staging == git.Unmodified && fs.Worktree == git.Unmodified {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	patches := make([]diff.FilePatch, 0, len(paths))
+	for _, path := range paths {
+		var src, dst *worktreeFile
+		if f, err := tree.File(path); err == nil {
+			content, err := f.Contents()
+			if err != nil {
+				return nil, fmt.Errorf("Failed to read '%s' of HEAD: %s", path, err)
+			}
+			src = &worktreeFile{path: path, hash: f.Hash, mode: f.Mode, content: content}
+		}
+		e, err := idx.Entry(path)
+		// files excluded by sparse checkout are missing from the working tree, their index version is used
+		if staged || err == nil && e.SkipWorktree {
+			if err == nil {
+				dst, err = indexFile(repo, e)
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			content, err := readWorktreeFile(wt, path)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("Failed to read '%s': %s", path, err)
+			}
+			if err == nil {
+				dst = &worktreeFile{
+					path:    path,
+					hash:    plumbing.ComputeHash(plumbing.BlobObject, content),
+					mode:    filemode.Regular,
+					content: string(content),
+				}
+			}
+		}
+		if src == nil && dst == nil || src != nil && dst != nil && src.hash == dst.hash {
+			continue
+		}
+		patches = append(patches, newWorktreePatch(src, dst))
+	}
+	return patches, nil
+}
+
+// newWorktreePatch returns the patch of the changes between the files, src or dst is nil for added or deleted files
+func newWorktreePatch(src, dst *worktreeFile) *worktreePatch {
+	p := &worktreePatch{}
+	oldContent, newContent := "", ""
+	if src != nil {
+		p.from, oldContent = src, src.content
+	}
+	if dst != nil {
+		p.to, newContent = dst, dst.content
+	}
+	for _, content := range []string{oldContent, newContent} {
+		if isBinary, _ := binary.IsBinary(bytes.NewBufferString(content)); isBinary {
+			p.binary = true
+		}
+	}
+	if !p.binary {
+		p.chunks = diffChunks(oldContent, newContent)
+	}
+	return p
+}
+
+// indexFile returns the file of the index entry
+func indexFile(repo *git.Repository, e *index.Entry) (*worktreeFile, error) {
+	blob, err := repo.BlobObject(e.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read '%s' of the index: %s", e.Name, err)
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read '%s' of the index: %s", e.Name, err)
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read '%s' of the index: %s", e.Name, err)
+	}
+	return &worktreeFile{path: e.Name, hash: e.Hash, mode: e.Mode, content: string(content)}, nil
+}
+
+func readWorktreeFile(wt *git.Worktree, path string) ([]byte, error) {
+	f, err := wt.Filesystem.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// worktreePaths returns the paths of the index or the working tree files
+func worktreePaths(repoPath string, staged bool) ([]string, error) {
+	repo, err := openRepository(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open git repository: %s", err.Error())
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read index: %s", err)
+	}
+	paths := make([]string, 0, len(idx.Entries))
+	// files excluded by sparse checkout
+	skipped := make(map[string]bool)
+	for _, e := range idx.Entries {
+		paths = append(paths, e.Name)
+		if e.SkipWorktree {
+			skipped[e.Name] = true
+		}
+	}
+	if staged {
+		return paths, nil
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open working tree: %s", err)
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get working tree status: %s", err)
+	}
+	files := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if fs, found := status[p]; !found || fs.Worktree != git.Deleted || skipped[p] {
+			files = append(files, p)
+		}
+	}
+	for p, fs := range status {
+		if fs.Worktree == git.Untracked {
+			files = append(files, p)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}